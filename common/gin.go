@@ -109,3 +109,12 @@ func ApiSuccess(c *gin.Context, data any) {
 		"data":    data,
 	})
 }
+
+// GetBatchId 返回当前请求所属的批处理任务 id，非批处理请求返回空串
+func GetBatchId(c *gin.Context) string {
+	if c.Request == nil {
+		return ""
+	}
+	batchId, _ := c.Request.Context().Value(constant.ContextKeyBatchId).(string)
+	return batchId
+}
@@ -117,4 +117,6 @@ func initConstantEnv() {
 	constant.GenerateDefaultToken = GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
 	// 是否启用错误日志
 	constant.ErrorLogEnabled = GetEnvOrDefaultBool("ERROR_LOG_ENABLED", false)
+	// 文件接口本地存储目录
+	constant.FileStoragePath = GetEnvOrDefaultString("FILE_STORAGE_PATH", "./files")
 }
@@ -39,32 +39,41 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 }
 
 func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (bool, error) {
-	// 默认配置
-	config := &Config{
-		Capacity:  10,
-		Rate:      1,
-		Requested: 1,
+	result, err := rl.Take(ctx, key, opts...)
+	if err != nil {
+		return false, err
 	}
+	return result.Allowed, nil
+}
 
-	// 应用选项模式
-	for _, opt := range opts {
-		opt(config)
-	}
+// Take 从桶中取出令牌，并返回取出后桶中剩余的令牌数
+func (rl *RedisLimiter) Take(ctx context.Context, key string, opts ...Option) (*Result, error) {
+	config := newConfig(opts...)
 
 	// 执行限流
-	result, err := rl.client.EvalSha(
+	values, err := rl.client.EvalSha(
 		ctx,
 		rl.limitScriptSHA,
 		[]string{key},
 		config.Requested,
 		config.Rate,
 		config.Capacity,
-	).Int()
+		config.forceFlag(),
+	).Int64Slice()
 
 	if err != nil {
-		return false, fmt.Errorf("rate limit failed: %w", err)
+		return nil, fmt.Errorf("rate limit failed: %w", err)
+	}
+	if len(values) != 2 {
+		return nil, fmt.Errorf("rate limit failed: unexpected result %v", values)
 	}
-	return result == 1, nil
+	return &Result{Allowed: values[0] == 1, Remaining: values[1]}, nil
+}
+
+// Result 一次取令牌的结果
+type Result struct {
+	Allowed   bool
+	Remaining int64
 }
 
 // Config 配置选项模式
@@ -72,6 +81,30 @@ type Config struct {
 	Capacity  int64
 	Rate      int64
 	Requested int64
+	// 不检查余量直接扣除，Requested 为负数时表示退还
+	Force bool
+}
+
+func newConfig(opts ...Option) *Config {
+	// 默认配置
+	config := &Config{
+		Capacity:  10,
+		Rate:      1,
+		Requested: 1,
+	}
+
+	// 应用选项模式
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+func (cfg *Config) forceFlag() int {
+	if cfg.Force {
+		return 1
+	}
+	return 0
 }
 
 type Option func(*Config)
@@ -87,3 +120,7 @@ func WithRate(r int64) Option {
 func WithRequested(n int64) Option {
 	return func(cfg *Config) { cfg.Requested = n }
 }
+
+func WithForce() Option {
+	return func(cfg *Config) { cfg.Force = true }
+}
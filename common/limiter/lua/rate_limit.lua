@@ -3,11 +3,13 @@
 -- ARGV[1]: 请求令牌数 (通常为1)
 -- ARGV[2]: 令牌生成速率 (每秒)
 -- ARGV[3]: 桶容量
+-- ARGV[4]: 为 1 时不检查余量直接扣除（可为负数，表示退还），用于按实际用量校正
 
 local key = KEYS[1]
 local requested = tonumber(ARGV[1])
 local rate = tonumber(ARGV[2])
 local capacity = tonumber(ARGV[3])
+local force = ARGV[4] == '1'
 
 -- 获取当前时间（Redis服务器时间）
 local now = redis.call('TIME')
@@ -32,8 +34,8 @@ end
 
 -- 判断是否允许请求
 local allowed = false
-if tokens >= requested then
-    tokens = tokens - requested
+if force or tokens >= requested then
+    tokens = math.min(capacity, tokens - requested)
     allowed = true
 end
 
@@ -41,4 +43,5 @@ end
 redis.call('HMSET', key, 'tokens', tokens, 'last_time', last_time)
 --redis.call('EXPIRE', key, math.ceil(capacity / rate) + 60) -- 适当延长过期时间
 
-return allowed and 1 or 0
\ No newline at end of file
+-- 返回是否允许与剩余令牌数
+return {allowed and 1 or 0, tokens}
\ No newline at end of file
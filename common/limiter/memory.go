@@ -0,0 +1,64 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// 内存中的桶数超过该值时清理已经装满的桶
+const memoryBucketPruneSize = 10000
+
+type memoryBucket struct {
+	tokens   float64
+	lastTime time.Time
+	rate     float64
+	capacity float64
+}
+
+// MemoryLimiter 未启用 Redis 时使用的令牌桶，语义与 lua/rate_limit.lua 相同
+type MemoryLimiter struct {
+	buckets map[string]*memoryBucket
+	mutex   sync.Mutex
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*memoryBucket)}
+}
+
+func (ml *MemoryLimiter) Take(key string, opts ...Option) *Result {
+	config := newConfig(opts...)
+	now := time.Now()
+
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	bucket, ok := ml.buckets[key]
+	if !ok {
+		if len(ml.buckets) >= memoryBucketPruneSize {
+			ml.pruneLocked(now)
+		}
+		bucket = &memoryBucket{tokens: float64(config.Capacity), lastTime: now}
+		ml.buckets[key] = bucket
+	} else {
+		elapsed := now.Sub(bucket.lastTime).Seconds()
+		bucket.tokens = min(float64(config.Capacity), bucket.tokens+elapsed*float64(config.Rate))
+		bucket.lastTime = now
+	}
+	bucket.rate = float64(config.Rate)
+	bucket.capacity = float64(config.Capacity)
+
+	allowed := false
+	if config.Force || bucket.tokens >= float64(config.Requested) {
+		bucket.tokens = min(float64(config.Capacity), bucket.tokens-float64(config.Requested))
+		allowed = true
+	}
+	return &Result{Allowed: allowed, Remaining: int64(bucket.tokens)}
+}
+
+// pruneLocked 删除已经装满的桶，装满的桶与不存在的桶等价
+func (ml *MemoryLimiter) pruneLocked(now time.Time) {
+	for key, bucket := range ml.buckets {
+		if bucket.tokens+now.Sub(bucket.lastTime).Seconds()*bucket.rate >= bucket.capacity {
+			delete(ml.buckets, key)
+		}
+	}
+}
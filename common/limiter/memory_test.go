@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func takeOpts(requested int64, force bool) []Option {
+	opts := []Option{WithCapacity(10), WithRate(1), WithRequested(requested)}
+	if force {
+		opts = append(opts, WithForce())
+	}
+	return opts
+}
+
+// TestMemoryLimiterRefill 测试桶取空后拒绝请求，按速率补充后重新放行
+func TestMemoryLimiterRefill(t *testing.T) {
+	ml := NewMemoryLimiter()
+	result := ml.Take("refill", takeOpts(10, false)...)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+	assert.False(t, ml.Take("refill", takeOpts(1, false)...).Allowed)
+
+	// 经过 3 秒补充 3 个
+	ml.buckets["refill"].lastTime = ml.buckets["refill"].lastTime.Add(-3 * time.Second)
+	result = ml.Take("refill", takeOpts(2, false)...)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(1), result.Remaining)
+
+	// 补充不超过容量
+	ml.buckets["refill"].lastTime = ml.buckets["refill"].lastTime.Add(-time.Hour)
+	assert.Equal(t, int64(9), ml.Take("refill", takeOpts(1, false)...).Remaining)
+}
+
+// TestMemoryLimiterForce 测试强制扣减可以透支，负数的扣减用于退还且不超过容量
+func TestMemoryLimiterForce(t *testing.T) {
+	ml := NewMemoryLimiter()
+	result := ml.Take("force", takeOpts(15, true)...)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(-5), result.Remaining)
+	assert.False(t, ml.Take("force", takeOpts(1, false)...).Allowed)
+
+	result = ml.Take("force", takeOpts(-8, true)...)
+	assert.Equal(t, int64(3), result.Remaining)
+	result = ml.Take("force", takeOpts(-100, true)...)
+	assert.Equal(t, int64(10), result.Remaining, "退还后不超过容量")
+}
+
+// TestMemoryLimiterPrune 测试桶数达到上限时清理已经装满的桶，未装满的桶保留
+func TestMemoryLimiterPrune(t *testing.T) {
+	ml := NewMemoryLimiter()
+	ml.Take("drained", takeOpts(10, false)...)
+	for i := 1; i < memoryBucketPruneSize; i++ {
+		ml.Take("full:"+strconv.Itoa(i), takeOpts(0, false)...)
+	}
+	assert.Len(t, ml.buckets, memoryBucketPruneSize)
+
+	ml.Take("new", takeOpts(1, false)...)
+	assert.Len(t, ml.buckets, 2)
+	assert.Contains(t, ml.buckets, "drained")
+	assert.Contains(t, ml.buckets, "new")
+	assert.False(t, ml.Take("drained", takeOpts(1, false)...).Allowed, "未装满的桶不应被清理")
+}
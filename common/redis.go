@@ -325,3 +325,24 @@ func RedisHSetField(key, field string, value interface{}) error {
 	}
 	return nil
 }
+
+func RedisHSet(key, field string, value interface{}) error {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HSET: key=%s, field=%s, value=%v", key, field, value))
+	}
+	return RDB.HSet(context.Background(), key, field, value).Err()
+}
+
+func RedisHDel(key string, fields ...string) error {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HDEL: key=%s, fields=%v", key, fields))
+	}
+	return RDB.HDel(context.Background(), key, fields...).Err()
+}
+
+func RedisHGetAll(key string) (map[string]string, error) {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis HGETALL: key=%s", key))
+	}
+	return RDB.HGetAll(context.Background(), key).Result()
+}
@@ -4,6 +4,7 @@ type ContextKey string
 
 const (
 	ContextKeyOriginalModel    ContextKey = "original_model"
+	ContextKeyRequestedModel   ContextKey = "requested_model" // 改用后备模型时保存客户端请求的模型
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
 
 	/* token related keys */
@@ -15,6 +16,9 @@ const (
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenPeriodStart       ContextKey = "token_period_start" // 令牌预算本周期的开始时间，未启用周期预算时为 0
+	ContextKeyTokenRpmLimit          ContextKey = "token_rpm_limit"
+	ContextKeyTokenTpmLimit          ContextKey = "token_tpm_limit"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -31,14 +35,22 @@ const (
 	ContextKeyChannelIsMultiKey        ContextKey = "channel_is_multi_key"
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
+	ContextKeyChannelInFlightSlot      ContextKey = "channel_in_flight_slot"
+	ContextKeyChannelAffinity          ContextKey = "channel_affinity"
+	ContextKeySessionAffinityHash      ContextKey = "session_affinity_hash"
 
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
 	ContextKeyUserSetting ContextKey = "user_setting"
 	ContextKeyUserQuota   ContextKey = "user_quota"
+	ContextKeyUserCredit  ContextKey = "user_credit_limit"
 	ContextKeyUserStatus  ContextKey = "user_status"
 	ContextKeyUserEmail   ContextKey = "user_email"
 	ContextKeyUserGroup   ContextKey = "user_group"
 	ContextKeyUsingGroup  ContextKey = "group"
 	ContextKeyUserName    ContextKey = "username"
+
+	/* batch related keys */
+	// ContextKeyBatchId 存放在 http.Request 的 context 中（而不是 gin 上下文），避免被客户端伪造
+	ContextKeyBatchId ContextKey = "batch_id"
 )
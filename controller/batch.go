@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 目前仅支持 24h 完成窗口，与 OpenAI 保持一致
+var supportedBatchCompletionWindows = map[string]int64{
+	"24h": 24 * 3600,
+}
+
+func getUserBatch(c *gin.Context) *model.Batch {
+	batch, err := model.GetUserBatchById(c.Param("id"), c.GetInt("id"))
+	if err == nil && batch.Format != model.BatchFormatOpenAI {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "query_data_error", err.Error())
+		}
+		return nil
+	}
+	return batch
+}
+
+// checkBatchAllowIps 批处理中的请求由网关内部发起，因此在创建时校验令牌的 IP 限制
+func checkBatchAllowIps(c *gin.Context) bool {
+	allowIpsMap := common.GetContextKeyStringMap(c, constant.ContextKeyTokenAllowIps)
+	if len(allowIpsMap) == 0 {
+		return true
+	}
+	_, ok := allowIpsMap[c.ClientIP()]
+	return ok
+}
+
+// cancelLocalBatch 将本地执行的批处理置为取消中，返回 false 表示状态已被并发修改
+func cancelLocalBatch(batch *model.Batch) (bool, error) {
+	now := common.GetTimestamp()
+	ok, err := batch.UpdateStatusFrom(batch.Status, map[string]interface{}{
+		"status":        model.BatchStatusCancelling,
+		"cancelling_at": now,
+	})
+	if err != nil || !ok {
+		return ok, err
+	}
+	batch.Status = model.BatchStatusCancelling
+	batch.CancellingAt = now
+	// 运行在其它节点上的批处理会在下一次同步进度时发现取消状态
+	service.CancelRunningBatch(batch.Id)
+	return true, nil
+}
+
+func CreateBatch(c *gin.Context) {
+	if !operation_setting.GetBatchSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	if !checkBatchAllowIps(c) {
+		fileApiError(c, http.StatusForbidden, "ip_not_allowed", "您的 IP 不在令牌允许访问的列表中")
+		return
+	}
+	var request dto.OpenAIBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request", "Invalid request body: "+err.Error())
+		return
+	}
+	if !service.SupportedBatchEndpoints[request.Endpoint] {
+		fileApiError(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("Unsupported endpoint: %s", request.Endpoint))
+		return
+	}
+	window, ok := supportedBatchCompletionWindows[request.CompletionWindow]
+	if !ok {
+		fileApiError(c, http.StatusBadRequest, "invalid_completion_window", fmt.Sprintf("Unsupported completion_window: %s", request.CompletionWindow))
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileById(request.InputFileId, userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", request.InputFileId))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "query_data_error", err.Error())
+		}
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		fileApiError(c, http.StatusBadRequest, "invalid_input_file", "The input file must be uploaded with purpose 'batch'")
+		return
+	}
+	if inputFile.IsExpired() {
+		fileApiError(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("File %s has expired", inputFile.Id))
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		Id:               "batch_" + common.GetRandomString(24),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         request.Endpoint,
+		InputFileId:      inputFile.Id,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		Format:           model.BatchFormatOpenAI,
+		CreatedAt:        now,
+		ExpiresAt:        now + window,
+		HeartbeatAt:      now,
+	}
+	if len(request.Metadata) > 0 {
+		metadata, _ := common.Marshal(request.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "update_data_error", err.Error())
+		return
+	}
+	service.StartBatch(batch, inputFile)
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// 多查一条用于判断 has_more
+	batches, err := model.GetUserBatches(c.GetInt("id"), model.BatchFormatOpenAI, c.Query("after"), limit+1)
+	if err != nil {
+		fileApiError(c, http.StatusInternalServerError, "query_data_error", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	list := dto.OpenAIBatchList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		list.Data = append(list.Data, batch.ToOpenAIBatch())
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = list.Data[0].Id
+		list.LastId = list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch := getUserBatch(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func CancelBatch(c *gin.Context) {
+	batch := getUserBatch(c)
+	if batch == nil {
+		return
+	}
+	if batch.IsFinished() || batch.Status == model.BatchStatusCancelling {
+		fileApiError(c, http.StatusConflict, "batch_not_cancellable", fmt.Sprintf("Cannot cancel a batch with status '%s'", batch.Status))
+		return
+	}
+	ok, err := cancelLocalBatch(batch)
+	if err != nil {
+		fileApiError(c, http.StatusInternalServerError, "update_data_error", err.Error())
+		return
+	}
+	if !ok {
+		fileApiError(c, http.StatusConflict, "batch_not_cancellable", "Batch status changed, please retry")
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
@@ -118,6 +118,8 @@ func testChannel(channel *model.Channel, testModel string) testResult {
 	group, _ := model.GetUserGroup(1, false)
 	c.Set("group", group)
 
+	// 测试请求同样占用渠道并发槽位
+	defer model.ReleaseChannelSlot(c)
 	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, testModel)
 	if newAPIError != nil {
 		return testResult{
@@ -142,6 +142,7 @@ func GetAllChannels(c *gin.Context) {
 	for _, r := range results {
 		typeCounts[r.Type] = r.Count
 	}
+	model.FillChannelCooldowns(channelData)
 	common.ApiSuccess(c, gin.H{
 		"items":       channelData,
 		"total":       total,
@@ -319,6 +320,7 @@ func SearchChannels(c *gin.Context) {
 	}
 
 	pagedData := channelData[startIdx:endIdx]
+	model.FillChannelCooldowns(pagedData)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -343,6 +345,7 @@ func GetChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.FillChannelCooldowns([]*model.Channel{channel})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -669,7 +672,9 @@ func DeleteChannelBatch(c *gin.Context) {
 
 type PatchChannel struct {
 	model.Channel
-	MultiKeyMode *string `json:"multi_key_mode"`
+	MultiKeyMode        *string     `json:"multi_key_mode"`
+	KeyMaxInFlight      *int        `json:"key_max_in_flight"`
+	MultiKeyMaxInFlight map[int]int `json:"multi_key_max_in_flight"`
 }
 
 func UpdateChannel(c *gin.Context) {
@@ -705,6 +710,13 @@ func UpdateChannel(c *gin.Context) {
 	if channel.MultiKeyMode != nil && *channel.MultiKeyMode != "" {
 		channel.ChannelInfo.MultiKeyMode = constant.MultiKeyMode(*channel.MultiKeyMode)
 	}
+	// 多Key渠道的key并发上限
+	if channel.KeyMaxInFlight != nil {
+		channel.ChannelInfo.KeyMaxInFlight = *channel.KeyMaxInFlight
+	}
+	if channel.MultiKeyMaxInFlight != nil {
+		channel.ChannelInfo.MultiKeyMaxInFlight = channel.MultiKeyMaxInFlight
+	}
 	err = channel.Update()
 	if err != nil {
 		common.ApiError(c, err)
@@ -1195,3 +1207,49 @@ func GetChannelKey(c *gin.Context) {
 		"data":    keyViewData,
 	})
 }
+
+// GetChannelBreakers 获取全部渠道的熔断状态
+func GetChannelBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelBreakerStatuses(0),
+	})
+}
+
+// GetChannelBreaker 获取单个渠道及其密钥的熔断状态
+func GetChannelBreaker(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelBreakerStatuses(id),
+	})
+}
+
+// ResetChannelBreaker 手动恢复熔断中的渠道
+func ResetChannelBreaker(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.ResetChannelBreaker(id)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetChannelStats 获取当前节点由实际流量统计的渠道延迟、并发与错误率
+func GetChannelStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelStats(),
+	})
+}
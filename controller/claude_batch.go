@@ -0,0 +1,889 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting"
+	"one-api/setting/operation_setting"
+	"one-api/types"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	claudeBatchEndpoint         = "/v1/messages"
+	claudeBatchWindow           = 24 * 3600
+	defaultAnthropicVersion     = "2023-06-01"
+	claudeBatchResultsMediaType = "application/binary"
+	// Anthropic 保留批处理结果 29 天，更早的批处理无法再同步计费
+	claudeBatchResultsRetention = 29 * 24 * 3600
+)
+
+func claudeBatchApiError(c *gin.Context, statusCode int, errorType string, message string) {
+	c.JSON(statusCode, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    errorType,
+			"message": message,
+		},
+	})
+}
+
+func claudeBatchResultsUrl(batchId string) string {
+	return fmt.Sprintf("%s/v1/messages/batches/%s/results", strings.TrimSuffix(setting.ServerAddress, "/"), batchId)
+}
+
+func getUserClaudeBatch(c *gin.Context) *model.Batch {
+	batch, err := model.GetUserBatchById(c.Param("id"), c.GetInt("id"))
+	if err == nil && batch.Format != model.BatchFormatClaude {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			claudeBatchApiError(c, http.StatusNotFound, "not_found_error", fmt.Sprintf("Message batch %s not found", c.Param("id")))
+		} else {
+			claudeBatchApiError(c, http.StatusInternalServerError, "api_error", err.Error())
+		}
+		return nil
+	}
+	return batch
+}
+
+// CreateClaudeBatch 创建 Anthropic Message Batch：
+// 所有请求使用同一模型且选中 Anthropic 渠道时原样转发到上游，否则由网关在本地逐条执行
+func CreateClaudeBatch(c *gin.Context) {
+	batchSetting := operation_setting.GetBatchSetting()
+	if !batchSetting.Enabled {
+		claudeBatchApiError(c, http.StatusNotImplemented, "api_error", "Message batches are not enabled")
+		return
+	}
+	if !checkBatchAllowIps(c) {
+		claudeBatchApiError(c, http.StatusForbidden, "permission_error", "您的 IP 不在令牌允许访问的列表中")
+		return
+	}
+	var request dto.ClaudeMessageBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request body: "+err.Error())
+		return
+	}
+	if len(request.Requests) == 0 {
+		claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", "requests: at least one request is required")
+		return
+	}
+	if batchSetting.MaxRequestsPerBatch > 0 && len(request.Requests) > batchSetting.MaxRequestsPerBatch {
+		claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("requests: at most %d requests are allowed", batchSetting.MaxRequestsPerBatch))
+		return
+	}
+
+	models := make(map[string]bool)
+	customIds := make(map[string]bool)
+	var input bytes.Buffer
+	for i, item := range request.Requests {
+		if item.CustomId == "" || customIds[item.CustomId] {
+			claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("requests.%d.custom_id: must be unique and non-empty", i))
+			return
+		}
+		customIds[item.CustomId] = true
+		var params struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := common.Unmarshal(item.Params, &params); err != nil || params.Model == "" {
+			claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("requests.%d.params: model is required", i))
+			return
+		}
+		if params.Stream {
+			claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("requests.%d.params.stream: streaming is not supported in batches", i))
+			return
+		}
+		if !checkTokenModelLimit(c, params.Model) {
+			claudeBatchApiError(c, http.StatusForbidden, "permission_error", "该令牌无权访问模型 "+params.Model)
+			return
+		}
+		models[params.Model] = true
+		line, _ := common.Marshal(dto.OpenAIBatchInputLine{
+			CustomId: item.CustomId,
+			Method:   http.MethodPost,
+			Url:      claudeBatchEndpoint,
+			Body:     item.Params,
+		})
+		input.Write(line)
+		input.WriteByte('\n')
+	}
+
+	userId := c.GetInt("id")
+	tokenId := c.GetInt("token_id")
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		Id:               "msgbatch_" + common.GetRandomString(24),
+		UserId:           userId,
+		TokenId:          tokenId,
+		Endpoint:         claudeBatchEndpoint,
+		CompletionWindow: "24h",
+		Status:           model.BatchStatusValidating,
+		Format:           model.BatchFormatClaude,
+		Group:            getBatchUsingGroup(c),
+		TotalCount:       len(request.Requests),
+		CreatedAt:        now,
+		ExpiresAt:        now + claudeBatchWindow,
+		HeartbeatAt:      now,
+	}
+	if err := checkClaudeBatchQuota(c, batch, request.Requests); err != nil {
+		claudeBatchApiError(c, http.StatusForbidden, "permission_error", err.Error())
+		return
+	}
+	inputFile, err := service.SaveGeneratedFile(userId, tokenId, batch.Id+"_input.jsonl", "batch", &input)
+	if err != nil {
+		common.LogError(c, "save batch input failed: "+err.Error())
+		claudeBatchApiError(c, http.StatusInternalServerError, "api_error", "Failed to save batch requests")
+		return
+	}
+	batch.InputFileId = inputFile.Id
+
+	if len(models) == 1 {
+		var modelName string
+		for name := range models {
+			modelName = name
+		}
+		channel, selectGroup, err := model.CacheGetRandomSatisfiedChannel(c, batch.Group, modelName)
+		if err == nil && channel != nil && channel.Type == constant.ChannelTypeAnthropic {
+			// 与转发请求相同的密钥选择（熔断、冷却与并发上限），创建期间占用渠道槽位
+			if newAPIError := middleware.SetupContextForSelectedChannel(c, channel, modelName); newAPIError == nil {
+				defer model.ReleaseChannelSlot(c)
+				batch.Group = selectGroup
+				createNativeClaudeBatch(c, batch, channel, request)
+				return
+			}
+		}
+	}
+
+	if err := batch.Insert(); err != nil {
+		claudeBatchApiError(c, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+	service.StartBatch(batch, inputFile)
+	c.JSON(http.StatusOK, batch.ToClaudeMessageBatch(claudeBatchResultsUrl(batch.Id)))
+}
+
+func ListClaudeBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 1000 {
+		limit = 20
+	}
+	batches, err := model.GetUserBatches(c.GetInt("id"), model.BatchFormatClaude, c.Query("after_id"), limit+1)
+	if err != nil {
+		claudeBatchApiError(c, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	list := dto.ClaudeMessageBatchList{
+		Data:    make([]dto.ClaudeMessageBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		list.Data = append(list.Data, batch.ToClaudeMessageBatch(claudeBatchResultsUrl(batch.Id)))
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = &list.Data[0].Id
+		list.LastId = &list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveClaudeBatch(c *gin.Context) {
+	batch := getUserClaudeBatch(c)
+	if batch == nil {
+		return
+	}
+	if batch.UpstreamBatchId != "" {
+		relayNativeClaudeBatch(c, batch, http.MethodGet, "")
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToClaudeMessageBatch(claudeBatchResultsUrl(batch.Id)))
+}
+
+func CancelClaudeBatch(c *gin.Context) {
+	batch := getUserClaudeBatch(c)
+	if batch == nil {
+		return
+	}
+	if batch.UpstreamBatchId != "" {
+		relayNativeClaudeBatch(c, batch, http.MethodPost, "/cancel")
+		return
+	}
+	if !batch.IsFinished() && batch.Status != model.BatchStatusCancelling {
+		if _, err := cancelLocalBatch(batch); err != nil {
+			claudeBatchApiError(c, http.StatusInternalServerError, "api_error", err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, batch.ToClaudeMessageBatch(claudeBatchResultsUrl(batch.Id)))
+}
+
+func DeleteClaudeBatch(c *gin.Context) {
+	batch := getUserClaudeBatch(c)
+	if batch == nil {
+		return
+	}
+	if batch.UpstreamBatchId != "" {
+		// 原生批处理只在结束后计费，删除前先同步状态并完成计费
+		if !batch.IsFinished() {
+			if err := refreshNativeClaudeBatch(c, batch); err != nil {
+				common.LogError(c, fmt.Sprintf("refresh batch %s failed: %s", batch.Id, err.Error()))
+			}
+		}
+		if !batch.IsFinished() {
+			claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", "Message batches that are still processing must be canceled before deletion")
+			return
+		}
+		if err := ensureNativeClaudeBatchBilled(batch); err != nil {
+			common.LogError(c, fmt.Sprintf("bill batch %s failed: %s", batch.Id, err.Error()))
+			claudeBatchApiError(c, http.StatusBadGateway, "api_error", "Failed to settle message batch, please retry later")
+			return
+		}
+		resp, err := doNativeClaudeBatchRequest(c, batch, http.MethodDelete, "", nil)
+		if err != nil {
+			claudeBatchApiError(c, http.StatusBadGateway, "api_error", err.Error())
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+			c.Data(resp.StatusCode, "application/json", body)
+			return
+		}
+	} else if !batch.IsFinished() {
+		claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", "Message batches that are still processing must be canceled before deletion")
+		return
+	}
+	if err := batch.Delete(); err != nil {
+		claudeBatchApiError(c, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+	for _, fileId := range []string{batch.InputFileId, batch.OutputFileId, batch.ErrorFileId} {
+		deleteBatchFile(c, batch.UserId, fileId)
+	}
+	c.JSON(http.StatusOK, dto.ClaudeMessageBatchDeleted{
+		Id:   batch.Id,
+		Type: "message_batch_deleted",
+	})
+}
+
+// ClaudeBatchResults 以 JSONL 返回批处理结果，格式与 Anthropic 一致
+func ClaudeBatchResults(c *gin.Context) {
+	batch := getUserClaudeBatch(c)
+	if batch == nil {
+		return
+	}
+	if batch.UpstreamBatchId != "" {
+		// 直接获取结果的客户端可能从未查询过批处理，先从上游同步状态，结束后先计费再返回结果
+		if !batch.IsFinished() {
+			if err := refreshNativeClaudeBatch(c, batch); err != nil {
+				common.LogError(c, fmt.Sprintf("refresh batch %s failed: %s", batch.Id, err.Error()))
+			}
+		}
+		if err := ensureNativeClaudeBatchBilled(batch); err != nil {
+			common.LogError(c, fmt.Sprintf("bill batch %s failed: %s", batch.Id, err.Error()))
+			claudeBatchApiError(c, http.StatusBadGateway, "api_error", "Failed to settle message batch, please retry later")
+			return
+		}
+		resp, err := doNativeClaudeBatchRequest(c, batch, http.MethodGet, "/results", nil)
+		if err != nil {
+			claudeBatchApiError(c, http.StatusBadGateway, "api_error", err.Error())
+			return
+		}
+		defer resp.Body.Close()
+		c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+		return
+	}
+	if !batch.IsFinished() {
+		claudeBatchApiError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Message batch %s is still processing", batch.Id))
+		return
+	}
+
+	inputLines, err := service.LoadBatchInput(batch)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("load input of batch %s failed: %s", batch.Id, err.Error()))
+		claudeBatchApiError(c, http.StatusInternalServerError, "api_error", "Batch requests are no longer available")
+		return
+	}
+	c.Header("Content-Type", claudeBatchResultsMediaType)
+	c.Status(http.StatusOK)
+	writer := bufio.NewWriter(c.Writer)
+	writeLine := func(line dto.ClaudeMessageBatchResultLine) error {
+		data, err := common.Marshal(line)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		return writer.WriteByte('\n')
+	}
+
+	handled := make(map[string]bool, len(inputLines))
+	for _, fileId := range []string{batch.OutputFileId, batch.ErrorFileId} {
+		err := service.ReadBatchResults(batch.UserId, fileId, func(line dto.OpenAIBatchOutputLine) error {
+			handled[line.CustomId] = true
+			return writeLine(convertBatchOutputToClaudeResult(line))
+		})
+		if err != nil {
+			common.LogError(c, fmt.Sprintf("read results of batch %s failed: %s", batch.Id, err.Error()))
+		}
+	}
+	// 未执行的请求按批处理的结束原因补齐结果
+	remainingType := "errored"
+	switch batch.Status {
+	case model.BatchStatusCancelled:
+		remainingType = "canceled"
+	case model.BatchStatusExpired:
+		remainingType = "expired"
+	}
+	for _, inputLine := range inputLines {
+		if handled[inputLine.CustomId] {
+			continue
+		}
+		result := dto.ClaudeMessageBatchResultLine{
+			CustomId: inputLine.CustomId,
+			Result:   dto.ClaudeMessageBatchResult{Type: remainingType},
+		}
+		if remainingType == "errored" {
+			result.Result.Error = newClaudeBatchErrorBody("api_error", "Request was not processed")
+		}
+		if err := writeLine(result); err != nil {
+			break
+		}
+	}
+	_ = writer.Flush()
+}
+
+func convertBatchOutputToClaudeResult(line dto.OpenAIBatchOutputLine) dto.ClaudeMessageBatchResultLine {
+	result := dto.ClaudeMessageBatchResultLine{CustomId: line.CustomId}
+	if line.Response != nil && line.Response.StatusCode == http.StatusOK {
+		result.Result.Type = "succeeded"
+		result.Result.Message = line.Response.Body
+		return result
+	}
+	result.Result.Type = "errored"
+	if line.Response != nil {
+		var body struct {
+			Error *struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := common.Unmarshal(line.Response.Body, &body); err == nil && body.Error != nil {
+			result.Result.Error = newClaudeBatchErrorBody(body.Error.Type, body.Error.Message)
+			return result
+		}
+		result.Result.Error = newClaudeBatchErrorBody("api_error", string(line.Response.Body))
+		return result
+	}
+	message := "Request failed"
+	if line.Error != nil {
+		message = line.Error.Message
+	}
+	result.Result.Error = newClaudeBatchErrorBody("invalid_request_error", message)
+	return result
+}
+
+func newClaudeBatchErrorBody(errorType string, message string) []byte {
+	if errorType == "" {
+		errorType = "api_error"
+	}
+	data, _ := common.Marshal(gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    errorType,
+			"message": message,
+		},
+	})
+	return data
+}
+
+func deleteBatchFile(c *gin.Context, userId int, fileId string) {
+	if fileId == "" {
+		return
+	}
+	file, err := model.GetUserFileById(fileId, userId)
+	if err != nil {
+		return
+	}
+	if err := file.Delete(); err != nil {
+		common.LogError(c, fmt.Sprintf("delete file %s failed: %s", file.Id, err.Error()))
+		return
+	}
+	if err := service.GetFileStorage().Delete(file.StoragePath); err != nil {
+		common.LogError(c, fmt.Sprintf("delete file %s from storage failed: %s", file.Id, err.Error()))
+	}
+}
+
+func getBatchUsingGroup(c *gin.Context) string {
+	group := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
+	if group == "" {
+		group = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	}
+	return group
+}
+
+func checkTokenModelLimit(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	tokenModelLimit, ok := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	return tokenModelLimit[modelName]
+}
+
+// checkClaudeBatchQuota 按每条请求的提示词与 max_tokens 估算批处理的最大消耗（含批处理折扣），
+// 用户或令牌余额不足以支付时拒绝创建；原生转发的批处理在结束后才计费，因此必须在转发前检查
+func checkClaudeBatchQuota(c *gin.Context, batch *model.Batch, items []dto.ClaudeMessageBatchRequestItem) error {
+	originalRequest := c.Request
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), constant.ContextKeyBatchId, batch.Id))
+	defer func() {
+		c.Request = originalRequest
+	}()
+	estimated := 0
+	for i, item := range items {
+		var request dto.ClaudeRequest
+		if err := common.Unmarshal(item.Params, &request); err != nil {
+			return fmt.Errorf("requests.%d.params: %s", i, err.Error())
+		}
+		promptTokens, err := service.CountTokenClaudeRequest(request, request.Model)
+		if err != nil {
+			return fmt.Errorf("requests.%d.params: %s", i, err.Error())
+		}
+		common.SetContextKey(c, constant.ContextKeyOriginalModel, request.Model)
+		relayInfo := relaycommon.GenRelayInfoClaude(c)
+		priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(request.MaxTokens))
+		if err != nil {
+			return err
+		}
+		estimated += priceData.ShouldPreConsumedQuota
+	}
+	userQuota, err := model.GetUserQuota(batch.UserId, false)
+	if err != nil {
+		return err
+	}
+	available := userQuota + common.GetContextKeyInt(c, constant.ContextKeyUserCredit)
+	if available < estimated {
+		return fmt.Errorf("user quota is not enough for this batch, quota: %s, estimated: %s", common.FormatQuota(userQuota), common.FormatQuota(estimated))
+	}
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited) && c.GetInt("token_quota") < estimated {
+		return fmt.Errorf("token quota is not enough for this batch, quota: %s, estimated: %s", common.FormatQuota(c.GetInt("token_quota")), common.FormatQuota(estimated))
+	}
+	return nil
+}
+
+// createNativeClaudeBatch 将批处理原样转发到 Anthropic 渠道，计费在批处理结束后根据结果中的 usage 进行；
+// 渠道与密钥已由 SetupContextForSelectedChannel 选定，创建结果计入熔断统计
+func createNativeClaudeBatch(c *gin.Context, batch *model.Batch, channel *model.Channel, request dto.ClaudeMessageBatchRequest) {
+	batch.ChannelId = channel.Id
+	if channel.ChannelInfo.IsMultiKey {
+		batch.ChannelKeyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	var upstreamErr *types.NewAPIError
+	defer func() {
+		service.RecordChannelBreakerResult(c, channel.Id, upstreamErr)
+	}()
+
+	// 应用渠道的模型重定向
+	modelMapping := make(map[string]string)
+	if mappingStr := channel.GetModelMapping(); mappingStr != "" && mappingStr != "{}" {
+		_ = common.UnmarshalJsonStr(mappingStr, &modelMapping)
+	}
+	if len(modelMapping) > 0 {
+		for i := range request.Requests {
+			var params map[string]any
+			if err := common.Unmarshal(request.Requests[i].Params, &params); err != nil {
+				continue
+			}
+			if mapped, ok := modelMapping[common.Interface2String(params["model"])]; ok && mapped != "" {
+				params["model"] = mapped
+				request.Requests[i].Params, _ = common.Marshal(params)
+			}
+		}
+	}
+	body, err := common.Marshal(request)
+	if err != nil {
+		claudeBatchApiError(c, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+	resp, err := doNativeClaudeBatchRequest(c, batch, http.MethodPost, "", bytes.NewReader(body))
+	if err != nil {
+		upstreamErr = types.NewError(err, types.ErrorCodeDoRequestFailed)
+		common.LogError(c, fmt.Sprintf("create upstream batch on channel #%d failed: %s", channel.Id, err.Error()))
+		claudeBatchApiError(c, http.StatusBadGateway, "api_error", "Failed to create message batch upstream")
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		upstreamErr = types.NewError(err, types.ErrorCodeReadResponseBodyFailed)
+		claudeBatchApiError(c, http.StatusBadGateway, "api_error", err.Error())
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		upstreamErr = types.WithClaudeError(types.ClaudeError{Type: "api_error", Message: string(respBody)}, resp.StatusCode)
+		c.Data(resp.StatusCode, "application/json", respBody)
+		return
+	}
+	var upstreamBatch dto.ClaudeMessageBatch
+	if err := common.Unmarshal(respBody, &upstreamBatch); err != nil || upstreamBatch.Id == "" {
+		claudeBatchApiError(c, http.StatusBadGateway, "api_error", "Invalid upstream message batch response")
+		return
+	}
+	batch.UpstreamBatchId = upstreamBatch.Id
+	syncNativeClaudeBatch(batch, &upstreamBatch)
+	if err := batch.Insert(); err != nil {
+		claudeBatchApiError(c, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+	common.LogInfo(c, fmt.Sprintf("message batch %s forwarded to channel #%d as %s", batch.Id, channel.Id, upstreamBatch.Id))
+	c.JSON(http.StatusOK, rewriteNativeClaudeBatch(batch, upstreamBatch))
+}
+
+// relayNativeClaudeBatch 查询或取消上游批处理，并同步本地状态
+func relayNativeClaudeBatch(c *gin.Context, batch *model.Batch, method string, suffix string) {
+	resp, err := doNativeClaudeBatchRequest(c, batch, method, suffix, nil)
+	if err != nil {
+		claudeBatchApiError(c, http.StatusBadGateway, "api_error", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		claudeBatchApiError(c, http.StatusBadGateway, "api_error", err.Error())
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.Data(resp.StatusCode, "application/json", respBody)
+		return
+	}
+	var upstreamBatch dto.ClaudeMessageBatch
+	if err := common.Unmarshal(respBody, &upstreamBatch); err != nil {
+		claudeBatchApiError(c, http.StatusBadGateway, "api_error", "Invalid upstream message batch response")
+		return
+	}
+	syncNativeClaudeBatch(batch, &upstreamBatch)
+	if err := batch.Update(); err != nil {
+		common.LogError(c, fmt.Sprintf("update batch %s failed: %s", batch.Id, err.Error()))
+	}
+	if batch.IsFinished() && batch.BilledAt == 0 {
+		gopool.Go(func() {
+			if err := ensureNativeClaudeBatchBilled(batch); err != nil {
+				common.SysError(fmt.Sprintf("bill batch %s failed: %s", batch.Id, err.Error()))
+			}
+		})
+	}
+	c.JSON(http.StatusOK, rewriteNativeClaudeBatch(batch, upstreamBatch))
+}
+
+// refreshNativeClaudeBatch 从上游查询批处理并同步本地状态
+func refreshNativeClaudeBatch(c *gin.Context, batch *model.Batch) error {
+	resp, err := doNativeClaudeBatchRequest(c, batch, http.MethodGet, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var upstreamBatch dto.ClaudeMessageBatch
+	if err := common.Unmarshal(respBody, &upstreamBatch); err != nil {
+		return err
+	}
+	syncNativeClaudeBatch(batch, &upstreamBatch)
+	return batch.Update()
+}
+
+func syncNativeClaudeBatch(batch *model.Batch, upstreamBatch *dto.ClaudeMessageBatch) {
+	counts := upstreamBatch.RequestCounts
+	batch.CompletedCount = counts.Succeeded
+	batch.FailedCount = counts.Errored + counts.Canceled + counts.Expired
+	now := common.GetTimestamp()
+	switch upstreamBatch.ProcessingStatus {
+	case "in_progress":
+		batch.Status = model.BatchStatusInProgress
+		if batch.InProgressAt == 0 {
+			batch.InProgressAt = now
+		}
+	case "canceling":
+		batch.Status = model.BatchStatusCancelling
+		if batch.CancellingAt == 0 {
+			batch.CancellingAt = now
+		}
+	case "ended":
+		if batch.IsFinished() {
+			return
+		}
+		switch {
+		case batch.CancellingAt != 0 || counts.Canceled > 0:
+			batch.Status = model.BatchStatusCancelled
+			batch.CancelledAt = now
+		case counts.Expired > 0:
+			batch.Status = model.BatchStatusExpired
+			batch.ExpiredAt = now
+		default:
+			batch.Status = model.BatchStatusCompleted
+			batch.CompletedAt = now
+		}
+	}
+}
+
+func rewriteNativeClaudeBatch(batch *model.Batch, upstreamBatch dto.ClaudeMessageBatch) dto.ClaudeMessageBatch {
+	upstreamBatch.Id = batch.Id
+	if upstreamBatch.ResultsUrl != nil {
+		resultsUrl := claudeBatchResultsUrl(batch.Id)
+		upstreamBatch.ResultsUrl = &resultsUrl
+	}
+	return upstreamBatch
+}
+
+func doNativeClaudeBatchRequest(c *gin.Context, batch *model.Batch, method string, suffix string, body io.Reader) (*http.Response, error) {
+	channel, err := model.GetChannelById(batch.ChannelId, true)
+	if err != nil {
+		return nil, fmt.Errorf("channel #%d is not available", batch.ChannelId)
+	}
+	key, err := channel.GetKeyByIndex(batch.ChannelKeyIndex)
+	if err != nil {
+		return nil, err
+	}
+	baseUrl := channel.GetBaseURL()
+	if baseUrl == "" {
+		baseUrl = constant.ChannelBaseURLs[channel.Type]
+	}
+	url := strings.TrimSuffix(baseUrl, "/") + "/v1/messages/batches"
+	if batch.UpstreamBatchId != "" {
+		url += "/" + batch.UpstreamBatchId
+	}
+	url += suffix
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", key)
+	anthropicVersion := defaultAnthropicVersion
+	if c != nil {
+		if version := c.Request.Header.Get("anthropic-version"); version != "" {
+			anthropicVersion = version
+		}
+		if beta := c.Request.Header.Get("anthropic-beta"); beta != "" {
+			req.Header.Set("anthropic-beta", beta)
+		}
+	}
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	client := service.GetHttpClient()
+	if proxy := channel.GetSetting().Proxy; proxy != "" {
+		client, err = service.NewProxyHttpClient(proxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client.Do(req)
+}
+
+// SyncNativeClaudeBatches 定期同步转发到上游的批处理状态，结束后计费，不依赖客户端查询结果
+func SyncNativeClaudeBatches() {
+	for {
+		time.Sleep(time.Minute)
+		batches, err := model.GetUnbilledNativeBatches(common.GetTimestamp()-claudeBatchResultsRetention, 100)
+		if err != nil {
+			common.SysError("failed to list unbilled message batches: " + err.Error())
+			continue
+		}
+		for _, batch := range batches {
+			if !batch.IsFinished() {
+				if err := refreshNativeClaudeBatch(nil, batch); err != nil {
+					common.SysError(fmt.Sprintf("refresh batch %s failed: %s", batch.Id, err.Error()))
+					continue
+				}
+			}
+			if err := ensureNativeClaudeBatchBilled(batch); err != nil {
+				common.SysError(fmt.Sprintf("bill batch %s failed: %s", batch.Id, err.Error()))
+			}
+		}
+	}
+}
+
+// ensureNativeClaudeBatchBilled 下载上游结果并按每条请求的 usage 计费，每个批处理只计费一次
+func ensureNativeClaudeBatchBilled(batch *model.Batch) error {
+	if !batch.IsFinished() {
+		return nil
+	}
+	ok, err := batch.MarkBilled()
+	if err != nil || !ok {
+		return err
+	}
+	resetBilled := func() {
+		_ = model.DB.Model(&model.Batch{}).Where("id = ?", batch.Id).Update("billed_at", 0).Error
+		batch.BilledAt = 0
+	}
+
+	// 先完整下载结果，避免下载中断导致部分重复计费
+	resp, err := doNativeClaudeBatchRequest(nil, batch, http.MethodGet, "/results", nil)
+	if err != nil {
+		resetBilled()
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		resetBilled()
+		return fmt.Errorf("fetch results status code %d", resp.StatusCode)
+	}
+	tmp, err := os.CreateTemp("", "msgbatch-*.jsonl")
+	if err != nil {
+		resetBilled()
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		resetBilled()
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		resetBilled()
+		return err
+	}
+
+	inputLines, err := service.LoadBatchInput(batch)
+	if err != nil {
+		resetBilled()
+		return err
+	}
+	requestModels := make(map[string]string, len(inputLines))
+	for _, line := range inputLines {
+		var params struct {
+			Model string `json:"model"`
+		}
+		_ = common.Unmarshal(line.Body, &params)
+		requestModels[line.CustomId] = params.Model
+	}
+
+	c, err := newClaudeBatchBillingContext(batch)
+	if err != nil {
+		resetBilled()
+		return err
+	}
+	channel, err := model.GetChannelById(batch.ChannelId, false)
+	if err != nil {
+		resetBilled()
+		return err
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelId, channel.Id)
+	common.SetContextKey(c, constant.ContextKeyChannelType, channel.Type)
+	common.SetContextKey(c, constant.ContextKeyChannelName, channel.Name)
+	c.Set("use_channel", []string{fmt.Sprintf("%d", channel.Id)})
+	userQuota := common.GetContextKeyInt(c, constant.ContextKeyUserQuota)
+
+	bufReader := bufio.NewReader(tmp)
+	for {
+		data, readErr := bufReader.ReadBytes('\n')
+		data = bytes.TrimSpace(data)
+		if len(data) > 0 {
+			billNativeClaudeBatchLine(c, data, requestModels, userQuota)
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func billNativeClaudeBatchLine(c *gin.Context, data []byte, requestModels map[string]string, userQuota int) {
+	var line struct {
+		CustomId string `json:"custom_id"`
+		Result   struct {
+			Type    string              `json:"type"`
+			Message *dto.ClaudeResponse `json:"message"`
+		} `json:"result"`
+	}
+	if err := common.Unmarshal(data, &line); err != nil {
+		return
+	}
+	if line.Result.Type != "succeeded" || line.Result.Message == nil || line.Result.Message.Usage == nil {
+		return
+	}
+	modelName := requestModels[line.CustomId]
+	if modelName == "" {
+		modelName = line.Result.Message.Model
+	}
+	claudeUsage := line.Result.Message.Usage
+	usage := &dto.Usage{
+		PromptTokens:     claudeUsage.InputTokens,
+		CompletionTokens: claudeUsage.OutputTokens,
+		TotalTokens:      claudeUsage.InputTokens + claudeUsage.OutputTokens,
+	}
+	usage.PromptTokensDetails.CachedTokens = claudeUsage.CacheReadInputTokens
+	usage.PromptTokensDetails.CachedCreationTokens = claudeUsage.CacheCreationInputTokens
+
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, modelName)
+	common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
+	relayInfo := relaycommon.GenRelayInfoClaude(c)
+	if line.Result.Message.Model != "" && line.Result.Message.Model != modelName {
+		relayInfo.IsModelMapped = true
+		relayInfo.UpstreamModelName = line.Result.Message.Model
+	}
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, usage.PromptTokens, 0)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("price of model %s is not configured, batch request %s is not billed", modelName, line.CustomId))
+		return
+	}
+	service.PostClaudeConsumeQuota(c, relayInfo, usage, 0, userQuota, priceData, "")
+}
+
+// newClaudeBatchBillingContext 构造计费所需的上下文，与令牌鉴权后的请求上下文一致
+func newClaudeBatchBillingContext(batch *model.Batch) (*gin.Context, error) {
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		return nil, err
+	}
+	userCache, err := model.GetUserCache(batch.UserId)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx := context.WithValue(context.Background(), constant.ContextKeyBatchId, batch.Id)
+	c.Request = httptest.NewRequest(http.MethodPost, claudeBatchEndpoint, nil).WithContext(ctx)
+	userCache.WriteContext(c)
+	if err := middleware.SetupContextForToken(c, token); err != nil {
+		return nil, err
+	}
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, batch.Group)
+	return c, nil
+}
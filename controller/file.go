@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var supportedFilePurposes = map[string]bool{
+	"assistants": true,
+	"batch":      true,
+	"fine-tune":  true,
+	"vision":     true,
+	"user_data":  true,
+	"evals":      true,
+}
+
+func fileApiError(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func getUserFile(c *gin.Context) *model.File {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "query_data_error", err.Error())
+		}
+		return nil
+	}
+	return file
+}
+
+func UploadFile(c *gin.Context) {
+	fileSetting := operation_setting.GetFileSetting()
+	if !fileSetting.Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	maxBytes := int64(fileSetting.MaxFileSizeMB) << 20
+	// multipart 额外开销留 1MB 余量
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+(1<<20))
+	if _, err := c.MultipartForm(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			fileApiError(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("File exceeds the maximum size of %d MB", fileSetting.MaxFileSizeMB))
+			return
+		}
+		fileApiError(c, http.StatusBadRequest, "invalid_file", "Failed to read uploaded file: "+err.Error())
+		return
+	}
+
+	purpose := c.PostForm("purpose")
+	if !supportedFilePurposes[purpose] {
+		fileApiError(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("Invalid purpose: %s", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_file", "Failed to read uploaded file: "+err.Error())
+		return
+	}
+	if header.Size > maxBytes {
+		fileApiError(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("File exceeds the maximum size of %d MB", fileSetting.MaxFileSizeMB))
+		return
+	}
+
+	userId := c.GetInt("id")
+	if fileSetting.UserStorageLimitMB > 0 {
+		usedBytes, err := model.SumUserFileBytes(userId)
+		if err != nil {
+			fileApiError(c, http.StatusInternalServerError, "query_data_error", err.Error())
+			return
+		}
+		if usedBytes+header.Size > int64(fileSetting.UserStorageLimitMB)<<20 {
+			fileApiError(c, http.StatusForbidden, "storage_quota_exceeded", fmt.Sprintf("File storage quota of %d MB exceeded", fileSetting.UserStorageLimitMB))
+			return
+		}
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer src.Close()
+
+	fileId := "file-" + common.GetRandomString(24)
+	storage := service.GetFileStorage()
+	storagePath, written, err := storage.Save(fileId, src)
+	if err != nil {
+		common.LogError(c, "save file failed: "+err.Error())
+		fileApiError(c, http.StatusInternalServerError, "file_save_failed", "Failed to save file")
+		return
+	}
+
+	mimeType := header.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = service.GetMimeTypeByExtension(strings.TrimPrefix(filepath.Ext(header.Filename), "."))
+	}
+	now := common.GetTimestamp()
+	file := &model.File{
+		Id:          fileId,
+		UserId:      userId,
+		TokenId:     c.GetInt("token_id"),
+		Filename:    filepath.Base(header.Filename),
+		Purpose:     purpose,
+		Bytes:       written,
+		MimeType:    mimeType,
+		StoragePath: storagePath,
+		Status:      model.FileStatusProcessed,
+		CreatedAt:   now,
+	}
+	if fileSetting.RetentionDays > 0 {
+		file.ExpiresAt = now + int64(fileSetting.RetentionDays)*24*3600
+	}
+	if err := file.Insert(); err != nil {
+		_ = storage.Delete(storagePath)
+		fileApiError(c, http.StatusInternalServerError, "update_data_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	// 多查一条用于判断 has_more
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		fileApiError(c, http.StatusInternalServerError, "query_data_error", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	list := dto.OpenAIFileList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIFile, 0, len(files)),
+		HasMore: hasMore,
+	}
+	for _, file := range files {
+		list.Data = append(list.Data, file.ToOpenAIFile())
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = list.Data[0].Id
+		list.LastId = list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.GetFileStorage().Open(file.StoragePath)
+	if err != nil {
+		common.LogError(c, "open file failed: "+err.Error())
+		fileApiError(c, http.StatusNotFound, "file_not_found", "File content is not available")
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, file.Bytes, file.MimeType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Filename),
+	})
+}
+
+func DeleteFile(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	if err := file.Delete(); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "update_data_error", err.Error())
+		return
+	}
+	if err := service.GetFileStorage().Delete(file.StoragePath); err != nil {
+		common.LogError(c, fmt.Sprintf("delete file %s from storage failed: %s", file.Id, err.Error()))
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleteResponse{
+		Id:      file.Id,
+		Object:  "file",
+		Deleted: true,
+	})
+}
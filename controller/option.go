@@ -121,6 +121,15 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "batch_ratio_setting.discount_ratio":
+		err = ratio_setting.CheckBatchDiscountRatio(option.Value)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "console_setting.api_info":
 		err = console_setting.ValidateConsoleSettings(option.Value, "ApiInfo")
 		if err != nil {
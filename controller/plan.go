@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPlans 用户可订阅的套餐
+func GetPlans(c *gin.Context) {
+	plans, err := model.GetAllPlans(true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func GetAllPlans(c *gin.Context) {
+	plans, err := model.GetAllPlans(false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func AddPlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.Id = 0
+	if err = plan.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err = plan.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plan)
+}
+
+func UpdatePlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err = model.GetPlanById(plan.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = plan.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err = plan.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plan)
+}
+
+func DeletePlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeletePlanById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetSelfSubscriptions 当前用户的订阅记录，最新的在前
+func GetSelfSubscriptions(c *gin.Context) {
+	subscriptions, err := model.GetUserSubscriptions(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscriptions)
+}
+
+// GetUserSubscriptions 管理员查看指定用户的订阅记录
+func GetUserSubscriptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subscriptions, err := model.GetUserSubscriptions(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscriptions)
+}
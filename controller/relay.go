@@ -27,7 +27,7 @@ import (
 func relayHandler(c *gin.Context, relayMode int) *types.NewAPIError {
 	var err *types.NewAPIError
 	switch relayMode {
-	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits:
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		err = relay.ImageHelper(c)
 	case relayconstant.RelayModeAudioSpeech:
 		fallthrough
@@ -43,11 +43,13 @@ func relayHandler(c *gin.Context, relayMode int) *types.NewAPIError {
 		err = relay.ResponsesHelper(c)
 	case relayconstant.RelayModeGemini:
 		err = relay.GeminiHelper(c)
+	case relayconstant.RelayModeGeminiCountTokens:
+		err = relay.GeminiCountTokensHelper(c)
 	default:
 		err = relay.TextHelper(c)
 	}
 
-	if constant2.ErrorLogEnabled && err != nil {
+	if constant2.ErrorLogEnabled && err != nil && !helper.IsStreamHedgeLoser(c) {
 		// 保存错误日志到mysql中
 		userId := c.GetInt("id")
 		tokenName := c.GetString("token_name")
@@ -76,33 +78,61 @@ func Relay(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var newAPIError *types.NewAPIError
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
+	fallback := newModelFallback(c, originalModel)
+
+	// attempt 为当前模型的尝试次数，改用后备模型后重新计算
+	for attempt := 0; attempt <= common.RetryTimes; attempt++ {
+		retryCount := attempt
+		if fallback.switched() {
+			// 后备模型没有预选的渠道，首次尝试也重新选择
+			retryCount++
+		}
+		channel, err := getChannel(c, group, originalModel, retryCount)
 		if err != nil {
 			common.LogError(c, err.Error())
-			newAPIError = err
+			// 没有其它可用渠道时返回上一个渠道的错误
+			if newAPIError == nil {
+				newAPIError = err
+			}
+			// 当前模型没有其它可用渠道时改用后备模型
+			if modelName, ok := fallback.next(c, newAPIError); ok {
+				originalModel = modelName
+				attempt = -1
+				continue
+			}
 			break
 		}
 
-		newAPIError = relayRequest(c, relayMode, channel)
+		if delay := hedgeDelay(c, group, retryCount); delay > 0 {
+			newAPIError = relayWithHedge(c, group, originalModel, channel, delay, func(c *gin.Context, channel *model.Channel) *types.NewAPIError {
+				return relayRequest(c, relayMode, channel)
+			})
+		} else {
+			newAPIError = service.TrackChannelRequest(c, channel.Id, func() *types.NewAPIError {
+				return relayRequest(c, relayMode, channel)
+			})
+			if newAPIError != nil {
+				go processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+			}
+		}
 
 		if newAPIError == nil {
 			return // 成功处理请求，直接返回
 		}
 
-		go processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
-
-		if !shouldRetry(c, newAPIError, common.RetryTimes-i) {
+		if !shouldRetry(c, newAPIError, common.RetryTimes-attempt) {
+			if modelName, ok := fallback.next(c, newAPIError); ok {
+				originalModel = modelName
+				attempt = -1
+				continue
+			}
 			break
 		}
 	}
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		common.LogInfo(c, retryLogStr)
-	}
+	logRetryChannels(c)
 
 	if newAPIError != nil {
+		fallback.restore(c)
 		//if newAPIError.StatusCode == http.StatusTooManyRequests {
 		//	common.LogError(c, fmt.Sprintf("origin 429 error: %s", newAPIError.Error()))
 		//	newAPIError.SetMessage("当前分组上游负载已饱和，请稍后再试")
@@ -143,11 +173,16 @@ func WssRelay(c *gin.Context) {
 		channel, err := getChannel(c, group, originalModel, i)
 		if err != nil {
 			common.LogError(c, err.Error())
-			newAPIError = err
+			// 没有其它可用渠道时返回上一个渠道的错误
+			if newAPIError == nil {
+				newAPIError = err
+			}
 			break
 		}
 
-		newAPIError = wssRequest(c, ws, relayMode, channel)
+		newAPIError = service.TrackChannelRequest(c, channel.Id, func() *types.NewAPIError {
+			return wssRequest(c, ws, relayMode, channel)
+		})
 
 		if newAPIError == nil {
 			return // 成功处理请求，直接返回
@@ -181,33 +216,59 @@ func RelayClaude(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var newAPIError *types.NewAPIError
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
+	fallback := newModelFallback(c, originalModel)
+
+	// attempt 为当前模型的尝试次数，改用后备模型后重新计算
+	for attempt := 0; attempt <= common.RetryTimes; attempt++ {
+		retryCount := attempt
+		if fallback.switched() {
+			// 后备模型没有预选的渠道，首次尝试也重新选择
+			retryCount++
+		}
+		channel, err := getChannel(c, group, originalModel, retryCount)
 		if err != nil {
 			common.LogError(c, err.Error())
-			newAPIError = err
+			// 没有其它可用渠道时返回上一个渠道的错误
+			if newAPIError == nil {
+				newAPIError = err
+			}
+			// 当前模型没有其它可用渠道时改用后备模型
+			if modelName, ok := fallback.next(c, newAPIError); ok {
+				originalModel = modelName
+				attempt = -1
+				continue
+			}
 			break
 		}
 
-		newAPIError = claudeRequest(c, channel)
+		if delay := hedgeDelay(c, group, retryCount); delay > 0 {
+			newAPIError = relayWithHedge(c, group, originalModel, channel, delay, claudeRequest)
+		} else {
+			newAPIError = service.TrackChannelRequest(c, channel.Id, func() *types.NewAPIError {
+				return claudeRequest(c, channel)
+			})
+			if newAPIError != nil {
+				go processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+			}
+		}
 
 		if newAPIError == nil {
 			return // 成功处理请求，直接返回
 		}
 
-		go processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
-
-		if !shouldRetry(c, newAPIError, common.RetryTimes-i) {
+		if !shouldRetry(c, newAPIError, common.RetryTimes-attempt) {
+			if modelName, ok := fallback.next(c, newAPIError); ok {
+				originalModel = modelName
+				attempt = -1
+				continue
+			}
 			break
 		}
 	}
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		common.LogInfo(c, retryLogStr)
-	}
+	logRetryChannels(c)
 
 	if newAPIError != nil {
+		fallback.restore(c)
 		newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
 		c.JSON(newAPIError.StatusCode, gin.H{
 			"type":  "error",
@@ -217,32 +278,29 @@ func RelayClaude(c *gin.Context) {
 }
 
 func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *types.NewAPIError {
-	addUsedChannel(c, channel.Id)
+	model.AddTriedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 	return relayHandler(c, relayMode)
 }
 
 func wssRequest(c *gin.Context, ws *websocket.Conn, relayMode int, channel *model.Channel) *types.NewAPIError {
-	addUsedChannel(c, channel.Id)
+	model.AddTriedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 	return relay.WssHelper(c, ws)
 }
 
 func claudeRequest(c *gin.Context, channel *model.Channel) *types.NewAPIError {
-	addUsedChannel(c, channel.Id)
+	model.AddTriedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	if relayconstant.Path2RelayMode(c.Request.URL.Path) == relayconstant.RelayModeClaudeCountTokens {
+		return relay.ClaudeCountTokensHelper(c)
+	}
 	return relay.ClaudeHelper(c)
 }
 
-func addUsedChannel(c *gin.Context, channelId int) {
-	useChannel := c.GetStringSlice("use_channel")
-	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
-	c.Set("use_channel", useChannel)
-}
-
 func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*model.Channel, *types.NewAPIError) {
 	if retryCount == 0 {
 		autoBan := c.GetBool("auto_ban")
@@ -257,7 +315,7 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, selectGroup, err := model.CacheGetRandomSatisfiedChannel(c, group, originalModel, retryCount)
+	channel, selectGroup, err := model.CacheGetRandomSatisfiedChannel(c, group, originalModel)
 	if err != nil {
 		if group == "auto" {
 			return nil, types.NewError(errors.New(fmt.Sprintf("获取自动分组下模型 %s 的可用渠道失败: %s", originalModel, err.Error())), types.ErrorCodeGetChannelFailed)
@@ -271,6 +329,15 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 	return channel, nil
 }
 
+// logRetryChannels 记录本次请求依次尝试的渠道
+func logRetryChannels(c *gin.Context) {
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		common.LogInfo(c, retryLogStr)
+	}
+}
+
 func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -321,6 +388,10 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
+	if relayconstant.IsCountTokensMode(relayconstant.Path2RelayMode(c.Request.URL.Path)) {
+		// 渠道不支持 count_tokens 不代表渠道不可用，不参与自动禁用
+		return
+	}
 	if service.ShouldDisableChannel(channelError.ChannelId, err) && channelError.AutoBan {
 		service.DisableChannel(channelError, err.Error())
 	}
@@ -389,28 +460,29 @@ func RelayTask(c *gin.Context) {
 	relayMode := c.GetInt("relay_mode")
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
-	c.Set("use_channel", []string{fmt.Sprintf("%d", channelId)})
+	model.AddTriedChannel(c, channelId)
 	taskErr := taskRelayHandler(c, relayMode)
+	recordTaskChannelCooldown(c, channelId, taskErr)
 	if taskErr == nil {
 		retryTimes = 0
 	}
 	for i := 0; shouldRetryTaskRelay(c, channelId, taskErr, retryTimes) && i < retryTimes; i++ {
-		channel, newAPIError := getChannel(c, group, originalModel, i)
+		// 首个渠道已在 Distribute 中选定并使用，重试从下一个渠道开始
+		channel, newAPIError := getChannel(c, group, originalModel, i+1)
 		if newAPIError != nil {
+			// 没有其它可用渠道时返回上一个渠道的错误
 			common.LogError(c, fmt.Sprintf("CacheGetRandomSatisfiedChannel failed: %s", newAPIError.Error()))
-			taskErr = service.TaskErrorWrapperLocal(newAPIError.Err, "get_channel_failed", http.StatusInternalServerError)
 			break
 		}
 		channelId = channel.Id
-		useChannel := c.GetStringSlice("use_channel")
-		useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
-		c.Set("use_channel", useChannel)
+		model.AddTriedChannel(c, channelId)
 		common.LogInfo(c, fmt.Sprintf("using channel #%d to retry (remain times %d)", channel.Id, i))
 		//middleware.SetupContextForSelectedChannel(c, channel, originalModel)
 
 		requestBody, _ := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 		taskErr = taskRelayHandler(c, relayMode)
+		recordTaskChannelCooldown(c, channelId, taskErr)
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
@@ -425,6 +497,14 @@ func RelayTask(c *gin.Context) {
 	}
 }
 
+// recordTaskChannelCooldown 任务接口不解析 Retry-After，上游限流时按默认时长冷却
+func recordTaskChannelCooldown(c *gin.Context, channelId int, taskErr *dto.TaskError) {
+	if taskErr == nil || taskErr.LocalError || taskErr.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	service.RecordChannelCooldown(c, channelId, types.NewErrorWithStatusCode(errors.New(taskErr.Message), types.ErrorCodeBadResponseStatusCode, taskErr.StatusCode))
+}
+
 func taskRelayHandler(c *gin.Context, relayMode int) *dto.TaskError {
 	var err *dto.TaskError
 	switch relayMode {
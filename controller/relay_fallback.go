@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/setting/model_setting"
+	"one-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 实际提供服务的模型，改用后备模型时与请求的模型不同
+const servedModelHeader = "X-Oneapi-Served-Model"
+
+// modelFallback 请求模型的所有渠道都以可重试的错误失败后，依次改用后备链中的模型
+type modelFallback struct {
+	requested string
+	current   string
+	models    []string
+}
+
+func newModelFallback(c *gin.Context, originalModel string) *modelFallback {
+	c.Header(servedModelHeader, originalModel)
+	fallback := &modelFallback{requested: originalModel, current: originalModel}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return fallback
+	}
+	visited := map[string]bool{originalModel: true}
+	for _, modelName := range model_setting.GetModelFallbackChain(originalModel) {
+		if modelName == "" || visited[modelName] || !tokenModelAllowed(c, modelName) {
+			continue
+		}
+		visited[modelName] = true
+		fallback.models = append(fallback.models, modelName)
+	}
+	return fallback
+}
+
+// tokenModelAllowed 后备模型同样受令牌的模型限制
+func tokenModelAllowed(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	tokenModelLimit, ok := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	_, ok = tokenModelLimit[modelName]
+	return ok
+}
+
+// switched 当前使用的是后备模型，后备模型没有中间件预选的渠道
+func (f *modelFallback) switched() bool {
+	return f.current != f.requested
+}
+
+// next 上一个错误可以重试时切换到后备链中的下一个模型，后续选择渠道、计费与日志都使用新的模型；
+// 已尝试的渠道只对原模型有效，切换后重新记录
+func (f *modelFallback) next(c *gin.Context, err *types.NewAPIError) (string, bool) {
+	if len(f.models) == 0 || err == nil || !shouldRetry(c, err, 1) {
+		return "", false
+	}
+	modelName := f.models[0]
+	f.models = f.models[1:]
+	common.LogInfo(c, fmt.Sprintf("no channel for model %s succeeded, falling back to model %s", f.current, modelName))
+	logRetryChannels(c)
+	c.Set("use_channel", nil)
+	c.Set("use_channel_key", nil)
+	if _, ok := c.Get(string(constant.ContextKeyRequestedModel)); !ok {
+		common.SetContextKey(c, constant.ContextKeyRequestedModel, f.requested)
+	}
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, modelName)
+	// 响应头在后备模型开始输出前写出，所有后备模型都失败时由 restore 改回请求的模型
+	c.Header(servedModelHeader, modelName)
+	f.current = modelName
+	return modelName, true
+}
+
+// restore 所有后备模型都失败时，错误响应与日志仍使用客户端请求的模型
+func (f *modelFallback) restore(c *gin.Context) {
+	if !f.switched() {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, f.requested)
+	c.Header(servedModelHeader, f.requested)
+	f.current = f.requested
+}
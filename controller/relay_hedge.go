@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/middleware"
+	"one-api/model"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"one-api/types"
+	"strings"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeDelay 返回本次请求的对冲延迟，只对首次尝试的流式对话请求生效，返回 0 表示不对冲
+func hedgeDelay(c *gin.Context, group string, retryCount int) time.Duration {
+	if retryCount != 0 {
+		return 0
+	}
+	delay := operation_setting.GetGroupHedgeDelay(group)
+	if delay <= 0 {
+		return 0
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return 0
+	}
+	switch relayconstant.Path2RelayMode(c.Request.URL.Path) {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeResponses:
+	case relayconstant.RelayModeGemini:
+		if strings.Contains(c.Request.URL.Path, "streamGenerateContent") {
+			return delay
+		}
+		return 0
+	default:
+		// Claude Messages 没有对应的 RelayMode
+		if c.Request.URL.Path != "/v1/messages" {
+			return 0
+		}
+	}
+	var request struct {
+		Stream bool `json:"stream"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil || !request.Stream {
+		return 0
+	}
+	return delay
+}
+
+type hedgeAttempt struct {
+	c       *gin.Context
+	channel *model.Channel
+	cancel  context.CancelFunc
+	err     *types.NewAPIError
+	done    chan struct{}
+}
+
+func startHedgeAttempt(c *gin.Context, hedge *helper.StreamHedge, channel *model.Channel, relay func(c *gin.Context, channel *model.Channel) *types.NewAPIError) *hedgeAttempt {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	hedge.Attach(c)
+	attempt := &hedgeAttempt{
+		c:       c,
+		channel: channel,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	gopool.Go(func() {
+		defer close(attempt.done)
+		defer func() {
+			if r := recover(); r != nil {
+				common.LogError(c, fmt.Sprintf("hedged attempt panic: %v", r))
+				attempt.err = types.NewError(fmt.Errorf("hedged attempt panic: %v", r), types.ErrorCodeBadResponse)
+			}
+		}()
+		attempt.err = service.TrackChannelRequest(c, channel.Id, func() *types.NewAPIError {
+			return relay(c, channel)
+		})
+	})
+	return attempt
+}
+
+// relayWithHedge 主渠道在 delay 内没有输出首个内容时，向另一个渠道发送相同的请求，
+// 先输出内容的一方转发给客户端，另一方被取消且不向用户计费；各渠道的错误在这里处理
+func relayWithHedge(c *gin.Context, group, originalModel string, channel *model.Channel, delay time.Duration, relay func(c *gin.Context, channel *model.Channel) *types.NewAPIError) *types.NewAPIError {
+	request, writer := c.Request, c.Writer
+	defer func() {
+		c.Request = request
+		c.Writer = writer
+	}()
+
+	// 备用尝试的上下文在主渠道开始前复制，避免与主渠道并发读写
+	backup := c.Copy()
+	backup.Writer = writer
+	model.AddTriedChannel(backup, channel.Id)
+	// 备用尝试占用自己的并发槽位，不能释放主渠道的槽位
+	common.SetContextKey(backup, constant.ContextKeyChannelInFlightSlot, nil)
+	defer model.ReleaseChannelSlot(backup)
+
+	hedge := helper.NewStreamHedge()
+	primary := startHedgeAttempt(c, hedge, channel, relay)
+	attempts := []*hedgeAttempt{primary}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-primary.done:
+	case <-hedge.Won():
+	case <-timer.C:
+		secondaryChannel, _, err := model.CacheGetRandomSatisfiedChannel(backup, group, originalModel)
+		if err != nil || secondaryChannel == nil {
+			break
+		}
+		if newAPIError := middleware.SetupContextForSelectedChannel(backup, secondaryChannel, originalModel); newAPIError != nil {
+			break
+		}
+		common.LogInfo(c, fmt.Sprintf("channel #%d has no first token after %s, hedging to channel #%d", channel.Id, delay, secondaryChannel.Id))
+		attempts = append(attempts, startHedgeAttempt(backup, hedge, secondaryChannel, relay))
+	}
+
+	allDone := make(chan struct{})
+	gopool.Go(func() {
+		for _, attempt := range attempts {
+			<-attempt.done
+		}
+		close(allDone)
+	})
+	select {
+	case <-hedge.Won():
+		// 取消落败的尝试
+		for _, attempt := range attempts {
+			if !hedge.IsWinner(attempt.c) {
+				attempt.cancel()
+			}
+		}
+		<-allDone
+	case <-allDone:
+	}
+
+	result := primary
+	for _, attempt := range attempts {
+		attempt.cancel()
+		if hedge.IsWinner(attempt.c) || (attempt.err == nil && result.err != nil) {
+			result = attempt
+		}
+	}
+	for _, attempt := range attempts {
+		if attempt.err == nil || helper.IsStreamHedgeLoser(attempt.c) {
+			continue
+		}
+		go processChannelError(attempt.c, *types.NewChannelError(attempt.channel.Id, attempt.channel.Type, attempt.channel.Name, attempt.channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(attempt.c, constant.ContextKeyChannelKey), attempt.channel.GetAutoBan()), attempt.err)
+	}
+	if len(attempts) > 1 {
+		// 后续重试需要排除两个渠道
+		c.Set("use_channel", backup.GetStringSlice("use_channel"))
+		c.Set("use_channel_key", backup.GetStringSlice("use_channel_key"))
+	}
+	return result.err
+}
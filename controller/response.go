@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Responses API 会话状态由网关保存，只能读取和删除当前令牌创建的 response
+
+func getTokenStoredResponse(c *gin.Context) *model.StoredResponse {
+	if !operation_setting.GetResponseStoreSetting().Enabled {
+		fileApiError(c, http.StatusNotFound, "not_found", "Response storage is disabled")
+		return nil
+	}
+	response, err := model.GetTokenStoredResponse(c.Param("id"), c.GetInt("token_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileApiError(c, http.StatusNotFound, "not_found", fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		} else {
+			fileApiError(c, http.StatusInternalServerError, "query_data_error", err.Error())
+		}
+		return nil
+	}
+	return response
+}
+
+func RetrieveResponse(c *gin.Context) {
+	response := getTokenStoredResponse(c)
+	if response == nil {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response.Response)
+}
+
+func DeleteResponse(c *gin.Context) {
+	response := getTokenStoredResponse(c)
+	if response == nil {
+		return
+	}
+	if err := response.Delete(); err != nil {
+		fileApiError(c, http.StatusInternalServerError, "update_data_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIResponsesDeleteResponse{
+		Id:      response.Id,
+		Object:  "response",
+		Deleted: true,
+	})
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SettleStatementRequest struct {
+	Period string `json:"period"`
+	// 结算入账的额度，0 为按账单的消费额度结算
+	Quota int `json:"quota"`
+}
+
+func GetSelfStatement(c *gin.Context) {
+	statement, err := model.GetUserStatement(c.GetInt("id"), c.Query("period"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statement,
+	})
+}
+
+// getManagedUser 读取路径中的用户，并检查当前管理员有权管理该用户
+func getManagedUser(c *gin.Context) (*model.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权获取同级或更高等级用户的信息",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+func GetUserStatement(c *gin.Context) {
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	statement, err := model.GetUserStatement(user.Id, c.Query("period"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statement,
+	})
+}
+
+func SettleUserStatement(c *gin.Context) {
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	var req SettleStatementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if req.Quota < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "结算额度不能为负数",
+		})
+		return
+	}
+	statement, err := model.SettleUserStatement(user.Id, req.Period, req.Quota, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statement,
+	})
+}
@@ -17,6 +17,7 @@ func GetAllTokens(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.FillTokenBudgets(tokens)
 	total, _ := model.CountUserTokens(userId)
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(tokens)
@@ -33,6 +34,7 @@ func SearchTokens(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.FillTokenBudgets(tokens)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -53,6 +55,7 @@ func GetToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	token.RefreshBudgetPeriod()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -96,6 +99,10 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if err = token.ValidateTokenBudget(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -118,6 +125,12 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		BudgetPeriod:       token.BudgetPeriod,
+		BudgetResetDay:     token.BudgetResetDay,
+		BudgetResetHour:    token.BudgetResetHour,
+		PeriodQuotaLimit:   token.PeriodQuotaLimit,
+		RpmLimit:           token.RpmLimit,
+		TpmLimit:           token.TpmLimit,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -195,12 +208,23 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.BudgetPeriod = token.BudgetPeriod
+		cleanToken.BudgetResetDay = token.BudgetResetDay
+		cleanToken.BudgetResetHour = token.BudgetResetHour
+		cleanToken.PeriodQuotaLimit = token.PeriodQuotaLimit
+		cleanToken.RpmLimit = token.RpmLimit
+		cleanToken.TpmLimit = token.TpmLimit
+		if err = cleanToken.ValidateTokenBudget(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	cleanToken.RefreshBudgetPeriod()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
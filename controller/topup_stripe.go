@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,6 +17,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/subscription"
 	"github.com/stripe/stripe-go/v81/webhook"
 	"github.com/thanhpk/randstr"
 )
@@ -23,6 +26,9 @@ const (
 	PaymentMethodStripe = "stripe"
 )
 
+// 订阅结账会话的有效期，Stripe 要求不少于 30 分钟
+const stripeSubscriptionCheckoutTTL = 30 * time.Minute
+
 var stripeAdaptor = &StripeAdaptor{}
 
 type StripePayRequest struct {
@@ -146,6 +152,15 @@ func StripeWebhook(c *gin.Context) {
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeInvoicePaid:
+		if err = invoicePaid(event); err != nil {
+			// 返回错误让 Stripe 稍后重试
+			log.Println("处理订阅账单失败:", err.Error())
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+	case stripe.EventTypeCustomerSubscriptionDeleted:
+		subscriptionDeleted(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
@@ -162,6 +177,15 @@ func sessionCompleted(event stripe.Event) {
 		return
 	}
 
+	if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+		// 订阅的额度在 invoice.paid 中发放
+		if err := model.DeleteSubscriptionCheckout(event.GetObjectValue("id")); err != nil {
+			log.Println("移除订阅结账会话失败", event.GetObjectValue("id"), ", err:", err.Error())
+		}
+		log.Println("订阅已创建:", event.GetObjectValue("subscription"))
+		return
+	}
+
 	err := model.Recharge(referenceId, customerId)
 	if err != nil {
 		log.Println(err.Error(), referenceId)
@@ -181,6 +205,13 @@ func sessionExpired(event stripe.Event) {
 		return
 	}
 
+	if event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription) {
+		if err := model.DeleteSubscriptionCheckout(event.GetObjectValue("id")); err != nil {
+			log.Println("移除订阅结账会话失败", event.GetObjectValue("id"), ", err:", err.Error())
+		}
+		return
+	}
+
 	if len(referenceId) == 0 {
 		log.Println("未提供支付单号")
 		return
@@ -206,12 +237,228 @@ func sessionExpired(event stripe.Event) {
 	log.Println("充值订单已过期", referenceId)
 }
 
-func genStripeLink(referenceId string, customerId string, email string, amount int64) (string, error) {
-	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
-		return "", fmt.Errorf("无效的Stripe API密钥")
+func invoicePaid(event stripe.Event) error {
+	var invoice stripe.Invoice
+	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		return err
+	}
+	if invoice.Subscription == nil {
+		// 非订阅账单
+		return nil
+	}
+	renewal := &model.SubscriptionRenewal{
+		StripeSubscriptionId: invoice.Subscription.ID,
+		InvoiceId:            invoice.ID,
+		PeriodEnd:            invoice.PeriodEnd,
+	}
+	if invoice.Customer != nil {
+		renewal.StripeCustomerId = invoice.Customer.ID
+	}
+	// 订阅账单的 period_start/period_end 为上一周期，本次支付的服务周期以账单明细为准
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Period != nil && line.Period.End >= renewal.PeriodEnd {
+				renewal.PeriodStart = line.Period.Start
+				renewal.PeriodEnd = line.Period.End
+			}
+		}
+	}
+	if invoice.SubscriptionDetails != nil {
+		renewal.UserId, _ = strconv.Atoi(invoice.SubscriptionDetails.Metadata["user_id"])
+		renewal.PlanId, _ = strconv.Atoi(invoice.SubscriptionDetails.Metadata["plan_id"])
+	}
+	granted, err := model.RenewSubscription(renewal)
+	if errors.Is(err, model.ErrSubscriptionDuplicate) {
+		// 用户已有生效中的订阅，立即取消新订阅，款项需人工退还
+		if err = setStripeKey(); err != nil {
+			return err
+		}
+		if _, err = subscription.Cancel(renewal.StripeSubscriptionId, nil); err != nil {
+			return err
+		}
+		log.Printf("用户 %d 已有生效中的订阅，已取消重复订阅 %s，账单 %s 需人工退款", renewal.UserId, renewal.StripeSubscriptionId, invoice.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !granted {
+		log.Println("订阅账单已处理", invoice.ID)
+		return nil
+	}
+	log.Printf("收到订阅款项：%s, %s, %.2f(%s)", renewal.StripeSubscriptionId, invoice.ID, float64(invoice.AmountPaid)/100, strings.ToUpper(string(invoice.Currency)))
+	return nil
+}
+
+func subscriptionDeleted(event stripe.Event) {
+	subscriptionId := event.GetObjectValue("id")
+	err := model.LapseSubscription(subscriptionId)
+	if err != nil {
+		log.Println("订阅失效处理失败", subscriptionId, ", err:", err.Error())
+		return
 	}
+	log.Println("订阅已失效", subscriptionId)
+}
 
+func RequestStripeSubscribe(c *gin.Context) {
+	var req struct {
+		PlanId int `json:"plan_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
+		return
+	}
+	plan, err := model.GetPlanById(req.PlanId)
+	if err != nil || !plan.Enabled {
+		c.JSON(200, gin.H{"message": "error", "data": "套餐不存在或已停用"})
+		return
+	}
+	id := c.GetInt("id")
+	if _, err = model.GetActiveSubscriptionByUserId(id); err == nil {
+		c.JSON(200, gin.H{"message": "error", "data": "已有生效中的订阅，请先取消后再订阅其他套餐"})
+		return
+	}
+	// 同一套餐未过期的结账会话直接复用，其它未完成的会话先使其过期，避免多次结账产生多个订阅
+	if checkout, err := model.GetSubscriptionCheckout(id); err == nil {
+		if checkout.PlanId == plan.Id && checkout.ExpiresAt > time.Now().Add(time.Minute).Unix() {
+			c.JSON(200, gin.H{
+				"message": "success",
+				"data": gin.H{
+					"pay_link": checkout.Url,
+				},
+			})
+			return
+		}
+		if err = expireStripeCheckout(checkout.SessionId); err != nil {
+			log.Println("使Stripe订阅结账会话过期失败", checkout.SessionId, err)
+			c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+			return
+		}
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "获取用户信息失败"})
+		return
+	}
+	checkout, err := genStripeSubscriptionLink(user, plan)
+	if err != nil {
+		log.Println("获取Stripe订阅支付链接失败", err)
+		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		return
+	}
+	if err = model.SaveSubscriptionCheckout(checkout); err != nil {
+		log.Println("记录Stripe订阅结账会话失败", checkout.SessionId, err)
+	}
+	c.JSON(200, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"pay_link": checkout.Url,
+		},
+	})
+}
+
+// expireStripeCheckout 使未完成的订阅结账会话过期；会话已完成时订阅即将生效，不能再次订阅
+func expireStripeCheckout(sessionId string) error {
+	if err := setStripeKey(); err != nil {
+		return err
+	}
+	if _, err := session.Expire(sessionId, nil); err != nil {
+		result, getErr := session.Get(sessionId, nil)
+		if getErr != nil {
+			return errors.New("拉起支付失败")
+		}
+		if result.Status == stripe.CheckoutSessionStatusComplete {
+			return errors.New("上一次订阅支付已完成，请等待订阅生效")
+		}
+		if result.Status != stripe.CheckoutSessionStatusExpired {
+			return errors.New("拉起支付失败")
+		}
+	}
+	return model.DeleteSubscriptionCheckout(sessionId)
+}
+
+// CancelStripeSubscription 在当前计费周期结束时取消订阅，到期后由 customer.subscription.deleted 恢复分组
+func CancelStripeSubscription(c *gin.Context) {
+	sub, err := model.GetActiveSubscriptionByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "没有生效中的订阅"})
+		return
+	}
+	if err = setStripeKey(); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	_, err = subscription.Update(sub.StripeSubscriptionId, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+	if err != nil {
+		log.Println("取消Stripe订阅失败", sub.StripeSubscriptionId, err)
+		c.JSON(200, gin.H{"message": "error", "data": "取消订阅失败"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "success", "data": sub.CurrentPeriodEnd})
+}
+
+func setStripeKey() error {
+	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
+		return fmt.Errorf("无效的Stripe API密钥")
+	}
 	stripe.Key = setting.StripeApiSecret
+	return nil
+}
+
+func genStripeSubscriptionLink(user *model.User, plan *model.Plan) (*model.SubscriptionCheckout, error) {
+	if err := setStripeKey(); err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{
+		"user_id": strconv.Itoa(user.Id),
+		"plan_id": strconv.Itoa(plan.Id),
+	}
+	params := &stripe.CheckoutSessionParams{
+		SuccessURL: stripe.String(setting.ServerAddress + "/log"),
+		CancelURL:  stripe.String(setting.ServerAddress + "/topup"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(plan.StripePriceId),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: metadata,
+		},
+		Metadata:  metadata,
+		ExpiresAt: stripe.Int64(time.Now().Add(stripeSubscriptionCheckoutTTL).Unix()),
+	}
+
+	if "" == user.StripeCustomer {
+		if "" != user.Email {
+			params.CustomerEmail = stripe.String(user.Email)
+		}
+	} else {
+		params.Customer = stripe.String(user.StripeCustomer)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.SubscriptionCheckout{
+		UserId:    user.Id,
+		PlanId:    plan.Id,
+		SessionId: result.ID,
+		Url:       result.URL,
+		ExpiresAt: result.ExpiresAt,
+	}, nil
+}
+
+func genStripeLink(referenceId string, customerId string, email string, amount int64) (string, error) {
+	if err := setStripeKey(); err != nil {
+		return "", err
+	}
 
 	params := &stripe.CheckoutSessionParams{
 		ClientReferenceID: stripe.String(referenceId),
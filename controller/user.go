@@ -482,6 +482,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if updatedUser.CreditLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "授信额度不能为负数",
+		})
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
@@ -493,6 +500,9 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	if originUser.CreditLimit != updatedUser.CreditLimit {
+		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户授信额度从 %s修改为 %s", common.LogQuota(originUser.CreditLimit), common.LogQuota(updatedUser.CreditLimit)))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -4,4 +4,8 @@ type ChannelSettings struct {
 	ForceFormat       bool   `json:"force_format,omitempty"`
 	ThinkingToContent bool   `json:"thinking_to_content,omitempty"`
 	Proxy             string `json:"proxy"`
+	// OpenAI 兼容上游不支持 Responses API 时，将 /v1/responses 请求转换为 Chat Completions
+	ResponsesToChatCompletions bool `json:"responses_to_chat_completions,omitempty"`
+	// 将 Chat Completions 请求转换为 Responses API 请求上游
+	ChatCompletionsToResponses bool `json:"chat_completions_to_responses,omitempty"`
 }
@@ -0,0 +1,59 @@
+package dto
+
+import "encoding/json"
+
+// ClaudeMessageBatch https://docs.anthropic.com/en/api/creating-message-batches
+type ClaudeMessageBatch struct {
+	Id                string                          `json:"id"`
+	Type              string                          `json:"type"`
+	ProcessingStatus  string                          `json:"processing_status"`
+	RequestCounts     ClaudeMessageBatchRequestCounts `json:"request_counts"`
+	EndedAt           *string                         `json:"ended_at"`
+	CreatedAt         string                          `json:"created_at"`
+	ExpiresAt         string                          `json:"expires_at"`
+	ArchivedAt        *string                         `json:"archived_at"`
+	CancelInitiatedAt *string                         `json:"cancel_initiated_at"`
+	ResultsUrl        *string                         `json:"results_url"`
+}
+
+type ClaudeMessageBatchRequestCounts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+type ClaudeMessageBatchRequest struct {
+	Requests []ClaudeMessageBatchRequestItem `json:"requests"`
+}
+
+type ClaudeMessageBatchRequestItem struct {
+	CustomId string          `json:"custom_id"`
+	Params   json.RawMessage `json:"params"`
+}
+
+type ClaudeMessageBatchList struct {
+	Data    []ClaudeMessageBatch `json:"data"`
+	HasMore bool                 `json:"has_more"`
+	FirstId *string              `json:"first_id"`
+	LastId  *string              `json:"last_id"`
+}
+
+type ClaudeMessageBatchDeleted struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// ClaudeMessageBatchResultLine 结果文件（JSONL）中的一行
+type ClaudeMessageBatchResultLine struct {
+	CustomId string                   `json:"custom_id"`
+	Result   ClaudeMessageBatchResult `json:"result"`
+}
+
+type ClaudeMessageBatchResult struct {
+	// succeeded / errored / canceled / expired
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
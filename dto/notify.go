@@ -11,6 +11,7 @@ const ContentValueParam = "{{value}}"
 
 const (
 	NotifyTypeQuotaExceed   = "quota_exceed"
+	NotifyTypeCreditLimit   = "credit_limit"
 	NotifyTypeChannelUpdate = "channel_update"
 	NotifyTypeChannelTest   = "channel_test"
 )
@@ -615,7 +615,7 @@ type OpenAIResponsesRequest struct {
 	PreviousResponseID string           `json:"previous_response_id,omitempty"`
 	Reasoning          *Reasoning       `json:"reasoning,omitempty"`
 	ServiceTier        string           `json:"service_tier,omitempty"`
-	Store              bool             `json:"store,omitempty"`
+	Store              *bool            `json:"store,omitempty"`
 	Stream             bool             `json:"stream,omitempty"`
 	Temperature        float64          `json:"temperature,omitempty"`
 	Text               json.RawMessage  `json:"text,omitempty"`
@@ -628,6 +628,35 @@ type OpenAIResponsesRequest struct {
 	Prompt             json.RawMessage  `json:"prompt,omitempty"`
 }
 
+// ShouldStore store 未指定时默认为 true
+func (r *OpenAIResponsesRequest) ShouldStore() bool {
+	return r.Store == nil || *r.Store
+}
+
+// ResponsesInputItem input 数组中的元素，message / function_call / function_call_output / reasoning
+type ResponsesInputItem struct {
+	Type      string                   `json:"type,omitempty"`
+	Id        string                   `json:"id,omitempty"`
+	Role      string                   `json:"role,omitempty"`
+	Content   json.RawMessage          `json:"content,omitempty"`
+	CallId    string                   `json:"call_id,omitempty"`
+	Name      string                   `json:"name,omitempty"`
+	Arguments string                   `json:"arguments,omitempty"`
+	Output    json.RawMessage          `json:"output,omitempty"`
+	Summary   []ResponsesOutputContent `json:"summary,omitempty"`
+}
+
+type ResponsesInputContent struct {
+	Type       string             `json:"type"`
+	Text       string             `json:"text,omitempty"`
+	ImageUrl   string             `json:"image_url,omitempty"`
+	Detail     string             `json:"detail,omitempty"`
+	FileId     string             `json:"file_id,omitempty"`
+	FileData   string             `json:"file_data,omitempty"`
+	Filename   string             `json:"filename,omitempty"`
+	InputAudio *MessageInputAudio `json:"input_audio,omitempty"`
+}
+
 type Reasoning struct {
 	Effort  string `json:"effort,omitempty"`
 	Summary string `json:"summary,omitempty"`
@@ -189,11 +189,12 @@ type Usage struct {
 	TotalTokens          int `json:"total_tokens"`
 	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens,omitempty"`
 
-	PromptTokensDetails    InputTokenDetails  `json:"prompt_tokens_details"`
-	CompletionTokenDetails OutputTokenDetails `json:"completion_tokens_details"`
-	InputTokens            int                `json:"input_tokens"`
-	OutputTokens           int                `json:"output_tokens"`
-	InputTokensDetails     *InputTokenDetails `json:"input_tokens_details"`
+	PromptTokensDetails    InputTokenDetails   `json:"prompt_tokens_details"`
+	CompletionTokenDetails OutputTokenDetails  `json:"completion_tokens_details"`
+	InputTokens            int                 `json:"input_tokens"`
+	OutputTokens           int                 `json:"output_tokens"`
+	InputTokensDetails     *InputTokenDetails  `json:"input_tokens_details"`
+	OutputTokensDetails    *OutputTokenDetails `json:"output_tokens_details,omitempty"`
 	// OpenRouter Params
 	Cost any `json:"cost,omitempty"`
 }
@@ -238,7 +239,7 @@ type OpenAIResponsesResponse struct {
 }
 
 type IncompleteDetails struct {
-	Reasoning string `json:"reasoning"`
+	Reason string `json:"reason"`
 }
 
 type ResponsesOutput struct {
@@ -247,6 +248,12 @@ type ResponsesOutput struct {
 	Status  string                   `json:"status"`
 	Role    string                   `json:"role"`
 	Content []ResponsesOutputContent `json:"content"`
+	// function_call
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// reasoning
+	Summary []ResponsesOutputContent `json:"summary,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -269,10 +276,46 @@ const (
 	ResponsesOutputTypeItemDone  = "response.output_item.done"
 )
 
+const (
+	ResponsesStreamTypeCreated               = "response.created"
+	ResponsesStreamTypeInProgress            = "response.in_progress"
+	ResponsesStreamTypeCompleted             = "response.completed"
+	ResponsesStreamTypeIncomplete            = "response.incomplete"
+	ResponsesStreamTypeFailed                = "response.failed"
+	ResponsesStreamTypeError                 = "error"
+	ResponsesStreamTypeContentPartAdded      = "response.content_part.added"
+	ResponsesStreamTypeContentPartDone       = "response.content_part.done"
+	ResponsesStreamTypeOutputTextDelta       = "response.output_text.delta"
+	ResponsesStreamTypeOutputTextDone        = "response.output_text.done"
+	ResponsesStreamTypeReasoningPartAdded    = "response.reasoning_summary_part.added"
+	ResponsesStreamTypeReasoningPartDone     = "response.reasoning_summary_part.done"
+	ResponsesStreamTypeReasoningTextDelta    = "response.reasoning_summary_text.delta"
+	ResponsesStreamTypeReasoningTextDone     = "response.reasoning_summary_text.done"
+	ResponsesStreamTypeFunctionArgumentDelta = "response.function_call_arguments.delta"
+	ResponsesStreamTypeFunctionArgumentDone  = "response.function_call_arguments.done"
+)
+
+type OpenAIResponsesDeleteResponse struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
 // ResponsesStreamResponse 用于处理 /v1/responses 流式响应
 type ResponsesStreamResponse struct {
-	Type     string                   `json:"type"`
-	Response *OpenAIResponsesResponse `json:"response,omitempty"`
-	Delta    string                   `json:"delta,omitempty"`
-	Item     *ResponsesOutput         `json:"item,omitempty"`
+	Type           string                   `json:"type"`
+	SequenceNumber int                      `json:"sequence_number"`
+	Response       *OpenAIResponsesResponse `json:"response,omitempty"`
+	Delta          string                   `json:"delta,omitempty"`
+	Item           *ResponsesOutput         `json:"item,omitempty"`
+	ItemId         string                   `json:"item_id,omitempty"`
+	OutputIndex    *int                     `json:"output_index,omitempty"`
+	ContentIndex   *int                     `json:"content_index,omitempty"`
+	SummaryIndex   *int                     `json:"summary_index,omitempty"`
+	Part           *ResponsesOutputContent  `json:"part,omitempty"`
+	Text           string                   `json:"text,omitempty"`
+	Arguments      string                   `json:"arguments,omitempty"`
+	// error 事件的错误信息
+	Code    any    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
 }
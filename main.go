@@ -83,6 +83,16 @@ func main() {
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
+	// 多节点共享渠道熔断状态
+	if common.RedisEnabled {
+		go model.SyncChannelBreakers(5)
+	}
+
+	// 退还实例崩溃遗留的额度预扣记录
+	if common.RedisEnabled {
+		go model.ReapQuotaReservations()
+	}
+
 	// 数据看板
 	go model.UpdateQuotaData()
 
@@ -108,6 +118,23 @@ func main() {
 			controller.UpdateTaskBulk()
 		})
 	}
+	if common.IsMasterNode {
+		gopool.Go(func() {
+			service.CleanupExpiredStoredResponses()
+		})
+		gopool.Go(func() {
+			service.CleanupExpiredFiles()
+		})
+		gopool.Go(func() {
+			service.ResumeStaleBatches()
+		})
+		gopool.Go(func() {
+			controller.SyncNativeClaudeBatches()
+		})
+		gopool.Go(func() {
+			model.LapseExpiredSubscriptions()
+		})
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
 		common.SysLog("batch update enabled with interval " + strconv.Itoa(common.BatchUpdateInterval) + "s")
@@ -149,6 +176,7 @@ func main() {
 	server.Use(sessions.Sessions("session", store))
 
 	router.SetRouter(server, buildFS, indexPage)
+	service.SetBatchHandler(server)
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
@@ -274,6 +274,9 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	c.Set("allow_ips", token.GetIpLimitsMap())
 	c.Set("token_group", token.Group)
+	c.Set("token_period_start", token.CurrentPeriodStart())
+	c.Set("token_rpm_limit", token.RpmLimit)
+	c.Set("token_tpm_limit", token.TpmLimit)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"one-api/types"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 启用 Redis 时其它实例释放的槽位不会唤醒本实例，需要定期重试
+const channelQueuePollInterval = 200 * time.Millisecond
+
+// 用户放行记录的保留时间，队列短暂清空后仍按此历史保持用户间的公平
+const channelQueueFairnessTTL = 10 * time.Minute
+
+// 离开队列时所在位置与排队耗时的响应头
+const (
+	channelQueuePositionHeader = "X-Oneapi-Queue-Position"
+	channelQueueWaitHeader     = "X-Oneapi-Queue-Wait-Ms"
+)
+
+var (
+	errChannelQueueFull    = errors.New("channel queue is full")
+	errChannelQueueTimeout = errors.New("timed out waiting for a free channel")
+)
+
+func isChannelQueueError(err error) bool {
+	return errors.Is(err, model.ErrChannelSaturated) || errors.Is(err, errChannelQueueFull) ||
+		errors.Is(err, errChannelQueueTimeout) || errors.Is(err, context.Canceled)
+}
+
+// channelSlotError 只关心并发上限，SetupContextForSelectedChannel 的其它错误保持原有的忽略行为
+func channelSlotError(newAPIError *types.NewAPIError) error {
+	if newAPIError != nil && newAPIError.GetErrorCode() == types.ErrorCodeChannelSaturated {
+		return model.ErrChannelSaturated
+	}
+	return nil
+}
+
+type admissionWaiter struct {
+	userId   int
+	priority int
+	seq      uint64
+}
+
+// admissionQueue 同一分组与模型（或同一指定渠道）的排队请求，只有队首的请求尝试选择渠道
+type admissionQueue struct {
+	waiters []*admissionWaiter
+	// 用户最近一次被放行的时间，同优先级下最久未被放行的用户优先，避免单个用户占满队列；
+	// 超过 channelQueueFairnessTTL 的记录在清理时移除
+	lastServed map[int]time.Time
+	// 队列变化时关闭并替换，用于唤醒排队的请求
+	changed chan struct{}
+}
+
+var (
+	admissionQueues    = make(map[string]*admissionQueue)
+	admissionQueueLock sync.Mutex
+	admissionQueueSize int
+	admissionSeq       uint64
+)
+
+// lessLocked 优先级高的在前，同优先级按用户最近放行时间，再按入队顺序
+func (q *admissionQueue) lessLocked(a, b *admissionWaiter) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if a.userId != b.userId {
+		servedA, servedB := q.lastServed[a.userId], q.lastServed[b.userId]
+		if !servedA.Equal(servedB) {
+			return servedA.Before(servedB)
+		}
+	}
+	return a.seq < b.seq
+}
+
+func (q *admissionQueue) sortLocked() {
+	sort.SliceStable(q.waiters, func(i, j int) bool {
+		return q.lessLocked(q.waiters[i], q.waiters[j])
+	})
+}
+
+func (q *admissionQueue) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+func (q *admissionQueue) positionLocked(waiter *admissionWaiter) int {
+	for i, w := range q.waiters {
+		if w == waiter {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// removeLocked 移出队列，admitted 时记录用户的放行时间
+func (q *admissionQueue) removeLocked(waiter *admissionWaiter, admitted bool) {
+	for i, w := range q.waiters {
+		if w == waiter {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			admissionQueueSize--
+			break
+		}
+	}
+	if admitted {
+		q.lastServed[waiter.userId] = time.Now()
+		q.sortLocked()
+	}
+	q.notifyLocked()
+}
+
+// pruneAdmissionQueuesLocked 移除过期的放行记录，没有排队请求且没有放行记录的队列一并移除
+func pruneAdmissionQueuesLocked() {
+	expired := time.Now().Add(-channelQueueFairnessTTL)
+	for key, q := range admissionQueues {
+		for userId, served := range q.lastServed {
+			if served.Before(expired) {
+				delete(q.lastServed, userId)
+			}
+		}
+		if len(q.waiters) == 0 && len(q.lastServed) == 0 {
+			delete(admissionQueues, key)
+		}
+	}
+}
+
+// waitForChannelSlot 调用 pick 选择渠道并占用槽位。所有可用渠道都在限流冷却中或达到并发上限时，
+// 按用户分组优先级与用户间公平的顺序排队，直到轮到且有可用渠道、超时或客户端断开；
+// 同一队列已有请求排队时新请求直接入队，不插队
+func waitForChannelSlot(c *gin.Context, queueKey string, pick func() error) error {
+	setting := operation_setting.GetChannelConcurrencySetting()
+	admissionQueueLock.Lock()
+	existing, ok := admissionQueues[queueKey]
+	queued := ok && len(existing.waiters) > 0
+	admissionQueueLock.Unlock()
+	if !queued || !setting.QueueEnabled {
+		err := pick()
+		if !errors.Is(err, model.ErrChannelSaturated) || !setting.QueueEnabled {
+			return err
+		}
+	}
+
+	admissionQueueLock.Lock()
+	if admissionQueueSize >= setting.MaxQueueSize {
+		admissionQueueLock.Unlock()
+		return errChannelQueueFull
+	}
+	// 只有排队时才需要清理，不影响未饱和时的请求
+	pruneAdmissionQueuesLocked()
+	queue, ok := admissionQueues[queueKey]
+	if !ok {
+		queue = &admissionQueue{lastServed: make(map[int]time.Time), changed: make(chan struct{})}
+		admissionQueues[queueKey] = queue
+	}
+	admissionSeq++
+	waiter := &admissionWaiter{
+		userId:   c.GetInt("id"),
+		priority: operation_setting.GetGroupQueuePriority(common.GetContextKeyString(c, constant.ContextKeyUserGroup)),
+		seq:      admissionSeq,
+	}
+	queue.waiters = append(queue.waiters, waiter)
+	admissionQueueSize++
+	queue.sortLocked()
+	queue.notifyLocked()
+	admissionQueueLock.Unlock()
+
+	start := time.Now()
+	admitted := false
+	defer func() {
+		admissionQueueLock.Lock()
+		// 离开队列时的实际位置，放行时为 1，超时或断开时为等到的位置
+		position := queue.positionLocked(waiter)
+		queue.removeLocked(waiter, admitted)
+		admissionQueueLock.Unlock()
+		c.Header(channelQueuePositionHeader, strconv.Itoa(position))
+		c.Header(channelQueueWaitHeader, strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+	}()
+
+	timeout := time.NewTimer(time.Duration(setting.QueueTimeoutSeconds) * time.Second)
+	defer timeout.Stop()
+	ticker := time.NewTicker(channelQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		admissionQueueLock.Lock()
+		head := queue.waiters[0] == waiter
+		changed := queue.changed
+		admissionQueueLock.Unlock()
+		if head {
+			err := pick()
+			if !errors.Is(err, model.ErrChannelSaturated) {
+				admitted = err == nil
+				return err
+			}
+		}
+		select {
+		case <-model.ChannelSlotReleased():
+		case <-changed:
+		case <-ticker.C:
+		case <-timeout.C:
+			return errChannelQueueTimeout
+		case <-c.Request.Context().Done():
+			return c.Request.Context().Err()
+		}
+	}
+}
+
+// selectChannelWithQueue 选择渠道并占用槽位，所有可用渠道都在限流冷却中或达到并发上限时按分组与模型排队等待
+func selectChannelWithQueue(c *gin.Context, group string, modelName string) (*model.Channel, string, error) {
+	var channel *model.Channel
+	var selectGroup string
+	err := waitForChannelSlot(c, group+":"+modelName, func() error {
+		var err error
+		channel, selectGroup, err = model.CacheGetRandomSatisfiedChannel(c, group, modelName)
+		if err != nil || channel == nil {
+			return err
+		}
+		return channelSlotError(SetupContextForSelectedChannel(c, channel, modelName))
+	})
+	return channel, selectGroup, err
+}
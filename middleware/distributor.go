@@ -23,12 +23,17 @@ import (
 type ModelRequest struct {
 	Model string `json:"model"`
 	Group string `json:"group,omitempty"`
+	// 会话绑定按提示词前缀计算会话标识时使用，与模型一并解析
+	promptPrefixRequest
+	// 请求体已解析到本结构
+	bodyParsed bool
 }
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		allowIpsMap := common.GetContextKeyStringMap(c, constant.ContextKeyTokenAllowIps)
-		if len(allowIpsMap) != 0 {
+		// 批处理请求由网关内部发起，IP 已在创建批处理时校验
+		if len(allowIpsMap) != 0 && common.GetBatchId(c) == "" {
 			clientIp := c.ClientIP()
 			if _, ok := allowIpsMap[clientIp]; !ok {
 				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
@@ -36,6 +41,8 @@ func Distribute() func(c *gin.Context) {
 			}
 		}
 		var channel *model.Channel
+		// 选择渠道时已占用并发槽位
+		channelReady := false
 		channelId, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
 		modelRequest, shouldSelectChannel, err := getModelRequest(c)
 		if err != nil {
@@ -100,8 +107,13 @@ func Distribute() func(c *gin.Context) {
 			}
 
 			if shouldSelectChannel {
+				setSessionAffinityHash(c, modelRequest)
 				var selectGroup string
-				channel, selectGroup, err = model.CacheGetRandomSatisfiedChannel(c, userGroup, modelRequest.Model, 0)
+				channel, selectGroup, err = selectChannelWithQueue(c, userGroup, modelRequest.Model)
+				if isChannelQueueError(err) {
+					abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("当前分组 %s 下模型 %s 的渠道繁忙，请稍后再试", userGroup, modelRequest.Model))
+					return
+				}
 				if err != nil {
 					showGroup := userGroup
 					if userGroup == "auto" {
@@ -121,10 +133,24 @@ func Distribute() func(c *gin.Context) {
 					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道（数据库一致性已被破坏）", userGroup, modelRequest.Model))
 					return
 				}
+				channelReady = true
 			}
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
-		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		if channel == nil {
+			// 查询任务等无需选择渠道的请求，只记录模型名
+			SetupContextForSelectedChannel(c, nil, modelRequest.Model)
+		} else if !channelReady {
+			// 指定渠道限流冷却或达到并发上限时同样排队等待
+			err = waitForChannelSlot(c, "channel:"+strconv.Itoa(channel.Id), func() error {
+				return channelSlotError(SetupContextForSelectedChannel(c, channel, modelRequest.Model))
+			})
+			if isChannelQueueError(err) {
+				abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("渠道 #%d 繁忙，请稍后再试", channel.Id))
+				return
+			}
+		}
+		defer model.ReleaseChannelSlot(c)
 		c.Next()
 	}
 }
@@ -174,6 +200,7 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		c.Set("relay_mode", relayMode)
 	} else if strings.Contains(c.Request.URL.Path, "/v1/video/generations") {
 		err = common.UnmarshalBodyReusable(c, &modelRequest)
+		modelRequest.bodyParsed = err == nil
 		var platform string
 		var relayMode int
 		if strings.HasPrefix(modelRequest.Model, "jimeng") {
@@ -193,14 +220,15 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		c.Set("relay_mode", relayMode)
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") || strings.HasPrefix(c.Request.URL.Path, "/v1/models/") {
 		// Gemini API 路径处理: /v1beta/models/gemini-2.0-flash:generateContent
-		relayMode := relayconstant.RelayModeGemini
+		relayMode := relayconstant.Path2RelayMode(c.Request.URL.Path)
 		modelName := extractModelNameFromGeminiPath(c.Request.URL.Path)
 		if modelName != "" {
 			modelRequest.Model = modelName
 		}
 		c.Set("relay_mode", relayMode)
-	} else if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") && !strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") {
+	} else if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") && !strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") && !strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
 		err = common.UnmarshalBodyReusable(c, &modelRequest)
+		modelRequest.bodyParsed = err == nil
 	}
 	if err != nil {
 		return nil, false, errors.New("无效的请求, " + err.Error())
@@ -223,6 +251,8 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "dall-e")
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") {
 		modelRequest.Model = common.GetStringIfEmpty(c.PostForm("model"), "gpt-image-1")
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+		modelRequest.Model = common.GetStringIfEmpty(c.PostForm("model"), "dall-e-2")
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		relayMode := relayconstant.RelayModeAudioSpeech
@@ -242,6 +272,7 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	if strings.HasPrefix(c.Request.URL.Path, "/pg/chat/completions") {
 		// playground chat completions
 		err = common.UnmarshalBodyReusable(c, &modelRequest)
+		modelRequest.bodyParsed = err == nil
 		if err != nil {
 			return nil, false, errors.New("无效的请求, " + err.Error())
 		}
@@ -268,12 +299,17 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
+	key, index, newAPIError := model.GetChannelKeyForRequest(c, channel)
 	if newAPIError != nil {
 		return newAPIError
 	}
+	// 占用渠道与密钥的并发槽位，重试换渠道时释放上一个渠道的槽位
+	if newAPIError = model.AcquireChannelSlot(c, channel, index); newAPIError != nil {
+		return newAPIError
+	}
+	// 重试换渠道时需覆盖上一个渠道的值
+	common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, channel.ChannelInfo.IsMultiKey)
 	if channel.ChannelInfo.IsMultiKey {
-		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, true)
 		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, index)
 	}
 	// c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
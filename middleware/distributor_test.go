@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDistributeTaskFetchWithoutChannel 测试查询任务等无需选择渠道的请求不占用渠道，直接交给后续处理
+func TestDistributeTaskFetchWithoutChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		common.SetContextKey(c, constant.ContextKeyUserGroup, "default")
+	}, Distribute())
+	handler := func(c *gin.Context) {
+		_, exists := common.GetContextKey(c, constant.ContextKeyChannelId)
+		assert.False(t, exists)
+		c.Status(http.StatusOK)
+	}
+	router.GET("/mj/task/:id/fetch", handler)
+	router.GET("/suno/fetch/:id", handler)
+
+	for _, path := range []string{"/mj/task/abc/fetch", "/suno/fetch/abc"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code, path)
+	}
+}
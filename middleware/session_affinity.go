@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// promptPrefixRequest 各种请求格式中构成提示词前缀的字段
+type promptPrefixRequest struct {
+	System            json.RawMessage   `json:"system"`
+	Instructions      json.RawMessage   `json:"instructions"`
+	SystemInstruction json.RawMessage   `json:"systemInstruction"`
+	Messages          []json.RawMessage `json:"messages"`
+	Contents          []json.RawMessage `json:"contents"`
+	Input             json.RawMessage   `json:"input"`
+}
+
+// promptPrefix 系统提示词与截至第一条用户消息的内容，多轮对话的后续请求中保持不变；
+// 复用选择渠道时解析的请求，只有未解析过请求体的路径（如 Gemini）才在此解析
+func promptPrefix(c *gin.Context, modelRequest *ModelRequest) []byte {
+	if !strings.Contains(c.Request.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	if !modelRequest.bodyParsed {
+		if err := common.UnmarshalBodyReusable(c, &modelRequest.promptPrefixRequest); err != nil {
+			return nil
+		}
+		modelRequest.bodyParsed = true
+	}
+	request := &modelRequest.promptPrefixRequest
+	messages := request.Messages
+	if len(messages) == 0 {
+		messages = request.Contents
+	}
+	if len(messages) == 0 && len(request.Input) > 0 && request.Input[0] == '[' {
+		_ = json.Unmarshal(request.Input, &messages)
+	}
+	var prefix bytes.Buffer
+	prefix.Write(request.System)
+	prefix.Write(request.Instructions)
+	prefix.Write(request.SystemInstruction)
+	for _, message := range messages {
+		prefix.Write(message)
+		var role struct {
+			Role string `json:"role"`
+		}
+		if json.Unmarshal(message, &role) == nil && role.Role == "user" {
+			break
+		}
+	}
+	if prefix.Len() == 0 {
+		return nil
+	}
+	return prefix.Bytes()
+}
+
+// setSessionAffinityHash 根据会话请求头或提示词前缀计算会话标识，同一用户的同一会话得到相同的值
+func setSessionAffinityHash(c *gin.Context, modelRequest *ModelRequest) {
+	if operation_setting.GetSessionAffinityTTL() <= 0 {
+		return
+	}
+	setting := operation_setting.GetSessionAffinitySetting()
+	var session []byte
+	for _, header := range setting.SessionHeaders {
+		if value := strings.TrimSpace(c.Request.Header.Get(header)); value != "" {
+			session = []byte("header:" + value)
+			break
+		}
+	}
+	if session == nil && setting.PrefixHashEnabled {
+		if prefix := promptPrefix(c, modelRequest); prefix != nil {
+			session = append([]byte("prefix:"), prefix...)
+		}
+	}
+	if session == nil {
+		return
+	}
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	hash := common.Sha256Raw(append([]byte(strconv.Itoa(userId)+":"), session...))
+	common.SetContextKey(c, constant.ContextKeySessionAffinityHash, hex.EncodeToString(hash[:16]))
+}
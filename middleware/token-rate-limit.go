@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenRateLimit 按令牌设置的每分钟请求数与 token 数限流，token 数在预扣费时按预估的提示词 token 数计入，结算时按实际用量校正
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		allowed, message, err := service.CheckTokenRateLimit(c)
+		if err != nil {
+			common.LogError(c, "check token rate limit failed: "+err.Error())
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+			return
+		}
+		if !allowed {
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, message)
+			return
+		}
+		c.Next()
+	}
+}
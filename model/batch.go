@@ -0,0 +1,347 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+	"one-api/dto"
+	"time"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+const (
+	BatchFormatOpenAI = "openai"
+	BatchFormatClaude = "claude"
+)
+
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	Format           string `json:"format" gorm:"type:varchar(16);default:'openai';index"`
+	Group            string `json:"group" gorm:"type:varchar(64)"`
+	// 原生转发到上游（如 Anthropic Message Batches）时记录的上游信息
+	ChannelId       int    `json:"channel_id"`
+	ChannelKeyIndex int    `json:"channel_key_index"`
+	UpstreamBatchId string `json:"upstream_batch_id" gorm:"type:varchar(128)"`
+	BilledAt        int64  `json:"billed_at" gorm:"bigint;default:0"`
+	Errors          string `json:"errors" gorm:"type:text"`   // dto.OpenAIBatchErrors JSON
+	Metadata        string `json:"metadata" gorm:"type:text"` // map[string]string JSON
+	TotalCount      int    `json:"total_count"`
+	CompletedCount  int    `json:"completed_count"`
+	FailedCount     int    `json:"failed_count"`
+	CreatedAt       int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt    int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt       int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt    int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt     int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt        int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt       int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt    int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt     int64  `json:"cancelled_at" gorm:"bigint"`
+	HeartbeatAt     int64  `json:"-" gorm:"bigint;default:0"` // 执行节点定期更新，停止更新的批处理由主节点接管
+}
+
+// BatchResult 本地执行的批处理中已完成的单条请求结果，批处理结束时写入输出文件后删除；
+// 执行节点重启后据此跳过已完成的请求继续执行
+type BatchResult struct {
+	Id       int    `json:"id"`
+	BatchId  string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex:idx_batch_result_custom_id"`
+	CustomId string `json:"custom_id" gorm:"type:varchar(255);uniqueIndex:idx_batch_result_custom_id"`
+	Success  bool   `json:"success"`
+	Result   string `json:"result" gorm:"type:text"` // dto.OpenAIBatchOutputLine JSON
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+func (batch *Batch) Delete() error {
+	return DB.Delete(batch).Error
+}
+
+func (batch *Batch) Update() error {
+	return DB.Save(batch).Error
+}
+
+// UpdateStatusFrom 仅当状态仍为 from 时才更新，用于避免覆盖其它节点/请求写入的取消状态
+func (batch *Batch) UpdateStatusFrom(from string, updates map[string]interface{}) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? and status = ?", batch.Id, from).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (batch *Batch) UpdateRequestCounts() error {
+	return DB.Model(&Batch{}).Where("id = ?", batch.Id).Updates(map[string]interface{}{
+		"total_count":     batch.TotalCount,
+		"completed_count": batch.CompletedCount,
+		"failed_count":    batch.FailedCount,
+	}).Error
+}
+
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case BatchStatusFailed, BatchStatusCompleted, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Touch 更新执行心跳
+func (batch *Batch) Touch() error {
+	batch.HeartbeatAt = common.GetTimestamp()
+	return DB.Model(&Batch{}).Where("id = ?", batch.Id).Update("heartbeat_at", batch.HeartbeatAt).Error
+}
+
+// Claim 接管心跳已停止的批处理，多个节点同时接管时只有一个成功
+func (batch *Batch) Claim() (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).Where("id = ? and heartbeat_at = ?", batch.Id, batch.HeartbeatAt).Update("heartbeat_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	batch.HeartbeatAt = now
+	return true, nil
+}
+
+// GetStaleBatches 返回本地执行且心跳早于 before 的未完成批处理
+func GetStaleBatches(before int64, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("upstream_batch_id = '' and heartbeat_at < ? and status in ?", before,
+		[]string{BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetUnbilledNativeBatches 返回 since 之后创建、转发到上游且尚未计费的批处理，包括上游仍在执行的批处理
+func GetUnbilledNativeBatches(since int64, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("upstream_batch_id <> '' and billed_at = 0 and created_at >= ?", since).Order("created_at").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func InsertBatchResult(result *BatchResult) error {
+	return DB.Create(result).Error
+}
+
+// GetBatchResultCustomIds 返回已完成请求的 custom_id
+func GetBatchResultCustomIds(batchId string) (map[string]bool, error) {
+	var customIds []string
+	err := DB.Model(&BatchResult{}).Where("batch_id = ?", batchId).Pluck("custom_id", &customIds).Error
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(customIds))
+	for _, customId := range customIds {
+		done[customId] = true
+	}
+	return done, nil
+}
+
+// CountBatchResults 返回已完成请求中成功与失败的数量
+func CountBatchResults(batchId string) (completed int, failed int, err error) {
+	var counts []struct {
+		Success bool
+		Count   int
+	}
+	err = DB.Model(&BatchResult{}).Select("success, count(*) as count").Where("batch_id = ?", batchId).Group("success").Scan(&counts).Error
+	for _, count := range counts {
+		if count.Success {
+			completed = count.Count
+		} else {
+			failed = count.Count
+		}
+	}
+	return completed, failed, err
+}
+
+// IterateBatchResults 按完成顺序分页读取批处理结果
+func IterateBatchResults(batchId string, handle func(result *BatchResult) error) error {
+	lastId := 0
+	for {
+		var results []*BatchResult
+		err := DB.Where("batch_id = ? and id > ?", batchId, lastId).Order("id").Limit(500).Find(&results).Error
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if err = handle(result); err != nil {
+				return err
+			}
+			lastId = result.Id
+		}
+		if len(results) < 500 {
+			return nil
+		}
+	}
+}
+
+func DeleteBatchResults(batchId string) error {
+	return DB.Where("batch_id = ?", batchId).Delete(&BatchResult{}).Error
+}
+
+func (batch *Batch) ToOpenAIBatch() dto.OpenAIBatch {
+	optionalInt64 := func(v int64) *int64 {
+		if v == 0 {
+			return nil
+		}
+		return &v
+	}
+	optionalString := func(v string) *string {
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+	openAIBatch := dto.OpenAIBatch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalInt64(batch.InProgressAt),
+		ExpiresAt:        optionalInt64(batch.ExpiresAt),
+		FinalizingAt:     optionalInt64(batch.FinalizingAt),
+		CompletedAt:      optionalInt64(batch.CompletedAt),
+		FailedAt:         optionalInt64(batch.FailedAt),
+		ExpiredAt:        optionalInt64(batch.ExpiredAt),
+		CancellingAt:     optionalInt64(batch.CancellingAt),
+		CancelledAt:      optionalInt64(batch.CancelledAt),
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.Errors != "" {
+		var batchErrors dto.OpenAIBatchErrors
+		if err := common.UnmarshalJsonStr(batch.Errors, &batchErrors); err == nil {
+			openAIBatch.Errors = &batchErrors
+		}
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &openAIBatch.Metadata)
+	}
+	return openAIBatch
+}
+
+// ToClaudeMessageBatch 将本地执行的批处理转换为 Anthropic Message Batch 对象
+func (batch *Batch) ToClaudeMessageBatch(resultsUrl string) dto.ClaudeMessageBatch {
+	formatTime := func(v int64) string {
+		return time.Unix(v, 0).UTC().Format(time.RFC3339)
+	}
+	optionalTime := func(v int64) *string {
+		if v == 0 {
+			return nil
+		}
+		t := formatTime(v)
+		return &t
+	}
+	claudeBatch := dto.ClaudeMessageBatch{
+		Id:                batch.Id,
+		Type:              "message_batch",
+		ProcessingStatus:  "in_progress",
+		CreatedAt:         formatTime(batch.CreatedAt),
+		ExpiresAt:         formatTime(batch.ExpiresAt),
+		CancelInitiatedAt: optionalTime(batch.CancellingAt),
+		RequestCounts: dto.ClaudeMessageBatchRequestCounts{
+			Succeeded: batch.CompletedCount,
+			Errored:   batch.FailedCount,
+		},
+	}
+	remaining := batch.TotalCount - batch.CompletedCount - batch.FailedCount
+	if remaining < 0 {
+		remaining = 0
+	}
+	switch batch.Status {
+	case BatchStatusCancelling:
+		claudeBatch.ProcessingStatus = "canceling"
+		claudeBatch.RequestCounts.Processing = remaining
+	case BatchStatusCompleted, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		claudeBatch.ProcessingStatus = "ended"
+		endedAt := batch.CompletedAt
+		switch batch.Status {
+		case BatchStatusFailed:
+			endedAt = batch.FailedAt
+			claudeBatch.RequestCounts.Errored += remaining
+		case BatchStatusExpired:
+			endedAt = batch.ExpiredAt
+			claudeBatch.RequestCounts.Expired = remaining
+		case BatchStatusCancelled:
+			endedAt = batch.CancelledAt
+			claudeBatch.RequestCounts.Canceled = remaining
+		}
+		claudeBatch.EndedAt = optionalTime(endedAt)
+		claudeBatch.ResultsUrl = &resultsUrl
+	default:
+		claudeBatch.RequestCounts.Processing = remaining
+	}
+	return claudeBatch
+}
+
+func GetUserBatchById(id string, userId int) (*Batch, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	var batch Batch
+	err := DB.Where("id = ? and user_id = ?", id, userId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetBatchStatus(id string) (string, error) {
+	var batch Batch
+	err := DB.Select("status").Where("id = ?", id).First(&batch).Error
+	return batch.Status, err
+}
+
+// MarkBilled 标记原生批处理已计费，返回 false 表示已被其它请求计费
+func (batch *Batch) MarkBilled() (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).Where("id = ? and billed_at = 0", batch.Id).Update("billed_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	batch.BilledAt = now
+	return true, nil
+}
+
+// GetUserBatches lists batches of the given format newest first, after is the id of the last batch of the previous page
+func GetUserBatches(userId int, format string, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ? and format = ?", userId, format)
+	if after != "" {
+		var afterBatch Batch
+		if err := DB.Where("id = ? and user_id = ?", after, userId).First(&afterBatch).Error; err == nil {
+			query = query.Where("created_at < ? or (created_at = ? and id < ?)", afterBatch.CreatedAt, afterBatch.CreatedAt, afterBatch.Id)
+		}
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
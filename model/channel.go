@@ -44,8 +44,12 @@ type Channel struct {
 	Tag               *string `json:"tag" gorm:"index"`
 	Setting           *string `json:"setting" gorm:"type:text"` // 渠道额外设置
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
+	// 渠道同时进行中的请求数上限，0 表示不限制
+	MaxInFlight *int `json:"max_in_flight" gorm:"default:0"`
 	// add after v0.8.5
 	ChannelInfo ChannelInfo `json:"channel_info" gorm:"type:json"`
+	// 上游限流后的剩余冷却时间，仅用于接口展示
+	Cooldown *ChannelCooldown `json:"cooldown,omitempty" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -59,6 +63,10 @@ type ChannelInfo struct {
 	PollingEnabled       bool                  `json:"polling_enabled"`         // 是否启用轮询
 	PollingStrategy      constant.KeyStrategy  `json:"polling_strategy"`        // 轮询策略
 	SequentialIndex      int                   `json:"sequential_index"`        // 顺序循环索引
+
+	// 并发上限
+	KeyMaxInFlight      int         `json:"key_max_in_flight,omitempty"`       // 多Key模式下每个key同时进行中的请求数上限，0 表示不限制
+	MultiKeyMaxInFlight map[int]int `json:"multi_key_max_in_flight,omitempty"` // 单独设置的key并发上限，key index -> 上限
 }
 
 // Value implements driver.Valuer interface
@@ -93,7 +101,37 @@ func (channel *Channel) getKeys() []string {
 	return keys
 }
 
+// enabledKeyIndexes 多 Key 渠道中启用的 key 下标
+func (channel *Channel) enabledKeyIndexes() []int {
+	keys := channel.getKeys()
+	indexes := make([]int, 0, len(keys))
+	for i := range keys {
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; ok && status != common.ChannelStatusEnabled {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// GetKeyByIndex 返回多 Key 渠道中指定下标的 key，非多 Key 渠道直接返回 key
+func (channel *Channel) GetKeyByIndex(index int) (string, error) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key, nil
+	}
+	keys := channel.getKeys()
+	if index < 0 || index >= len(keys) {
+		return "", fmt.Errorf("key index %d out of range", index)
+	}
+	return keys[index], nil
+}
+
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+	return channel.GetNextUntriedKey(nil)
+}
+
+// GetNextUntriedKey 选择下一个启用的密钥，优先跳过本次请求已尝试过（tried）、熔断中与冷却中的密钥
+func (channel *Channel) GetNextUntriedKey(tried map[int]bool) (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -130,6 +168,25 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return keys[0], 0, nil
 	}
 
+	// 跳过已尝试过、熔断中、限流冷却中与达到并发上限的密钥，全部跳过时仍从启用的密钥中选择
+	availableIdx := make([]int, 0, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		if !tried[idx] && ChannelBreakerAllow(channel.Id, idx) && GetChannelCooldown(channel.Id, idx) <= 0 && channelKeyInFlightAvailable(channel, idx) {
+			availableIdx = append(availableIdx, idx)
+		}
+	}
+	if len(availableIdx) > 0 {
+		enabledIdx = availableIdx
+	}
+
+	key, idx, newAPIError := channel.selectKey(keys, enabledIdx)
+	if newAPIError == nil {
+		channelBreakerAcquire(channel.Id, idx)
+	}
+	return key, idx, newAPIError
+}
+
+func (channel *Channel) selectKey(keys []string, enabledIdx []int) (string, int, *types.NewAPIError) {
 	// 新的轮询策略逻辑
 	if !channel.ChannelInfo.PollingEnabled {
 		// 轮询未启用，使用原有逻辑（随机选择）
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/setting/operation_setting"
+	"one-api/types"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 内存中的绑定数超过该值时清理过期的绑定
+const channelAffinityPruneSize = 10000
+
+// channelAffinity 会话绑定的渠道与密钥，Group 为实际选择渠道的分组（auto 分组下为具体分组）
+type channelAffinity struct {
+	ChannelId int
+	KeyIndex  int
+	Group     string
+}
+
+type channelAffinityEntry struct {
+	affinity channelAffinity
+	expireAt time.Time
+}
+
+// 未启用 Redis 时的会话绑定，key 格式同 Redis
+var (
+	channelAffinities   = make(map[string]channelAffinityEntry)
+	channelAffinityLock sync.Mutex
+)
+
+// channelAffinityKey 绑定按使用分组与模型区分，同一会话改用后备模型时不会覆盖原模型的绑定
+func channelAffinityKey(c *gin.Context, group string, modelName string) string {
+	hash := common.GetContextKeyString(c, constant.ContextKeySessionAffinityHash)
+	if hash == "" || operation_setting.GetSessionAffinityTTL() <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("channel_affinity:%s:%s:%s", group, modelName, hash)
+}
+
+func (a channelAffinity) String() string {
+	return fmt.Sprintf("%d:%d:%s", a.ChannelId, a.KeyIndex, a.Group)
+}
+
+func parseChannelAffinity(value string) (*channelAffinity, bool) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 {
+		return nil, false
+	}
+	channelId, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, false
+	}
+	keyIndex, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	return &channelAffinity{ChannelId: channelId, KeyIndex: keyIndex, Group: parts[2]}, true
+}
+
+func getChannelAffinity(key string) *channelAffinity {
+	if key == "" {
+		return nil
+	}
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			return nil
+		}
+		affinity, _ := parseChannelAffinity(value)
+		return affinity
+	}
+	channelAffinityLock.Lock()
+	defer channelAffinityLock.Unlock()
+	entry, ok := channelAffinities[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expireAt) {
+		delete(channelAffinities, key)
+		return nil
+	}
+	return &entry.affinity
+}
+
+func setChannelAffinity(key string, affinity channelAffinity, ttl time.Duration) {
+	if common.RedisEnabled {
+		if err := common.RedisSet(key, affinity.String(), ttl); err != nil {
+			common.SysError("failed to save channel affinity to redis: " + err.Error())
+		}
+		return
+	}
+	channelAffinityLock.Lock()
+	defer channelAffinityLock.Unlock()
+	now := time.Now()
+	if len(channelAffinities) >= channelAffinityPruneSize {
+		for k, entry := range channelAffinities {
+			if now.After(entry.expireAt) {
+				delete(channelAffinities, k)
+			}
+		}
+	}
+	channelAffinities[key] = channelAffinityEntry{affinity: affinity, expireAt: now.Add(ttl)}
+}
+
+// lookupChannelAffinity 读取会话在分组与模型下绑定的渠道，没有会话标识或绑定时返回 nil
+func lookupChannelAffinity(c *gin.Context, group string, modelName string) *channelAffinity {
+	if c == nil {
+		return nil
+	}
+	return getChannelAffinity(channelAffinityKey(c, group, modelName))
+}
+
+// pinnedChannelId 绑定渠道在 selectGroup 下的 id，不是该分组的绑定时返回 0
+func (a *channelAffinity) pinnedChannelId(selectGroup string) int {
+	if a == nil || a.Group != selectGroup {
+		return 0
+	}
+	return a.ChannelId
+}
+
+// setSelectedChannelAffinity 选中的是绑定的渠道时保存绑定，选择密钥时优先使用绑定的密钥
+func setSelectedChannelAffinity(c *gin.Context, affinity *channelAffinity, channel *Channel) {
+	if affinity != nil && channel != nil && affinity.ChannelId == channel.Id {
+		common.SetContextKey(c, constant.ContextKeyChannelAffinity, affinity)
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelAffinity, nil)
+}
+
+// GetChannelKeyForRequest 为本次请求选择渠道的密钥，会话绑定的密钥可用时优先使用，否则跳过已尝试过的密钥正常选择
+func GetChannelKeyForRequest(c *gin.Context, channel *Channel) (string, int, *types.NewAPIError) {
+	tried := GetTriedChannels(c).KeysOf(channel.Id)
+	if value, ok := common.GetContextKey(c, constant.ContextKeyChannelAffinity); ok && channel.ChannelInfo.IsMultiKey {
+		if affinity, ok := value.(*channelAffinity); ok && affinity != nil && affinity.ChannelId == channel.Id {
+			index := affinity.KeyIndex
+			if index >= 0 && index < len(channel.getKeys()) && !tried[index] && channelKeyUsable(channel, index) {
+				channelBreakerAcquire(channel.Id, index)
+				return channel.getKeys()[index], index, nil
+			}
+		}
+	}
+	return channel.GetNextUntriedKey(tried)
+}
+
+// channelKeyUsable 密钥已启用，且未熔断、未在冷却中、未达到并发上限
+func channelKeyUsable(channel *Channel, index int) bool {
+	if status, ok := channel.ChannelInfo.MultiKeyStatusList[index]; ok && status != common.ChannelStatusEnabled {
+		return false
+	}
+	return ChannelBreakerAllow(channel.Id, index) && GetChannelCooldown(channel.Id, index) <= 0 && channelKeyInFlightAvailable(channel, index)
+}
+
+// RecordChannelAffinity 请求成功后将会话绑定到本次使用的渠道与密钥并刷新有效期
+func RecordChannelAffinity(c *gin.Context, channelId int) {
+	ttl := operation_setting.GetSessionAffinityTTL()
+	if ttl <= 0 {
+		return
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return
+	}
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	key := channelAffinityKey(c, group, common.GetContextKeyString(c, constant.ContextKeyOriginalModel))
+	if key == "" {
+		return
+	}
+	affinity := channelAffinity{ChannelId: channelId, KeyIndex: -1, Group: group}
+	if group == "auto" {
+		affinity.Group = c.GetString("auto_group")
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		affinity.KeyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	setChannelAffinity(key, affinity, ttl)
+}
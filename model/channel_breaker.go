@@ -0,0 +1,393 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ChannelBreakerStateClosed   = "closed"
+	ChannelBreakerStateOpen     = "open"
+	ChannelBreakerStateHalfOpen = "half_open"
+)
+
+// 错误率统计窗口划分的桶数
+const channelBreakerBuckets = 10
+
+// 熔断中的渠道/密钥，field 为 channelId 或 channelId:keyIndex，value 为熔断时间
+const channelBreakerRedisKey = "channel_breaker:open"
+
+type channelBreakerBucket struct {
+	index   int64
+	success int
+	failure int
+}
+
+type channelBreaker struct {
+	state               string
+	buckets             [channelBreakerBuckets]channelBreakerBucket
+	consecutiveFailures int
+	openedAt            int64
+	probing             int
+	probeSuccess        int
+	lastProbeAt         int64
+}
+
+// ChannelBreakerStatus 渠道熔断状态，KeyIndex 为 -1 表示渠道级
+type ChannelBreakerStatus struct {
+	ChannelId           int     `json:"channel_id"`
+	KeyIndex            int     `json:"key_index"`
+	State               string  `json:"state"`
+	Requests            int     `json:"requests"`
+	Failures            int     `json:"failures"`
+	ErrorRate           float64 `json:"error_rate"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	OpenedAt            int64   `json:"opened_at,omitempty"`
+	RetryAt             int64   `json:"retry_at,omitempty"`
+}
+
+var (
+	channelBreakers    = make(map[string]*channelBreaker)
+	channelBreakerLock sync.Mutex
+)
+
+func channelBreakerKey(channelId int, keyIndex int) string {
+	if keyIndex < 0 {
+		return strconv.Itoa(channelId)
+	}
+	return fmt.Sprintf("%d:%d", channelId, keyIndex)
+}
+
+func parseChannelBreakerKey(key string) (int, int) {
+	channelPart, keyPart, found := strings.Cut(key, ":")
+	channelId, _ := strconv.Atoi(channelPart)
+	if !found {
+		return channelId, -1
+	}
+	keyIndex, _ := strconv.Atoi(keyPart)
+	return channelId, keyIndex
+}
+
+func bucketSeconds(setting *operation_setting.ChannelBreakerSetting) int64 {
+	seconds := int64(setting.WindowSeconds / channelBreakerBuckets)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+func (b *channelBreaker) counts(now int64, setting *operation_setting.ChannelBreakerSetting) (int, int) {
+	current := now / bucketSeconds(setting)
+	requests, failures := 0, 0
+	for _, bucket := range b.buckets {
+		if current-bucket.index < channelBreakerBuckets {
+			requests += bucket.success + bucket.failure
+			failures += bucket.failure
+		}
+	}
+	return requests, failures
+}
+
+func (b *channelBreaker) add(now int64, setting *operation_setting.ChannelBreakerSetting, success bool) {
+	current := now / bucketSeconds(setting)
+	bucket := &b.buckets[current%channelBreakerBuckets]
+	if bucket.index != current {
+		*bucket = channelBreakerBucket{index: current}
+	}
+	if success {
+		bucket.success++
+	} else {
+		bucket.failure++
+	}
+}
+
+func (b *channelBreaker) open(openedAt int64) {
+	b.state = ChannelBreakerStateOpen
+	b.openedAt = openedAt
+	b.probing = 0
+	b.probeSuccess = 0
+	b.consecutiveFailures = 0
+}
+
+func (b *channelBreaker) close() {
+	*b = channelBreaker{state: ChannelBreakerStateClosed}
+}
+
+// allow 熔断冷却结束后可以被选中用于探测，半开状态下只放行有限的探测请求；只做判断，不改变状态
+func (b *channelBreaker) allow(now int64, setting *operation_setting.ChannelBreakerSetting) bool {
+	switch b.state {
+	case ChannelBreakerStateOpen:
+		return now-b.openedAt >= int64(setting.CooldownSeconds)
+	case ChannelBreakerStateHalfOpen:
+		// 探测请求长时间没有结果（如客户端断开）时允许重新探测
+		return b.probing < setting.HalfOpenProbes || now-b.lastProbeAt >= int64(setting.CooldownSeconds)
+	}
+	return true
+}
+
+// acquire 实际选中时占用探测名额，冷却结束的熔断在此转为半开
+func (b *channelBreaker) acquire(now int64, setting *operation_setting.ChannelBreakerSetting) {
+	switch b.state {
+	case ChannelBreakerStateOpen:
+		if now-b.openedAt < int64(setting.CooldownSeconds) {
+			return
+		}
+		b.state = ChannelBreakerStateHalfOpen
+		b.probing = 0
+		b.probeSuccess = 0
+	case ChannelBreakerStateHalfOpen:
+		if now-b.lastProbeAt >= int64(setting.CooldownSeconds) {
+			b.probing = 0
+		}
+	default:
+		return
+	}
+	b.probing++
+	b.lastProbeAt = now
+}
+
+// record 记录请求结果，返回状态变化后的新状态，未变化时返回空
+func (b *channelBreaker) record(now int64, setting *operation_setting.ChannelBreakerSetting, success bool) string {
+	switch b.state {
+	case ChannelBreakerStateOpen:
+		// 熔断前已发出的请求，忽略
+		return ""
+	case ChannelBreakerStateHalfOpen:
+		if b.probing == 0 {
+			return ""
+		}
+		b.probing--
+		if !success {
+			b.open(now)
+			return ChannelBreakerStateOpen
+		}
+		b.probeSuccess++
+		if b.probeSuccess >= setting.HalfOpenProbes {
+			b.close()
+			return ChannelBreakerStateClosed
+		}
+		return ""
+	}
+	b.add(now, setting, success)
+	if success {
+		b.consecutiveFailures = 0
+		return ""
+	}
+	b.consecutiveFailures++
+	if setting.FailureThreshold > 0 && b.consecutiveFailures >= setting.FailureThreshold {
+		b.open(now)
+		return ChannelBreakerStateOpen
+	}
+	if setting.ErrorRateThreshold > 0 {
+		requests, failures := b.counts(now, setting)
+		if requests >= setting.MinRequests && float64(failures)/float64(requests) >= setting.ErrorRateThreshold {
+			b.open(now)
+			return ChannelBreakerStateOpen
+		}
+	}
+	return ""
+}
+
+func getChannelBreaker(key string) *channelBreaker {
+	b, ok := channelBreakers[key]
+	if !ok {
+		b = &channelBreaker{state: ChannelBreakerStateClosed}
+		channelBreakers[key] = b
+	}
+	return b
+}
+
+// ChannelBreakerAllow 渠道（keyIndex 为 -1）或密钥当前是否可以被选中
+func ChannelBreakerAllow(channelId int, keyIndex int) bool {
+	setting := operation_setting.GetChannelBreakerSetting()
+	if !setting.Enabled {
+		return true
+	}
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	b, ok := channelBreakers[channelBreakerKey(channelId, keyIndex)]
+	if !ok {
+		return true
+	}
+	return b.allow(time.Now().Unix(), setting)
+}
+
+// channelBreakerAvailable 渠道未熔断，多密钥渠道还需至少有一个启用的密钥未熔断
+func channelBreakerAvailable(channel *Channel) bool {
+	if !operation_setting.GetChannelBreakerSetting().Enabled {
+		return true
+	}
+	if !ChannelBreakerAllow(channel.Id, -1) {
+		return false
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return true
+	}
+	for _, i := range channel.enabledKeyIndexes() {
+		if ChannelBreakerAllow(channel.Id, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// channelBreakerAcquire 选中半开状态的渠道或密钥时占用一个探测名额
+func channelBreakerAcquire(channelId int, keyIndex int) {
+	setting := operation_setting.GetChannelBreakerSetting()
+	if !setting.Enabled {
+		return
+	}
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	if b, ok := channelBreakers[channelBreakerKey(channelId, keyIndex)]; ok {
+		b.acquire(time.Now().Unix(), setting)
+	}
+}
+
+// RecordChannelBreakerResult 记录渠道请求结果，多密钥渠道同时记录到所用密钥
+func RecordChannelBreakerResult(channelId int, keyIndex int, success bool) {
+	setting := operation_setting.GetChannelBreakerSetting()
+	if !setting.Enabled {
+		return
+	}
+	keys := []string{channelBreakerKey(channelId, -1)}
+	if keyIndex >= 0 {
+		keys = append(keys, channelBreakerKey(channelId, keyIndex))
+	}
+	now := time.Now().Unix()
+	transitions := make(map[string]string)
+	channelBreakerLock.Lock()
+	for _, key := range keys {
+		if state := getChannelBreaker(key).record(now, setting, success); state != "" {
+			transitions[key] = state
+		}
+	}
+	channelBreakerLock.Unlock()
+
+	for key, state := range transitions {
+		if state == ChannelBreakerStateOpen {
+			common.SysLog(fmt.Sprintf("channel breaker %s opened", key))
+		} else {
+			common.SysLog(fmt.Sprintf("channel breaker %s closed", key))
+		}
+		if !common.RedisEnabled {
+			continue
+		}
+		var err error
+		if state == ChannelBreakerStateOpen {
+			err = common.RedisHSet(channelBreakerRedisKey, key, now)
+		} else {
+			err = common.RedisHDel(channelBreakerRedisKey, key)
+		}
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to sync channel breaker %s: %s", key, err.Error()))
+		}
+	}
+}
+
+// GetChannelBreakerStatuses 获取渠道熔断状态，channelId 为 0 时返回全部渠道
+func GetChannelBreakerStatuses(channelId int) []ChannelBreakerStatus {
+	setting := operation_setting.GetChannelBreakerSetting()
+	now := time.Now().Unix()
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	statuses := make([]ChannelBreakerStatus, 0)
+	for key, b := range channelBreakers {
+		id, keyIndex := parseChannelBreakerKey(key)
+		if channelId != 0 && id != channelId {
+			continue
+		}
+		requests, failures := b.counts(now, setting)
+		status := ChannelBreakerStatus{
+			ChannelId:           id,
+			KeyIndex:            keyIndex,
+			State:               b.state,
+			Requests:            requests,
+			Failures:            failures,
+			ConsecutiveFailures: b.consecutiveFailures,
+		}
+		if requests > 0 {
+			status.ErrorRate = float64(failures) / float64(requests)
+		}
+		if b.state != ChannelBreakerStateClosed {
+			status.OpenedAt = b.openedAt
+			status.RetryAt = b.openedAt + int64(setting.CooldownSeconds)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].ChannelId != statuses[j].ChannelId {
+			return statuses[i].ChannelId < statuses[j].ChannelId
+		}
+		return statuses[i].KeyIndex < statuses[j].KeyIndex
+	})
+	return statuses
+}
+
+// ResetChannelBreaker 手动恢复渠道及其所有密钥的熔断状态
+func ResetChannelBreaker(channelId int) {
+	var keys []string
+	channelBreakerLock.Lock()
+	for key := range channelBreakers {
+		if id, _ := parseChannelBreakerKey(key); id == channelId {
+			keys = append(keys, key)
+			delete(channelBreakers, key)
+		}
+	}
+	channelBreakerLock.Unlock()
+	if common.RedisEnabled {
+		remote, err := common.RedisHGetAll(channelBreakerRedisKey)
+		if err == nil {
+			for key := range remote {
+				if id, _ := parseChannelBreakerKey(key); id == channelId {
+					keys = append(keys, key)
+				}
+			}
+		}
+		if len(keys) > 0 {
+			if err := common.RedisHDel(channelBreakerRedisKey, keys...); err != nil {
+				common.SysError(fmt.Sprintf("failed to reset channel breaker #%d: %s", channelId, err.Error()))
+			}
+		}
+	}
+}
+
+// SyncChannelBreakers 多节点部署时通过 Redis 同步熔断状态，错误率等统计仍由各节点独立计算
+func SyncChannelBreakers(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		if !operation_setting.GetChannelBreakerSetting().Enabled {
+			continue
+		}
+		remote, err := common.RedisHGetAll(channelBreakerRedisKey)
+		if err != nil {
+			common.SysError("failed to sync channel breakers: " + err.Error())
+			continue
+		}
+		channelBreakerLock.Lock()
+		for key, value := range remote {
+			openedAt, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			// 其它节点熔断或探测失败后重新熔断
+			b := getChannelBreaker(key)
+			if b.state == ChannelBreakerStateClosed || openedAt > b.openedAt {
+				b.open(openedAt)
+			}
+		}
+		for key, b := range channelBreakers {
+			// 其它节点探测成功后已恢复
+			if _, ok := remote[key]; !ok && b.state != ChannelBreakerStateClosed {
+				b.close()
+			}
+		}
+		channelBreakerLock.Unlock()
+	}
+}
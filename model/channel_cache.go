@@ -3,7 +3,6 @@ package model
 import (
 	"errors"
 	"fmt"
-	"math/rand"
 	"one-api/common"
 	"one-api/setting"
 	"sort"
@@ -79,20 +78,33 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, model string, retry int) (*Channel, string, error) {
+// CacheGetRandomSatisfiedChannel 选择可用渠道，跳过本次请求中已尝试过的渠道与密钥，
+// 当前优先级的渠道都已尝试过时按优先级从高到低依次使用下一级；会话绑定的渠道属于可用渠道中的最高优先级时优先使用
+func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, model string) (*Channel, string, error) {
 	var channel *Channel
 	var err error
 	selectGroup := group
+	tried := GetTriedChannels(c)
+	affinity := lookupChannelAffinity(c, group, model)
+	defer func() {
+		if c != nil {
+			setSelectedChannelAffinity(c, affinity, channel)
+		}
+	}()
 	if group == "auto" {
 		if len(setting.AutoGroups) == 0 {
 			return nil, selectGroup, errors.New("auto groups is not enabled")
 		}
+		saturated := false
 		for _, autoGroup := range setting.AutoGroups {
 			if common.DebugEnabled {
 				println("autoGroup:", autoGroup)
 			}
-			channel, _ = getRandomSatisfiedChannel(autoGroup, model, retry)
+			channel, err = getRandomSatisfiedChannel(autoGroup, model, tried, affinity.pinnedChannelId(autoGroup))
 			if channel == nil {
+				if errors.Is(err, ErrChannelSaturated) {
+					saturated = true
+				}
 				continue
 			} else {
 				c.Set("auto_group", autoGroup)
@@ -103,8 +115,11 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, model string,
 				break
 			}
 		}
+		if channel == nil && saturated {
+			return nil, group, ErrChannelSaturated
+		}
 	} else {
-		channel, err = getRandomSatisfiedChannel(group, model, retry)
+		channel, err = getRandomSatisfiedChannel(group, model, tried, affinity.pinnedChannelId(group))
 		if err != nil {
 			return nil, group, err
 		}
@@ -115,7 +130,7 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, model string,
 	return channel, selectGroup, nil
 }
 
-func getRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+func getRandomSatisfiedChannel(group string, model string, tried *TriedChannels, pinnedChannelId int) (*Channel, error) {
 	if strings.HasPrefix(model, "gpt-4-gizmo") {
 		model = "gpt-4-gizmo-*"
 	}
@@ -125,74 +140,77 @@ func getRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannel(group, model, retry)
+		return GetRandomSatisfiedChannel(group, model, tried, pinnedChannelId)
 	}
 
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
-	channels := group2model2channels[group][model]
+	channelIds := group2model2channels[group][model]
 
-	if len(channels) == 0 {
+	if len(channelIds) == 0 {
 		return nil, errors.New("channel not found")
 	}
 
-	if len(channels) == 1 {
-		if channel, ok := channelsIDM[channels[0]]; ok {
-			return channel, nil
+	channels := make([]*Channel, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		channel, ok := channelsIDM[channelId]
+		if !ok {
+			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
 		}
-		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channels[0])
+		channels = append(channels, channel)
 	}
+	return pickChannel(group, channels, tried, pinnedChannelId)
+}
 
-	uniquePriorities := make(map[int]bool)
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			uniquePriorities[int(channel.GetPriority())] = true
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+// pickChannel 排除已尝试过、熔断中、限流冷却中与达到并发上限的渠道后，会话绑定的渠道（pinnedChannelId）属于最高优先级时直接使用，
+// 否则在最高优先级的渠道中按策略选择；仅因限流冷却或并发上限而没有可用渠道时返回 ErrChannelSaturated，调用方可以排队等待
+func pickChannel(group string, channels []*Channel, tried *TriedChannels, pinnedChannelId int) (*Channel, error) {
+	available := make([]*Channel, 0, len(channels))
+	saturated := false
+	for _, channel := range channels {
+		if tried.Contains(channel) || !channelBreakerAvailable(channel) {
+			continue
+		}
+		if !channelCooldownAvailable(channel) || !channelInFlightAvailable(channel) {
+			saturated = true
+			continue
 		}
+		available = append(available, channel)
 	}
-	var sortedUniquePriorities []int
-	for priority := range uniquePriorities {
-		sortedUniquePriorities = append(sortedUniquePriorities, priority)
+	if len(available) == 0 {
+		if saturated {
+			return nil, ErrChannelSaturated
+		}
+		return nil, errors.New("no available channel, all channels have been tried, circuit broken or are cooling down")
 	}
-	sort.Sort(sort.Reverse(sort.IntSlice(sortedUniquePriorities)))
 
-	if retry >= len(uniquePriorities) {
-		retry = len(uniquePriorities) - 1
+	targetPriority := available[0].GetPriority()
+	for _, channel := range available {
+		if channel.GetPriority() > targetPriority {
+			targetPriority = channel.GetPriority()
+		}
 	}
-	targetPriority := int64(sortedUniquePriorities[retry])
-
-	// get the priority for the given retry number
 	var targetChannels []*Channel
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			if channel.GetPriority() == targetPriority {
-				targetChannels = append(targetChannels, channel)
-			}
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+	for _, channel := range available {
+		if channel.GetPriority() == targetPriority {
+			targetChannels = append(targetChannels, channel)
 		}
 	}
 
-	// 平滑系数
-	smoothingFactor := 10
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := 0
-	for _, channel := range targetChannels {
-		totalWeight += channel.GetWeight() + smoothingFactor
-	}
-	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
+	// 绑定的渠道只在最高优先级中生效，曾切换到低优先级渠道的会话在高优先级渠道恢复后回到高优先级
 	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight() + smoothingFactor
-		if randomWeight < 0 {
+		if channel.Id == pinnedChannelId {
+			channelBreakerAcquire(channel.Id, -1)
 			return channel, nil
 		}
 	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+
+	channel := selectChannel(group, targetChannels)
+	if channel == nil {
+		return nil, errors.New("channel not found")
+	}
+	channelBreakerAcquire(channel.Id, -1)
+	return channel, nil
 }
 
 func CacheGetChannel(id int) (*Channel, error) {
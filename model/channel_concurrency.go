@@ -0,0 +1,215 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/types"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrChannelSaturated 可用渠道都在限流冷却中或已达到并发上限
+var ErrChannelSaturated = errors.New("all available channels are rate limited or have reached their concurrency limit")
+
+// 启用 Redis 时以每个请求一条租约的有序集合在实例间共享计数，分数为占用时间；
+// 超过请求最长持续时间的租约视为实例异常退出后遗留，计数前回收
+const channelInFlightLeaseTTL = 30 * time.Minute
+
+const channelInFlightAcquireScript = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', tonumber(ARGV[1]) - tonumber(ARGV[2]))
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[4])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`
+
+// 渠道与密钥进行中的请求数，key 格式同熔断（channelId 或 channelId:keyIndex）；
+// 仅记录本实例在 Redis 不可用时本地占用的槽位
+var (
+	channelInFlight     = make(map[string]int)
+	channelInFlightLock sync.Mutex
+	// 有槽位释放时关闭并替换，用于唤醒排队的请求
+	channelSlotReleased = make(chan struct{})
+)
+
+// inFlightLease 一次占用的槽位，释放时回到占用时所在的存储
+type inFlightLease struct {
+	key   string
+	id    string
+	redis bool
+}
+
+func (channel *Channel) GetMaxInFlight() int {
+	if channel.MaxInFlight == nil {
+		return 0
+	}
+	return *channel.MaxInFlight
+}
+
+// GetKeyMaxInFlight 多 Key 渠道中指定密钥的并发上限，单独设置的优先
+func (channel *Channel) GetKeyMaxInFlight(index int) int {
+	if !channel.ChannelInfo.IsMultiKey {
+		return 0
+	}
+	if limit, ok := channel.ChannelInfo.MultiKeyMaxInFlight[index]; ok {
+		return limit
+	}
+	return channel.ChannelInfo.KeyMaxInFlight
+}
+
+func channelInFlightRedisKey(key string) string {
+	return "channel_in_flight:" + key
+}
+
+func getLocalChannelInFlight(key string) int {
+	channelInFlightLock.Lock()
+	defer channelInFlightLock.Unlock()
+	return channelInFlight[key]
+}
+
+// getChannelInFlight Redis 中未过期的租约数加上本实例本地占用的槽位数
+func getChannelInFlight(key string) int {
+	count := getLocalChannelInFlight(key)
+	if common.RedisEnabled {
+		minScore := strconv.FormatInt(time.Now().Add(-channelInFlightLeaseTTL).Unix(), 10)
+		redisCount, err := common.RDB.ZCount(context.Background(), channelInFlightRedisKey(key), "("+minScore, "+inf").Result()
+		if err == nil {
+			count += int(redisCount)
+		}
+	}
+	return count
+}
+
+func tryAcquireInFlight(key string, limit int) (*inFlightLease, bool) {
+	if limit <= 0 {
+		return nil, true
+	}
+	if common.RedisEnabled {
+		// 本地占用的槽位同样计入上限
+		redisLimit := limit - getLocalChannelInFlight(key)
+		leaseId := common.GetUUID()
+		result, err := common.RDB.Eval(context.Background(), channelInFlightAcquireScript, []string{channelInFlightRedisKey(key)},
+			time.Now().Unix(), int(channelInFlightLeaseTTL.Seconds()), redisLimit, leaseId).Int()
+		if err == nil {
+			if result != 1 {
+				return nil, false
+			}
+			return &inFlightLease{key: key, id: leaseId, redis: true}, true
+		}
+		common.SysError("failed to acquire channel in-flight slot from redis: " + err.Error())
+	}
+	channelInFlightLock.Lock()
+	defer channelInFlightLock.Unlock()
+	if channelInFlight[key] >= limit {
+		return nil, false
+	}
+	channelInFlight[key]++
+	return &inFlightLease{key: key}, true
+}
+
+func releaseInFlight(lease *inFlightLease) {
+	if lease.redis {
+		// 释放失败时租约超时后回收
+		if err := common.RDB.ZRem(context.Background(), channelInFlightRedisKey(lease.key), lease.id).Err(); err != nil {
+			common.SysError("failed to release channel in-flight slot from redis: " + err.Error())
+		}
+	}
+	channelInFlightLock.Lock()
+	defer channelInFlightLock.Unlock()
+	if !lease.redis {
+		if channelInFlight[lease.key] > 1 {
+			channelInFlight[lease.key]--
+		} else {
+			delete(channelInFlight, lease.key)
+		}
+	}
+	close(channelSlotReleased)
+	channelSlotReleased = make(chan struct{})
+}
+
+// ChannelSlotReleased 本实例有渠道或密钥释放槽位时关闭
+func ChannelSlotReleased() <-chan struct{} {
+	channelInFlightLock.Lock()
+	defer channelInFlightLock.Unlock()
+	return channelSlotReleased
+}
+
+func channelKeyInFlightAvailable(channel *Channel, index int) bool {
+	limit := channel.GetKeyMaxInFlight(index)
+	return limit <= 0 || getChannelInFlight(channelBreakerKey(channel.Id, index)) < limit
+}
+
+// channelInFlightAvailable 渠道未达到并发上限，多密钥渠道还需至少有一个启用的密钥未达到上限
+func channelInFlightAvailable(channel *Channel) bool {
+	if limit := channel.GetMaxInFlight(); limit > 0 && getChannelInFlight(channelBreakerKey(channel.Id, -1)) >= limit {
+		return false
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return true
+	}
+	for _, i := range channel.enabledKeyIndexes() {
+		if channelKeyInFlightAvailable(channel, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// channelSlot 一次请求占用的渠道与密钥槽位
+type channelSlot struct {
+	leases []*inFlightLease
+	once   sync.Once
+}
+
+func (s *channelSlot) release() {
+	s.once.Do(func() {
+		for _, lease := range s.leases {
+			releaseInFlight(lease)
+		}
+	})
+}
+
+// AcquireChannelSlot 占用渠道与密钥的并发槽位并保存到上下文，上下文之前占用的槽位先释放；达到上限时返回错误
+func AcquireChannelSlot(c *gin.Context, channel *Channel, keyIndex int) *types.NewAPIError {
+	ReleaseChannelSlot(c)
+	slot := &channelSlot{}
+	if limit := channel.GetMaxInFlight(); limit > 0 {
+		lease, ok := tryAcquireInFlight(channelBreakerKey(channel.Id, -1), limit)
+		if !ok {
+			return types.NewErrorWithStatusCode(fmt.Errorf("渠道 #%d 已达到并发上限 %d", channel.Id, limit), types.ErrorCodeChannelSaturated, 429)
+		}
+		slot.leases = append(slot.leases, lease)
+	}
+	if limit := channel.GetKeyMaxInFlight(keyIndex); limit > 0 {
+		lease, ok := tryAcquireInFlight(channelBreakerKey(channel.Id, keyIndex), limit)
+		if !ok {
+			slot.release()
+			return types.NewErrorWithStatusCode(fmt.Errorf("渠道 #%d 的第 %d 个密钥已达到并发上限 %d", channel.Id, keyIndex, limit), types.ErrorCodeChannelSaturated, 429)
+		}
+		slot.leases = append(slot.leases, lease)
+	}
+	if len(slot.leases) > 0 {
+		common.SetContextKey(c, constant.ContextKeyChannelInFlightSlot, slot)
+	}
+	return nil
+}
+
+// ReleaseChannelSlot 释放上下文占用的并发槽位，可重复调用
+func ReleaseChannelSlot(c *gin.Context) {
+	value, ok := common.GetContextKey(c, constant.ContextKeyChannelInFlightSlot)
+	if !ok {
+		return
+	}
+	if slot, ok := value.(*channelSlot); ok {
+		slot.release()
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelInFlightSlot, nil)
+}
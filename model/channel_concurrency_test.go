@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"one-api/common"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLocalInFlightLimit 测试未启用 Redis 时本地计数的并发上限
+func TestLocalInFlightLimit(t *testing.T) {
+	oldEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = oldEnabled })
+	key := "local-limit"
+	first, ok := tryAcquireInFlight(key, 2)
+	assert.True(t, ok)
+	_, ok = tryAcquireInFlight(key, 2)
+	assert.True(t, ok)
+	_, ok = tryAcquireInFlight(key, 2)
+	assert.False(t, ok, "达到上限后不应再获得槽位")
+	assert.Equal(t, 2, getChannelInFlight(key))
+
+	releaseInFlight(first)
+	assert.Equal(t, 1, getChannelInFlight(key))
+	_, ok = tryAcquireInFlight(key, 2)
+	assert.True(t, ok, "释放后应能再次获得槽位")
+}
+
+// TestRedisInFlightConcurrentLimit 测试并发占用时 Redis 租约不超过上限
+func TestRedisInFlightConcurrentLimit(t *testing.T) {
+	setupTestRedis(t)
+	key := "redis-concurrent"
+	const limit = 5
+
+	var granted int32
+	var wg sync.WaitGroup
+	leases := make(chan *inFlightLease, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lease, ok := tryAcquireInFlight(key, limit); ok {
+				atomic.AddInt32(&granted, 1)
+				leases <- lease
+			}
+		}()
+	}
+	wg.Wait()
+	close(leases)
+
+	assert.Equal(t, int32(limit), granted)
+	assert.Equal(t, limit, getChannelInFlight(key))
+	for lease := range leases {
+		assert.True(t, lease.redis)
+		releaseInFlight(lease)
+	}
+	assert.Equal(t, 0, getChannelInFlight(key))
+}
+
+// TestRedisInFlightReapsStaleLeases 测试实例异常退出遗留的过期租约在计数前被回收，且不会因持续请求而续期
+func TestRedisInFlightReapsStaleLeases(t *testing.T) {
+	mr := setupTestRedis(t)
+	key := "redis-stale"
+	staleScore := float64(time.Now().Add(-channelInFlightLeaseTTL - time.Minute).Unix())
+	_, err := mr.ZAdd(channelInFlightRedisKey(key), staleScore, "crashed-request")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, getChannelInFlight(key), "过期租约不应计入进行中的请求")
+	lease, ok := tryAcquireInFlight(key, 1)
+	assert.True(t, ok, "过期租约应被回收而不占用上限")
+	members, err := mr.ZMembers(channelInFlightRedisKey(key))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{lease.id}, members)
+
+	_, ok = tryAcquireInFlight(key, 1)
+	assert.False(t, ok)
+	releaseInFlight(lease)
+	_, ok = tryAcquireInFlight(key, 1)
+	assert.True(t, ok)
+}
+
+// TestInFlightReleaseOnGrantingBackend 测试槽位释放回占用时所在的存储，计数不会漂移或变为负数
+func TestInFlightReleaseOnGrantingBackend(t *testing.T) {
+	mr := setupTestRedis(t)
+	key := "backend-release"
+
+	// Redis 不可用时回退到本地计数
+	common.RedisEnabled = false
+	localLease, ok := tryAcquireInFlight(key, 2)
+	assert.True(t, ok)
+	assert.False(t, localLease.redis)
+
+	common.RedisEnabled = true
+	redisLease, ok := tryAcquireInFlight(key, 2)
+	assert.True(t, ok)
+	assert.True(t, redisLease.redis)
+	// 本地占用的槽位同样计入上限
+	_, ok = tryAcquireInFlight(key, 2)
+	assert.False(t, ok)
+
+	releaseInFlight(localLease)
+	assert.Equal(t, 0, getLocalChannelInFlight(key))
+	members, err := mr.ZMembers(channelInFlightRedisKey(key))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{redisLease.id}, members, "释放本地槽位不应影响 Redis 中的租约")
+
+	releaseInFlight(redisLease)
+	count, err := common.RDB.ZCard(context.Background(), channelInFlightRedisKey(key)).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, 0, getLocalChannelInFlight(key))
+}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"sync"
+	"time"
+)
+
+// 上游限流后暂停选择的渠道与密钥，key 格式同熔断（channelId 或 channelId:keyIndex），value 为恢复时间
+var (
+	channelCooldowns    = make(map[string]time.Time)
+	channelCooldownLock sync.Mutex
+)
+
+// SetChannelCooldown 在 duration 内不再选择该渠道（keyIndex 为 -1）或密钥，已有更晚的恢复时间时保留
+func SetChannelCooldown(channelId int, keyIndex int, duration time.Duration) {
+	setting := operation_setting.GetChannelCooldownSetting()
+	if !setting.Enabled || duration <= 0 {
+		return
+	}
+	if maxDuration := time.Duration(setting.MaxSeconds) * time.Second; maxDuration > 0 && duration > maxDuration {
+		duration = maxDuration
+	}
+	key := channelBreakerKey(channelId, keyIndex)
+	until := time.Now().Add(duration)
+	channelCooldownLock.Lock()
+	defer channelCooldownLock.Unlock()
+	if current, ok := channelCooldowns[key]; ok && current.After(until) {
+		return
+	}
+	channelCooldowns[key] = until
+	if common.DebugEnabled {
+		common.SysLog(fmt.Sprintf("channel %s cooling down for %s", key, duration))
+	}
+}
+
+// GetChannelCooldown 渠道或密钥剩余的冷却时间
+func GetChannelCooldown(channelId int, keyIndex int) time.Duration {
+	key := channelBreakerKey(channelId, keyIndex)
+	channelCooldownLock.Lock()
+	defer channelCooldownLock.Unlock()
+	until, ok := channelCooldowns[key]
+	if !ok {
+		return 0
+	}
+	remaining := time.Until(until)
+	if remaining <= 0 {
+		delete(channelCooldowns, key)
+		return 0
+	}
+	return remaining
+}
+
+// channelCooldownAvailable 渠道未在冷却中，多密钥渠道还需至少有一个启用的密钥未在冷却中
+func channelCooldownAvailable(channel *Channel) bool {
+	if GetChannelCooldown(channel.Id, -1) > 0 {
+		return false
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return true
+	}
+	for _, i := range channel.enabledKeyIndexes() {
+		if GetChannelCooldown(channel.Id, i) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelCooldown 渠道列表中展示的剩余冷却秒数
+type ChannelCooldown struct {
+	Remaining int64         `json:"remaining"`
+	Keys      map[int]int64 `json:"keys,omitempty"`
+}
+
+// FillChannelCooldowns 为渠道列表填充剩余冷却时间
+func FillChannelCooldowns(channels []*Channel) {
+	for _, channel := range channels {
+		if channel == nil {
+			continue
+		}
+		cooldown := &ChannelCooldown{}
+		if remaining := GetChannelCooldown(channel.Id, -1); remaining > 0 {
+			cooldown.Remaining = int64(remaining.Seconds()) + 1
+		}
+		if channel.ChannelInfo.IsMultiKey {
+			for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+				if remaining := GetChannelCooldown(channel.Id, i); remaining > 0 {
+					if cooldown.Keys == nil {
+						cooldown.Keys = make(map[int]int64)
+					}
+					cooldown.Keys[i] = int64(remaining.Seconds()) + 1
+				}
+			}
+		}
+		if cooldown.Remaining > 0 || len(cooldown.Keys) > 0 {
+			channel.Cooldown = cooldown
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"one-api/setting/operation_setting"
+)
+
+// 平滑系数，避免权重为 0 的渠道永远不被选中
+const channelWeightSmoothing = 10
+
+// ChannelSelector 在同一优先级的渠道中选择一个，stats 与 channels 按下标一一对应
+type ChannelSelector interface {
+	Select(channels []*Channel, stats []ChannelStats) *Channel
+}
+
+var channelSelectors = map[string]ChannelSelector{
+	operation_setting.ChannelSelectStrategyWeighted:      weightedSelector{},
+	operation_setting.ChannelSelectStrategyLatency:       latencySelector{},
+	operation_setting.ChannelSelectStrategyLeastRequests: leastRequestsSelector{},
+	operation_setting.ChannelSelectStrategyErrorPenalty:  errorPenaltySelector{},
+}
+
+// RegisterChannelSelector 注册自定义选择策略，需在 init 阶段调用
+func RegisterChannelSelector(name string, selector ChannelSelector) {
+	channelSelectors[name] = selector
+}
+
+// selectChannel 按分组配置的策略选择渠道，未知策略按权重随机
+func selectChannel(group string, channels []*Channel) *Channel {
+	if len(channels) == 0 {
+		return nil
+	}
+	if len(channels) == 1 {
+		return channels[0]
+	}
+	selector, ok := channelSelectors[operation_setting.GetGroupChannelSelectStrategy(group)]
+	if !ok {
+		selector = weightedSelector{}
+	}
+	stats := make([]ChannelStats, len(channels))
+	channelStatsLock.RLock()
+	for i, channel := range channels {
+		stats[i] = snapshotChannelStats(channel.Id)
+	}
+	channelStatsLock.RUnlock()
+	return selector.Select(channels, stats)
+}
+
+func baseWeight(channel *Channel) float64 {
+	return float64(channel.GetWeight() + channelWeightSmoothing)
+}
+
+func weightedRandom(channels []*Channel, weights []float64) *Channel {
+	totalWeight := 0.0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	if totalWeight <= 0 {
+		return channels[rand.Intn(len(channels))]
+	}
+	randomWeight := rand.Float64() * totalWeight
+	for i, channel := range channels {
+		randomWeight -= weights[i]
+		if randomWeight < 0 {
+			return channel
+		}
+	}
+	return channels[len(channels)-1]
+}
+
+type weightedSelector struct{}
+
+func (weightedSelector) Select(channels []*Channel, stats []ChannelStats) *Channel {
+	weights := make([]float64, len(channels))
+	for i, channel := range channels {
+		weights[i] = baseWeight(channel)
+	}
+	return weightedRandom(channels, weights)
+}
+
+// latencySelector 权重除以 EWMA 延迟，有首字延迟时优先使用；
+// 尚无统计的渠道按已知的最低延迟计算，保证新渠道能获得流量
+type latencySelector struct{}
+
+func (latencySelector) Select(channels []*Channel, stats []ChannelStats) *Channel {
+	latencies := make([]float64, len(channels))
+	minLatency := 0.0
+	for i := range channels {
+		latency := stats[i].FirstTokenLatency
+		if latency <= 0 {
+			latency = stats[i].Latency
+		}
+		latencies[i] = latency
+		if latency > 0 && (minLatency == 0 || latency < minLatency) {
+			minLatency = latency
+		}
+	}
+	if minLatency == 0 {
+		return weightedSelector{}.Select(channels, stats)
+	}
+	weights := make([]float64, len(channels))
+	for i, channel := range channels {
+		latency := latencies[i]
+		if latency <= 0 {
+			latency = minLatency
+		}
+		weights[i] = baseWeight(channel) / math.Max(latency, 1)
+	}
+	return weightedRandom(channels, weights)
+}
+
+// leastRequestsSelector 在进行中请求最少的渠道之间按权重随机
+type leastRequestsSelector struct{}
+
+func (leastRequestsSelector) Select(channels []*Channel, stats []ChannelStats) *Channel {
+	minOutstanding := -1
+	for i := range channels {
+		if minOutstanding < 0 || stats[i].Outstanding < minOutstanding {
+			minOutstanding = stats[i].Outstanding
+		}
+	}
+	var candidates []*Channel
+	var weights []float64
+	for i, channel := range channels {
+		if stats[i].Outstanding == minOutstanding {
+			candidates = append(candidates, channel)
+			weights = append(weights, baseWeight(channel))
+		}
+	}
+	return weightedRandom(candidates, weights)
+}
+
+// errorPenaltySelector 按 EWMA 错误率降低权重，最低保留 1% 以便渠道恢复后重新获得流量
+type errorPenaltySelector struct{}
+
+func (errorPenaltySelector) Select(channels []*Channel, stats []ChannelStats) *Channel {
+	penalty := operation_setting.GetChannelSelectSetting().ErrorPenalty
+	weights := make([]float64, len(channels))
+	for i, channel := range channels {
+		factor := math.Pow(1-stats[i].ErrorRate, penalty)
+		weights[i] = baseWeight(channel) * math.Max(factor, 0.01)
+	}
+	return weightedRandom(channels, weights)
+}
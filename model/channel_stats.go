@@ -0,0 +1,128 @@
+package model
+
+import (
+	"one-api/setting/operation_setting"
+	"sort"
+	"sync"
+	"time"
+)
+
+// channelStats 由实际转发请求统计的渠道实时指标
+type channelStats struct {
+	outstanding int
+	latency     float64
+	firstToken  float64
+	errorRate   float64
+	requests    int64
+	failures    int64
+	updatedAt   int64
+}
+
+// ChannelStats 渠道实时指标，延迟单位为毫秒
+type ChannelStats struct {
+	ChannelId         int     `json:"channel_id"`
+	Outstanding       int     `json:"outstanding"`
+	Latency           float64 `json:"latency"`
+	FirstTokenLatency float64 `json:"first_token_latency"`
+	ErrorRate         float64 `json:"error_rate"`
+	Requests          int64   `json:"requests"`
+	Failures          int64   `json:"failures"`
+	UpdatedAt         int64   `json:"updated_at"`
+}
+
+var (
+	channelStatsMap  = make(map[int]*channelStats)
+	channelStatsLock sync.RWMutex
+)
+
+func getChannelStats(channelId int) *channelStats {
+	stats, ok := channelStatsMap[channelId]
+	if !ok {
+		stats = &channelStats{}
+		channelStatsMap[channelId] = stats
+	}
+	return stats
+}
+
+func ewma(current float64, value float64, first bool) float64 {
+	if first {
+		return value
+	}
+	alpha := operation_setting.GetChannelSelectSetting().EWMAAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	return alpha*value + (1-alpha)*current
+}
+
+// AcquireChannelRequest 渠道开始处理请求
+func AcquireChannelRequest(channelId int) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	getChannelStats(channelId).outstanding++
+}
+
+// ReleaseChannelRequest 渠道请求结束
+func ReleaseChannelRequest(channelId int) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	stats := getChannelStats(channelId)
+	if stats.outstanding > 0 {
+		stats.outstanding--
+	}
+}
+
+// RecordChannelSuccess 记录成功请求的总耗时与首字耗时，为 0 表示未知
+func RecordChannelSuccess(channelId int, latency time.Duration, firstToken time.Duration) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	stats := getChannelStats(channelId)
+	if latency > 0 {
+		stats.latency = ewma(stats.latency, float64(latency.Milliseconds()), stats.latency == 0)
+	}
+	if firstToken > 0 {
+		stats.firstToken = ewma(stats.firstToken, float64(firstToken.Milliseconds()), stats.firstToken == 0)
+	}
+	stats.errorRate = ewma(stats.errorRate, 0, stats.requests == 0)
+	stats.requests++
+	stats.updatedAt = time.Now().Unix()
+}
+
+// RecordChannelFailure 记录上游原因导致的失败请求
+func RecordChannelFailure(channelId int) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	stats := getChannelStats(channelId)
+	stats.errorRate = ewma(stats.errorRate, 1, stats.requests == 0)
+	stats.requests++
+	stats.failures++
+	stats.updatedAt = time.Now().Unix()
+}
+
+func snapshotChannelStats(channelId int) ChannelStats {
+	snapshot := ChannelStats{ChannelId: channelId}
+	if stats, ok := channelStatsMap[channelId]; ok {
+		snapshot.Outstanding = stats.outstanding
+		snapshot.Latency = stats.latency
+		snapshot.FirstTokenLatency = stats.firstToken
+		snapshot.ErrorRate = stats.errorRate
+		snapshot.Requests = stats.requests
+		snapshot.Failures = stats.failures
+		snapshot.UpdatedAt = stats.updatedAt
+	}
+	return snapshot
+}
+
+// GetChannelStats 获取各渠道当前节点的实时指标
+func GetChannelStats() []ChannelStats {
+	channelStatsLock.RLock()
+	defer channelStatsLock.RUnlock()
+	result := make([]ChannelStats, 0, len(channelStatsMap))
+	for channelId := range channelStatsMap {
+		result = append(result, snapshotChannelStats(channelId))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ChannelId < result[j].ChannelId
+	})
+	return result
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"one-api/common"
+	"one-api/constant"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TriedChannels 本次请求中已尝试过的渠道，以及多密钥渠道已尝试过的密钥
+type TriedChannels struct {
+	Channels map[int]bool
+	Keys     map[int]map[int]bool
+}
+
+// AddTriedChannel 记录当前使用的渠道与密钥，use_channel 同时用于日志中的重试链路
+func AddTriedChannel(c *gin.Context, channelId int) {
+	useChannel := c.GetStringSlice("use_channel")
+	useChannel = append(useChannel, strconv.Itoa(channelId))
+	c.Set("use_channel", useChannel)
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+		useChannelKey := c.GetStringSlice("use_channel_key")
+		useChannelKey = append(useChannelKey, channelBreakerKey(channelId, keyIndex))
+		c.Set("use_channel_key", useChannelKey)
+	}
+}
+
+func GetTriedChannels(c *gin.Context) *TriedChannels {
+	tried := &TriedChannels{
+		Channels: make(map[int]bool),
+		Keys:     make(map[int]map[int]bool),
+	}
+	if c == nil {
+		return tried
+	}
+	for _, id := range c.GetStringSlice("use_channel") {
+		if channelId, err := strconv.Atoi(strings.TrimSpace(id)); err == nil {
+			tried.Channels[channelId] = true
+		}
+	}
+	for _, key := range c.GetStringSlice("use_channel_key") {
+		channelId, keyIndex := parseChannelBreakerKey(key)
+		if tried.Keys[channelId] == nil {
+			tried.Keys[channelId] = make(map[int]bool)
+		}
+		tried.Keys[channelId][keyIndex] = true
+	}
+	return tried
+}
+
+// Contains 渠道已尝试过；多密钥渠道需所有启用的密钥都已尝试过
+func (t *TriedChannels) Contains(channel *Channel) bool {
+	if t == nil || !t.Channels[channel.Id] {
+		return false
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return true
+	}
+	for _, i := range channel.enabledKeyIndexes() {
+		if !t.Keys[channel.Id][i] {
+			return false
+		}
+	}
+	return true
+}
+
+// KeysOf 渠道已尝试过的密钥下标
+func (t *TriedChannels) KeysOf(channelId int) map[int]bool {
+	if t == nil {
+		return nil
+	}
+	return t.Keys[channelId]
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"one-api/common"
+	"one-api/dto"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+// UpstreamFiles records the file id a stored file got on each upstream channel,
+// keyed by channel id (and key index for multi-key channels)
+type UpstreamFiles map[string]string
+
+// Value implements driver.Valuer interface
+func (u UpstreamFiles) Value() (driver.Value, error) {
+	return common.Marshal(u)
+}
+
+// Scan implements sql.Scanner interface
+func (u *UpstreamFiles) Scan(value interface{}) error {
+	bytesValue, _ := value.([]byte)
+	if len(bytesValue) == 0 {
+		if str, ok := value.(string); ok {
+			bytesValue = []byte(str)
+		}
+	}
+	if len(bytesValue) == 0 {
+		*u = UpstreamFiles{}
+		return nil
+	}
+	return common.Unmarshal(bytesValue, u)
+}
+
+type File struct {
+	Id            string         `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId        int            `json:"user_id" gorm:"index"`
+	TokenId       int            `json:"token_id" gorm:"index"`
+	Filename      string         `json:"filename" gorm:"type:varchar(255)"`
+	Purpose       string         `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes         int64          `json:"bytes" gorm:"bigint"`
+	MimeType      string         `json:"mime_type" gorm:"type:varchar(128)"`
+	StoragePath   string         `json:"-" gorm:"type:varchar(512)"`
+	Status        string         `json:"status" gorm:"type:varchar(20)"`
+	CreatedAt     int64          `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt     int64          `json:"expires_at" gorm:"bigint;default:0"` // 0 表示不过期
+	UpstreamFiles UpstreamFiles  `json:"-" gorm:"type:json"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+func (file *File) Delete() error {
+	return DB.Delete(file).Error
+}
+
+func (file *File) ToOpenAIFile() dto.OpenAIFile {
+	return dto.OpenAIFile{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		ExpiresAt: file.ExpiresAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+}
+
+func (file *File) IsExpired() bool {
+	return file.ExpiresAt != 0 && file.ExpiresAt < common.GetTimestamp()
+}
+
+func (file *File) GetUpstreamFileId(upstreamKey string) string {
+	if file.UpstreamFiles == nil {
+		return ""
+	}
+	return file.UpstreamFiles[upstreamKey]
+}
+
+// SetUpstreamFileId remembers the upstream id so later requests on the same channel reuse it
+func (file *File) SetUpstreamFileId(upstreamKey string, upstreamFileId string) error {
+	if file.UpstreamFiles == nil {
+		file.UpstreamFiles = UpstreamFiles{}
+	}
+	file.UpstreamFiles[upstreamKey] = upstreamFileId
+	return DB.Model(file).Update("upstream_files", file.UpstreamFiles).Error
+}
+
+// GetUserFileById returns the user's file, expired files are treated as not found even before the cleanup job removes them
+func GetUserFileById(id string, userId int) (*File, error) {
+	if id == "" || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	var file File
+	err := DB.Where("id = ? and user_id = ? and (expires_at = 0 or expires_at >= ?)", id, userId, common.GetTimestamp()).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserFiles lists files newest first, after is the id of the last file of the previous page
+func GetUserFiles(userId int, purpose string, after string, limit int) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		var afterFile File
+		if err := DB.Where("id = ? and user_id = ?", after, userId).First(&afterFile).Error; err == nil {
+			query = query.Where("created_at < ? or (created_at = ? and id < ?)", afterFile.CreatedAt, afterFile.CreatedAt, afterFile.Id)
+		}
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// SumUserFileBytes returns the storage currently used by the user, used for size quota;
+// expired files no longer count even before the cleanup job removes them
+func SumUserFileBytes(userId int) (int64, error) {
+	var total int64
+	err := DB.Model(&File{}).Where("user_id = ? and (expires_at = 0 or expires_at >= ?)", userId, common.GetTimestamp()).
+		Select("COALESCE(SUM(bytes), 0)").Scan(&total).Error
+	return total, err
+}
+
+// GetExpiredFiles returns up to limit files whose expiry has passed
+func GetExpiredFiles(limit int) ([]*File, error) {
+	var files []*File
+	err := DB.Where("expires_at <> 0 and expires_at < ?", common.GetTimestamp()).Order("expires_at").Limit(limit).Find(&files).Error
+	return files, err
+}
@@ -251,6 +251,14 @@ func migrateDB() error {
 		&QuotaData{},
 		&Task{},
 		&Setup{},
+		&File{},
+		&Batch{},
+		&BatchResult{},
+		&StoredResponse{},
+		&Plan{},
+		&Subscription{},
+		&UserSettlement{},
+		&SubscriptionCheckout{},
 	)
 	if err != nil {
 		return err
@@ -277,6 +285,14 @@ func migrateDBFast() error {
 		{&QuotaData{}, "QuotaData"},
 		{&Task{}, "Task"},
 		{&Setup{}, "Setup"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&BatchResult{}, "BatchResult"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&Plan{}, "Plan"},
+		{&Subscription{}, "Subscription"},
+		{&UserSettlement{}, "UserSettlement"},
+		{&SubscriptionCheckout{}, "SubscriptionCheckout"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// setupTestRedis 使用 miniredis 作为 Redis，测试结束后恢复原配置
+func setupTestRedis(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	oldRDB, oldEnabled := common.RDB, common.RedisEnabled
+	common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	common.RedisEnabled = true
+	t.Cleanup(func() {
+		common.RDB.Close()
+		common.RDB, common.RedisEnabled = oldRDB, oldEnabled
+	})
+	return mr
+}
+
+// setupTestDB 使用内存 sqlite 作为数据库（日志库与主库相同），测试结束后恢复原配置
+func setupTestDB(t *testing.T, models ...interface{}) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	// 单连接保证内存数据库在各 goroutine 间共享
+	sqlDB.SetMaxOpenConns(1)
+	assert.NoError(t, db.AutoMigrate(models...))
+	initCol()
+	oldDB, oldLogDB := DB, LOG_DB
+	DB, LOG_DB = db, db
+	t.Cleanup(func() {
+		sqlDB.Close()
+		DB, LOG_DB = oldDB, oldLogDB
+	})
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+)
+
+const (
+	PlanBillingPeriodMonth = "month"
+	PlanBillingPeriodYear  = "year"
+)
+
+// Plan 订阅套餐：每月发放 Quota 额度，订阅期间用户升级到 Group 分组；
+// 月付套餐在每次续费成功后发放，年付套餐在续费时发放第一个月，之后在订阅期内按月发放
+type Plan struct {
+	Id            int     `json:"id"`
+	Name          string  `json:"name" gorm:"index"`
+	Description   string  `json:"description"`
+	Price         float64 `json:"price"`                                    // 展示用的价格，实际扣款以 Stripe 价格为准
+	StripePriceId string  `json:"stripe_price_id" gorm:"type:varchar(255)"` // Stripe 中的周期性价格 id
+	Quota         int     `json:"quota"`                                    // 每月发放的额度
+	Group         string  `json:"group" gorm:"type:varchar(64);default:''"` // 订阅期间的用户分组，为空时不调整分组
+	BillingPeriod string  `json:"billing_period" gorm:"type:varchar(16);default:'month'"`
+	Enabled       bool    `json:"enabled"`
+	CreatedTime   int64   `json:"created_time" gorm:"bigint"`
+}
+
+// Validate 检查套餐配置是否有效
+func (plan *Plan) Validate() error {
+	if plan.Name == "" || len(plan.Name) > 64 {
+		return errors.New("套餐名称长度必须在1-64之间")
+	}
+	if plan.StripePriceId == "" {
+		return errors.New("套餐必须关联 Stripe 价格 id")
+	}
+	if plan.Quota < 0 {
+		return errors.New("套餐额度不能为负数")
+	}
+	if plan.Price < 0 {
+		return errors.New("套餐价格不能为负数")
+	}
+	if plan.BillingPeriod == "" {
+		plan.BillingPeriod = PlanBillingPeriodMonth
+	}
+	if plan.BillingPeriod != PlanBillingPeriodMonth && plan.BillingPeriod != PlanBillingPeriodYear {
+		return errors.New("计费周期只能为 month 或 year")
+	}
+	return nil
+}
+
+func GetAllPlans(enabledOnly bool) (plans []*Plan, err error) {
+	tx := DB.Order("price asc, id asc")
+	if enabledOnly {
+		tx = tx.Where("enabled = ?", true)
+	}
+	err = tx.Find(&plans).Error
+	return plans, err
+}
+
+func GetPlanById(id int) (*Plan, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	plan := Plan{Id: id}
+	err := DB.First(&plan, "id = ?", id).Error
+	return &plan, err
+}
+
+func (plan *Plan) Insert() error {
+	plan.CreatedTime = common.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+func (plan *Plan) Update() error {
+	return DB.Model(plan).Select("name", "description", "price", "stripe_price_id", "quota", "group", "billing_period", "enabled").Updates(plan).Error
+}
+
+// DeletePlanById 删除套餐，仍有生效中订阅的套餐只能停用
+func DeletePlanById(id int) error {
+	var count int64
+	err := DB.Model(&Subscription{}).Where("plan_id = ? AND status = ?", id, SubscriptionStatusActive).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该套餐仍有生效中的订阅，请先停用套餐")
+	}
+	return DB.Delete(&Plan{}, "id = ?", id).Error
+}
@@ -0,0 +1,260 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 按租期到期时间排序的预扣记录 id，回收任务从中取出到期的记录
+const quotaReservationIndexKey = "quota_reservations"
+
+// 每次回收的记录数上限
+const quotaReservationReapBatch = 100
+
+var (
+	ErrUserQuotaNotEnough  = errors.New("user quota is not enough")
+	ErrTokenQuotaNotEnough = errors.New("token quota is not enough")
+)
+
+// 在缓存的用户与令牌上原子地检查并扣减额度（用户余额可透支到授信额度），同时写入预扣记录；
+// 返回 -1 表示用户不在缓存中，-2 表示令牌不在缓存中，0 表示用户额度不足，2 表示令牌额度不足
+const quotaReserveScript = `
+local quota = tonumber(ARGV[1])
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+if KEYS[2] ~= '' and redis.call('EXISTS', KEYS[2]) == 0 then
+	return -2
+end
+local credit = tonumber(redis.call('HGET', KEYS[1], 'CreditLimit') or '0')
+if tonumber(redis.call('HGET', KEYS[1], 'Quota') or '0') + credit < quota then
+	return 0
+end
+if KEYS[2] ~= '' and ARGV[2] == '1' and tonumber(redis.call('HGET', KEYS[2], 'RemainQuota') or '0') < quota then
+	return 2
+end
+redis.call('HINCRBY', KEYS[1], 'Quota', -quota)
+if KEYS[2] ~= '' then
+	redis.call('HINCRBY', KEYS[2], 'RemainQuota', -quota)
+end
+redis.call('HSET', KEYS[3], 'user_id', ARGV[3], 'token_id', ARGV[4], 'user_key', KEYS[1], 'token_key', KEYS[2], 'quota', quota)
+redis.call('ZADD', KEYS[4], ARGV[5], KEYS[3])
+return 1
+`
+
+// 删除预扣记录，refund 为 1 时将额度退还到缓存的用户与令牌上；
+// 返回记录中的用户 id、令牌 id 与额度，记录已不存在时返回空
+const quotaReleaseScript = `
+redis.call('ZREM', KEYS[2], KEYS[1])
+local fields = redis.call('HMGET', KEYS[1], 'user_id', 'token_id', 'user_key', 'token_key', 'quota')
+if not fields[5] then
+	return {}
+end
+redis.call('DEL', KEYS[1])
+if ARGV[1] == '1' then
+	if redis.call('EXISTS', fields[3]) == 1 then
+		redis.call('HINCRBY', fields[3], 'Quota', fields[5])
+	end
+	if fields[4] ~= '' and redis.call('EXISTS', fields[4]) == 1 then
+		redis.call('HINCRBY', fields[4], 'RemainQuota', fields[5])
+	end
+end
+return {fields[1], fields[2], fields[5]}
+`
+
+// QuotaReservationEnabled 启用 Redis 且开启了预留账本
+func QuotaReservationEnabled() bool {
+	return common.RedisEnabled && operation_setting.GetQuotaReservationLease() > 0
+}
+
+func quotaReservationKey(id string) string {
+	return "quota_reservation:" + id
+}
+
+// ReserveQuota 在 Redis 中原子地检查并预扣用户与令牌（tokenId 为 0 时只预扣用户）的额度，数据库按原有方式扣减，
+// checkToken 为 false 时不检查令牌余额（无限额度令牌）。用户或令牌不在缓存中时先从数据库加载；
+// 返回的预扣记录 id 在结算时通过 ReleaseQuotaReservation 释放
+func ReserveQuota(userId int, tokenId int, tokenKey string, quota int, checkToken bool) (string, error) {
+	if quota < 0 {
+		return "", errors.New("quota 不能为负数！")
+	}
+	id := common.GetUUID()
+	userKey := getUserCacheKey(userId)
+	var tokenCacheKeyName string
+	if tokenId > 0 {
+		tokenCacheKeyName = tokenCacheKey(tokenKey)
+	}
+	check := "0"
+	if checkToken {
+		check = "1"
+	}
+	deadline := time.Now().Add(operation_setting.GetQuotaReservationLease()).Unix()
+	var result int
+	// 用户与令牌都不在缓存中时需要分别加载一次
+	for attempt := 0; attempt < 3; attempt++ {
+		var err error
+		result, err = common.RDB.Eval(context.Background(), quotaReserveScript,
+			[]string{userKey, tokenCacheKeyName, quotaReservationKey(id), quotaReservationIndexKey},
+			quota, check, userId, tokenId, deadline).Int()
+		if err != nil {
+			return "", fmt.Errorf("failed to reserve quota from redis: %w", err)
+		}
+		if result == -1 {
+			err = loadUserQuotaCache(userId)
+		} else if result == -2 {
+			err = loadTokenQuotaCache(tokenKey)
+		} else {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	switch result {
+	case 0:
+		return "", ErrUserQuotaNotEnough
+	case 2:
+		return "", ErrTokenQuotaNotEnough
+	case 1:
+	default:
+		return "", fmt.Errorf("failed to reserve quota from redis: unexpected result %d", result)
+	}
+	if err := persistQuotaDelta(userId, tokenId, -quota); err != nil {
+		// 数据库未扣减，只退还缓存中的额度
+		_, _ = evalQuotaRelease(id, true)
+		return "", err
+	}
+	return id, nil
+}
+
+// loadUserQuotaCache 用户不在缓存中时同步地从数据库加载，保证预扣在缓存上进行
+func loadUserQuotaCache(userId int) error {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	return updateUserCache(*user)
+}
+
+func loadTokenQuotaCache(key string) error {
+	token, err := GetTokenByKey(key, true)
+	if err != nil {
+		return err
+	}
+	return cacheSetToken(*token)
+}
+
+// persistQuotaDelta 将已在缓存上完成的额度变化写入数据库（或批量更新），delta 为负数表示扣减
+func persistQuotaDelta(userId int, tokenId int, delta int) error {
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeUserQuota, userId, delta)
+		if tokenId > 0 {
+			addNewRecord(BatchUpdateTypeTokenQuota, tokenId, delta)
+		}
+		return nil
+	}
+	var err error
+	if delta < 0 {
+		err = decreaseUserQuota(userId, -delta)
+	} else {
+		err = increaseUserQuota(userId, delta)
+	}
+	if err != nil || tokenId <= 0 {
+		return err
+	}
+	if delta < 0 {
+		return decreaseTokenQuota(tokenId, -delta)
+	}
+	return increaseTokenQuota(tokenId, delta)
+}
+
+// evalQuotaRelease 删除预扣记录，refund 时退还缓存中的额度；返回记录中的用户 id、令牌 id 与额度，记录已不存在时返回空
+func evalQuotaRelease(id string, refund bool) ([]string, error) {
+	flag := "0"
+	if refund {
+		flag = "1"
+	}
+	values, err := common.RDB.Eval(context.Background(), quotaReleaseScript,
+		[]string{quotaReservationKey(id), quotaReservationIndexKey}, flag).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	return values, nil
+}
+
+// releaseQuotaReservation 删除预扣记录，refund 时同时退还缓存与数据库中的额度；记录已被释放或回收时返回 false
+func releaseQuotaReservation(id string, refund bool) (bool, error) {
+	values, err := evalQuotaRelease(id, refund)
+	if err != nil {
+		return false, err
+	}
+	if len(values) != 3 {
+		return false, nil
+	}
+	if refund {
+		userId, _ := strconv.Atoi(values[0])
+		tokenId, _ := strconv.Atoi(values[1])
+		quota, _ := strconv.Atoi(values[2])
+		if err = persistQuotaDelta(userId, tokenId, quota); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// ReleaseQuotaReservation 请求结算时释放预扣记录，额度的差额仍按原有方式多退少补；
+// 返回 false 表示记录已被回收任务退还，调用方应按未预扣处理
+func ReleaseQuotaReservation(id string) bool {
+	if id == "" || !common.RedisEnabled {
+		return false
+	}
+	held, err := releaseQuotaReservation(id, false)
+	if err != nil {
+		// 无法确认时按未被回收处理，避免重复扣费
+		common.SysError("failed to release quota reservation: " + err.Error())
+		return true
+	}
+	return held
+}
+
+// ReapQuotaReservations 定期退还租期已过的预扣记录（实例在请求过程中崩溃遗留的记录）
+func ReapQuotaReservations() {
+	for {
+		time.Sleep(time.Duration(max(operation_setting.GetQuotaReservationSetting().ReapIntervalSeconds, 1)) * time.Second)
+		if !QuotaReservationEnabled() {
+			continue
+		}
+		reapQuotaReservations(time.Now())
+	}
+}
+
+// reapQuotaReservations 退还租期在 now 之前到期的预扣记录，多个实例同时执行时每条记录只退还一次
+func reapQuotaReservations(now time.Time) {
+	keys, err := common.RDB.ZRangeByScore(context.Background(), quotaReservationIndexKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Unix(), 10),
+		Count: quotaReservationReapBatch,
+	}).Result()
+	if err != nil {
+		common.SysError("failed to list expired quota reservations: " + err.Error())
+		return
+	}
+	for _, key := range keys {
+		id := key[len(quotaReservationKey("")):]
+		reaped, err := releaseQuotaReservation(id, true)
+		if err != nil {
+			common.SysError("failed to reap quota reservation: " + err.Error())
+			continue
+		}
+		if reaped {
+			common.SysLog(fmt.Sprintf("quota reservation %s expired, quota returned", id))
+		}
+	}
+}
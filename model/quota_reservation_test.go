@@ -0,0 +1,167 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupQuotaReservation 启用预留账本，并创建指定额度的用户与令牌
+func setupQuotaReservation(t *testing.T, userQuota int, tokenQuota int) (*User, *Token) {
+	setupTestDB(t, &User{}, &Token{})
+	setupTestRedis(t)
+	oldBatch := common.BatchUpdateEnabled
+	common.BatchUpdateEnabled = false
+	setting := operation_setting.GetQuotaReservationSetting()
+	oldEnabled := setting.Enabled
+	setting.Enabled = true
+	t.Cleanup(func() {
+		common.BatchUpdateEnabled = oldBatch
+		setting.Enabled = oldEnabled
+	})
+	assert.True(t, QuotaReservationEnabled())
+
+	user := &User{Username: "reserve", Quota: userQuota, Status: common.UserStatusEnabled}
+	assert.NoError(t, DB.Create(user).Error)
+	token := &Token{
+		UserId:      user.Id,
+		Key:         common.GetRandomString(48),
+		Name:        "reserve",
+		RemainQuota: tokenQuota,
+	}
+	assert.NoError(t, DB.Create(token).Error)
+	return user, token
+}
+
+// getReservationQuota 返回缓存与数据库中的用户额度和令牌剩余额度
+func getReservationQuota(t *testing.T, user *User, token *Token) (cachedUser, cachedToken, dbUser, dbToken int) {
+	var err error
+	cachedUser, err = getUserQuotaCache(user.Id)
+	assert.NoError(t, err)
+	cached, err := cacheGetTokenByKey(token.Key)
+	assert.NoError(t, err)
+	var u User
+	assert.NoError(t, DB.First(&u, user.Id).Error)
+	var tk Token
+	assert.NoError(t, DB.First(&tk, token.Id).Error)
+	return cachedUser, cached.RemainQuota, u.Quota, tk.RemainQuota
+}
+
+// TestQuotaReservationDefaultOff 测试预留账本默认关闭，即使启用了 Redis
+func TestQuotaReservationDefaultOff(t *testing.T) {
+	setupTestRedis(t)
+	assert.False(t, operation_setting.GetQuotaReservationSetting().Enabled)
+	assert.False(t, QuotaReservationEnabled())
+}
+
+// TestQuotaReservationReserveAndSettle 测试预扣同时扣减缓存与数据库，结算时只释放一次记录
+func TestQuotaReservationReserveAndSettle(t *testing.T) {
+	user, token := setupQuotaReservation(t, 1000, 500)
+
+	id, err := ReserveQuota(user.Id, token.Id, token.Key, 300, true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+	cachedUser, cachedToken, dbUser, dbToken := getReservationQuota(t, user, token)
+	assert.Equal(t, 700, cachedUser)
+	assert.Equal(t, 200, cachedToken)
+	assert.Equal(t, 700, dbUser)
+	assert.Equal(t, 200, dbToken)
+
+	assert.True(t, ReleaseQuotaReservation(id))
+	assert.False(t, ReleaseQuotaReservation(id), "记录只能释放一次")
+	// 结算释放记录不退还额度，差额由调用方多退少补
+	cachedUser, cachedToken, dbUser, dbToken = getReservationQuota(t, user, token)
+	assert.Equal(t, 700, cachedUser)
+	assert.Equal(t, 200, cachedToken)
+	assert.Equal(t, 700, dbUser)
+	assert.Equal(t, 200, dbToken)
+}
+
+// TestQuotaReservationReap 测试租期已过的预扣记录被回收并退还额度，之后的结算按未预扣处理
+func TestQuotaReservationReap(t *testing.T) {
+	user, token := setupQuotaReservation(t, 1000, 500)
+
+	expired, err := ReserveQuota(user.Id, token.Id, token.Key, 300, true)
+	assert.NoError(t, err)
+	active, err := ReserveQuota(user.Id, token.Id, token.Key, 100, true)
+	assert.NoError(t, err)
+
+	// 租期内的记录不回收
+	reapQuotaReservations(time.Now())
+	cachedUser, _, _, _ := getReservationQuota(t, user, token)
+	assert.Equal(t, 600, cachedUser)
+
+	// 只让第一条记录过期
+	assert.NoError(t, common.RDB.ZAdd(context.Background(), quotaReservationIndexKey, &redis.Z{
+		Score:  float64(time.Now().Add(-time.Minute).Unix()),
+		Member: quotaReservationKey(expired),
+	}).Err())
+	reapQuotaReservations(time.Now())
+	cachedUser, cachedToken, dbUser, dbToken := getReservationQuota(t, user, token)
+	assert.Equal(t, 900, cachedUser)
+	assert.Equal(t, 400, cachedToken)
+	assert.Equal(t, 900, dbUser)
+	assert.Equal(t, 400, dbToken)
+
+	// 再次回收不会重复退还
+	reapQuotaReservations(time.Now())
+	cachedUser, _, dbUser, _ = getReservationQuota(t, user, token)
+	assert.Equal(t, 900, cachedUser)
+	assert.Equal(t, 900, dbUser)
+
+	assert.False(t, ReleaseQuotaReservation(expired), "已回收的记录结算时应按未预扣处理")
+	assert.True(t, ReleaseQuotaReservation(active))
+}
+
+// TestQuotaReservationConcurrentUserLimit 测试并发预扣不超过用户额度加授信额度
+func TestQuotaReservationConcurrentUserLimit(t *testing.T) {
+	user, token := setupQuotaReservation(t, 800, 0)
+	assert.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("credit_limit", 200).Error)
+
+	var granted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ReserveQuota(user.Id, token.Id, token.Key, 100, false)
+			if err == nil {
+				atomic.AddInt32(&granted, 1)
+				return
+			}
+			assert.True(t, errors.Is(err, ErrUserQuotaNotEnough), err.Error())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(10), granted)
+	cachedUser, _, dbUser, _ := getReservationQuota(t, user, token)
+	assert.Equal(t, -200, cachedUser, "最多透支到授信额度")
+	assert.Equal(t, -200, dbUser)
+}
+
+// TestQuotaReservationTokenLimit 测试令牌额度不足时不预扣，无限额度令牌不检查令牌余额
+func TestQuotaReservationTokenLimit(t *testing.T) {
+	user, token := setupQuotaReservation(t, 1000, 150)
+
+	_, err := ReserveQuota(user.Id, token.Id, token.Key, 100, true)
+	assert.NoError(t, err)
+	_, err = ReserveQuota(user.Id, token.Id, token.Key, 100, true)
+	assert.ErrorIs(t, err, ErrTokenQuotaNotEnough)
+	cachedUser, cachedToken, dbUser, dbToken := getReservationQuota(t, user, token)
+	assert.Equal(t, 900, cachedUser, "令牌额度不足时用户额度不应被扣减")
+	assert.Equal(t, 50, cachedToken)
+	assert.Equal(t, 900, dbUser)
+	assert.Equal(t, 50, dbToken)
+
+	_, err = ReserveQuota(user.Id, token.Id, token.Key, 100, false)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"one-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StoredResponse 网关保存的 Responses API 会话状态，用于 previous_response_id 与 GET/DELETE /v1/responses/:id
+type StoredResponse struct {
+	Id                 string          `json:"id" gorm:"type:varchar(128);primaryKey"`
+	UserId             int             `json:"user_id" gorm:"index"`
+	TokenId            int             `json:"token_id" gorm:"index"`
+	Model              string          `json:"model" gorm:"type:varchar(255)"`
+	PreviousResponseId string          `json:"previous_response_id" gorm:"type:varchar(128);default:''"`  // 上一轮 response，完整会话沿此链重建
+	ConversationId     string          `json:"conversation_id" gorm:"type:varchar(128);index;default:''"` // 会话第一轮的 id，同一会话的各轮一次查出
+	Input              json.RawMessage `json:"input" gorm:"type:json"`                                    // 本轮新增的输入 items
+	Output             json.RawMessage `json:"output" gorm:"type:json"`                                   // 本轮输出 items
+	Response           json.RawMessage `json:"response" gorm:"type:json"`                                 // 返回给客户端的完整 response 对象
+	CreatedAt          int64           `json:"created_at" gorm:"bigint"`
+	ExpiresAt          int64           `json:"expires_at" gorm:"bigint;index;default:0"` // 0 表示不过期
+}
+
+// 一个会话最多加载的轮数，防止异常数据导致无限回溯
+const maxStoredResponseChainDepth = 1000
+
+// 每次清理的过期会话数量
+const expiredStoredResponseBatch = 1000
+
+// Save 上游可能返回重复的 id，以最后一次为准
+func (response *StoredResponse) Save() error {
+	return DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(response).Error
+}
+
+// Delete 删除会话中的一轮，之后的轮次改为接在上一轮之后，会话去掉这一轮的输入与输出后继续可用
+func (response *StoredResponse) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&StoredResponse{}).Where("previous_response_id = ? and token_id = ?", response.Id, response.TokenId).
+			Update("previous_response_id", response.PreviousResponseId).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(response).Error
+	})
+}
+
+func (response *StoredResponse) IsExpired() bool {
+	return response.ExpiresAt != 0 && response.ExpiresAt < common.GetTimestamp()
+}
+
+// GetTokenStoredResponse 只有创建该 response 的令牌可以读取
+func GetTokenStoredResponse(id string, tokenId int) (*StoredResponse, error) {
+	if id == "" || tokenId == 0 {
+		return nil, errors.New("id 或 tokenId 为空！")
+	}
+	var response StoredResponse
+	err := DB.Where("id = ? and token_id = ?", id, tokenId).First(&response).Error
+	if err != nil {
+		return nil, err
+	}
+	if response.IsExpired() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &response, nil
+}
+
+// GetTokenStoredResponseChain 从 id 开始沿 previous_response_id 回溯整个会话，按从早到晚的顺序返回。
+// 会话的各轮按 conversation_id 一次查出，过期只看 id 这一轮，之前的轮次随会话保留；
+// 链中缺失某一轮时返回错误
+func GetTokenStoredResponseChain(id string, tokenId int) ([]*StoredResponse, error) {
+	head, err := GetTokenStoredResponse(id, tokenId)
+	if err != nil {
+		return nil, err
+	}
+	if head.PreviousResponseId == "" {
+		return []*StoredResponse{head}, nil
+	}
+	var responses []*StoredResponse
+	err = DB.Where("conversation_id = ? and token_id = ? and created_at <= ?", head.ConversationId, tokenId, head.CreatedAt).
+		Order("created_at desc").Limit(maxStoredResponseChainDepth).Find(&responses).Error
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]*StoredResponse, len(responses))
+	for _, response := range responses {
+		byId[response.Id] = response
+	}
+	chain := []*StoredResponse{head}
+	for previousId := head.PreviousResponseId; previousId != ""; {
+		previous, ok := byId[previousId]
+		if !ok || len(chain) >= maxStoredResponseChainDepth {
+			return nil, errors.New("response 会话链异常")
+		}
+		// 已加入链中，避免环
+		delete(byId, previousId)
+		chain = append(chain, previous)
+		previousId = previous.PreviousResponseId
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// DeleteExpiredStoredResponses 会话最后一轮过期后删除整个会话
+func DeleteExpiredStoredResponses() (int64, error) {
+	var deleted int64
+	for {
+		var conversationIds []string
+		err := DB.Model(&StoredResponse{}).Group("conversation_id").
+			Having("max(expires_at) < ? and min(expires_at) > 0", common.GetTimestamp()).
+			Limit(expiredStoredResponseBatch).Pluck("conversation_id", &conversationIds).Error
+		if err != nil {
+			return deleted, err
+		}
+		if len(conversationIds) == 0 {
+			return deleted, nil
+		}
+		result := DB.Where("conversation_id in ?", conversationIds).Delete(&StoredResponse{})
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if len(conversationIds) < expiredStoredResponseBatch {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"encoding/json"
+	"one-api/common"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// saveTurns 保存同一会话的多轮 response，依次接在上一轮之后
+func saveTurns(t *testing.T, tokenId int, expiresAt int64, ids ...string) {
+	previousId := ""
+	for i, id := range ids {
+		response := &StoredResponse{
+			Id:                 id,
+			TokenId:            tokenId,
+			PreviousResponseId: previousId,
+			ConversationId:     ids[0],
+			Input:              json.RawMessage(`[]`),
+			Output:             json.RawMessage(`[]`),
+			Response:           json.RawMessage(`{}`),
+			CreatedAt:          int64(1000 + i),
+			ExpiresAt:          expiresAt,
+		}
+		assert.NoError(t, response.Save())
+		previousId = id
+	}
+}
+
+func chainIds(chain []*StoredResponse) []string {
+	ids := make([]string, 0, len(chain))
+	for _, response := range chain {
+		ids = append(ids, response.Id)
+	}
+	return ids
+}
+
+// TestStoredResponseChain 测试按会话加载整条链，只看最后一轮是否过期，且只能读取本令牌的会话
+func TestStoredResponseChain(t *testing.T) {
+	setupTestDB(t, &StoredResponse{})
+	now := common.GetTimestamp()
+	saveTurns(t, 1, now+3600, "resp_1", "resp_2", "resp_3")
+	// 同一会话的另一分支不影响回溯
+	assert.NoError(t, (&StoredResponse{Id: "resp_2b", TokenId: 1, PreviousResponseId: "resp_1", ConversationId: "resp_1", CreatedAt: 1001}).Save())
+
+	chain, err := GetTokenStoredResponseChain("resp_3", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resp_1", "resp_2", "resp_3"}, chainIds(chain))
+
+	// 之前的轮次已过期，会话最后一轮未过期时仍可继续
+	assert.NoError(t, DB.Model(&StoredResponse{}).Where("id in ?", []string{"resp_1", "resp_2"}).Update("expires_at", now-1).Error)
+	chain, err = GetTokenStoredResponseChain("resp_3", 1)
+	assert.NoError(t, err)
+	assert.Len(t, chain, 3)
+
+	_, err = GetTokenStoredResponseChain("resp_3", 2)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+// TestStoredResponseDeleteMiddle 测试删除中间一轮后，之后的轮次接在上一轮之后继续
+func TestStoredResponseDeleteMiddle(t *testing.T) {
+	setupTestDB(t, &StoredResponse{})
+	saveTurns(t, 1, 0, "resp_1", "resp_2", "resp_3")
+
+	middle, err := GetTokenStoredResponse("resp_2", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, middle.Delete())
+	chain, err := GetTokenStoredResponseChain("resp_3", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resp_1", "resp_3"}, chainIds(chain))
+
+	// 删除第一轮后会话仍按原 conversation_id 加载
+	first, err := GetTokenStoredResponse("resp_1", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, first.Delete())
+	chain, err = GetTokenStoredResponseChain("resp_3", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resp_3"}, chainIds(chain))
+}
+
+// TestDeleteExpiredStoredResponses 测试会话最后一轮过期后整个会话被删除，未过期与永久保留的会话保留
+func TestDeleteExpiredStoredResponses(t *testing.T) {
+	setupTestDB(t, &StoredResponse{})
+	now := common.GetTimestamp()
+	saveTurns(t, 1, now-10, "expired_1", "expired_2")
+	saveTurns(t, 1, now-10, "alive_1", "alive_2")
+	assert.NoError(t, DB.Model(&StoredResponse{}).Where("id = ?", "alive_2").Update("expires_at", now+3600).Error)
+	saveTurns(t, 1, 0, "forever_1")
+
+	count, err := DeleteExpiredStoredResponses()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	var ids []string
+	assert.NoError(t, DB.Model(&StoredResponse{}).Order("id").Pluck("id", &ids).Error)
+	assert.Equal(t, []string{"alive_1", "alive_2", "forever_1"}, ids)
+}
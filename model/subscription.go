@@ -0,0 +1,357 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SubscriptionStatusActive   = "active"
+	SubscriptionStatusCanceled = "canceled"
+)
+
+// 未收到 Stripe 取消通知时，订阅在周期结束后超过该时长仍未续费即视为失效
+const subscriptionLapseGrace = 3 * 24 * time.Hour
+
+// ErrSubscriptionDuplicate 用户已有其它生效中的订阅
+var ErrSubscriptionDuplicate = errors.New("用户已有生效中的订阅")
+
+// errSubscriptionRenewed 账单已被并发处理的通知发放过额度
+var errSubscriptionRenewed = errors.New("subscription already renewed")
+
+// Subscription 用户的 Stripe 订阅，每张已支付的账单发放一次套餐额度
+type Subscription struct {
+	Id                   int    `json:"id"`
+	UserId               int    `json:"user_id" gorm:"index"`
+	PlanId               int    `json:"plan_id" gorm:"index"`
+	StripeSubscriptionId string `json:"stripe_subscription_id" gorm:"type:varchar(255);uniqueIndex"`
+	StripeCustomerId     string `json:"stripe_customer_id" gorm:"type:varchar(255)"`
+	Status               string `json:"status" gorm:"type:varchar(16);index"`
+	PreviousGroup        string `json:"previous_group" gorm:"type:varchar(64)"` // 订阅前的用户分组，失效时恢复
+	CurrentPeriodStart   int64  `json:"current_period_start" gorm:"bigint"`
+	CurrentPeriodEnd     int64  `json:"current_period_end" gorm:"bigint"`
+	GrantedMonths        int    `json:"granted_months" gorm:"default:0"`          // 当前计费周期已发放额度的月数，年付套餐按此逐月发放
+	LastInvoiceId        string `json:"last_invoice_id" gorm:"type:varchar(255)"` // 最近一次发放额度的账单，用于防止重复发放
+	CreatedTime          int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime          int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// SubscriptionCheckout 用户尚未完成的订阅结账会话，每个用户只保留一个，避免多次结账产生多个订阅
+type SubscriptionCheckout struct {
+	UserId    int    `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	PlanId    int    `json:"plan_id"`
+	SessionId string `json:"session_id" gorm:"type:varchar(255);index"`
+	Url       string `json:"url" gorm:"type:text"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint"`
+}
+
+func GetSubscriptionCheckout(userId int) (*SubscriptionCheckout, error) {
+	var checkout SubscriptionCheckout
+	err := DB.Where("user_id = ?", userId).First(&checkout).Error
+	if err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+// SaveSubscriptionCheckout 记录用户的结账会话，替换之前的记录
+func SaveSubscriptionCheckout(checkout *SubscriptionCheckout) error {
+	return DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(checkout).Error
+}
+
+// DeleteSubscriptionCheckout 结账会话完成或过期后移除记录
+func DeleteSubscriptionCheckout(sessionId string) error {
+	return DB.Where("session_id = ?", sessionId).Delete(&SubscriptionCheckout{}).Error
+}
+
+// SubscriptionRenewal 一张已支付的订阅账单
+type SubscriptionRenewal struct {
+	StripeSubscriptionId string
+	StripeCustomerId     string
+	InvoiceId            string
+	PeriodStart          int64
+	PeriodEnd            int64
+	// 以下取自订阅创建时写入的 metadata，仅在本地尚无订阅记录时使用
+	UserId int
+	PlanId int
+}
+
+func GetActiveSubscriptionByUserId(userId int) (*Subscription, error) {
+	var subscription Subscription
+	err := DB.Where("user_id = ? AND status = ?", userId, SubscriptionStatusActive).Order("id desc").First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func GetUserSubscriptions(userId int) (subscriptions []*Subscription, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// RenewSubscription 处理一张已支付的订阅账单：首次支付时创建订阅记录，发放套餐一个月的额度并将用户升级到套餐分组；
+// 同一张账单（或更早周期的账单）重复通知时不会重复发放，此时返回 false；
+// 用户已有其它生效中的订阅时返回 ErrSubscriptionDuplicate，不发放额度
+func RenewSubscription(renewal *SubscriptionRenewal) (bool, error) {
+	if renewal.StripeSubscriptionId == "" || renewal.InvoiceId == "" {
+		return false, errors.New("未提供订阅或账单 id")
+	}
+	var plan *Plan
+	var userId int
+	var granted bool
+	var group string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		subscription := &Subscription{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("stripe_subscription_id = ?", renewal.StripeSubscriptionId).First(subscription).Error
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if renewal.UserId == 0 || renewal.PlanId == 0 {
+				return errors.New("订阅记录不存在，且账单中缺少用户或套餐信息")
+			}
+			subscription = &Subscription{
+				UserId:               renewal.UserId,
+				PlanId:               renewal.PlanId,
+				StripeSubscriptionId: renewal.StripeSubscriptionId,
+				CreatedTime:          common.GetTimestamp(),
+			}
+		} else if subscription.LastInvoiceId == renewal.InvoiceId || renewal.PeriodEnd <= subscription.CurrentPeriodEnd {
+			return nil
+		}
+		if subscription.Status != SubscriptionStatusActive {
+			var count int64
+			err = tx.Model(&Subscription{}).Where("user_id = ? AND status = ? AND stripe_subscription_id <> ?",
+				subscription.UserId, SubscriptionStatusActive, renewal.StripeSubscriptionId).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrSubscriptionDuplicate
+			}
+		}
+		plan = &Plan{}
+		if err = tx.First(plan, "id = ?", subscription.PlanId).Error; err != nil {
+			return fmt.Errorf("套餐 %d 不存在", subscription.PlanId)
+		}
+		user := &User{}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, subscription.UserId).Error
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"quota": gorm.Expr("quota + ?", plan.Quota)}
+		if renewal.StripeCustomerId != "" {
+			updates["stripe_customer"] = renewal.StripeCustomerId
+		}
+		if plan.Group != "" && user.Group != plan.Group {
+			// 重新生效的订阅同样记录当前分组，失效时恢复
+			subscription.PreviousGroup = user.Group
+			updates["group"] = plan.Group
+			group = plan.Group
+		}
+		if err = tx.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error; err != nil {
+			return err
+		}
+		previousInvoiceId := subscription.LastInvoiceId
+		subscription.Status = SubscriptionStatusActive
+		subscription.StripeCustomerId = renewal.StripeCustomerId
+		subscription.CurrentPeriodStart = renewal.PeriodStart
+		if subscription.CurrentPeriodStart == 0 {
+			subscription.CurrentPeriodStart = common.GetTimestamp()
+		}
+		subscription.CurrentPeriodEnd = renewal.PeriodEnd
+		subscription.GrantedMonths = 1
+		subscription.LastInvoiceId = renewal.InvoiceId
+		subscription.UpdatedTime = common.GetTimestamp()
+		if subscription.Id == 0 {
+			// 并发处理首张账单时唯一索引冲突，失败的通知由 Stripe 重试时按已处理跳过
+			if err = tx.Create(subscription).Error; err != nil {
+				return err
+			}
+		} else {
+			// 以读取时的账单为条件更新，不支持行锁的数据库上并发处理同一张账单时只有一个事务生效
+			result := tx.Model(subscription).Where("last_invoice_id = ?", previousInvoiceId).Select("*").Updates(subscription)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errSubscriptionRenewed
+			}
+		}
+		userId = user.Id
+		granted = true
+		return nil
+	})
+	if errors.Is(err, errSubscriptionRenewed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("订阅续费失败，%w", err)
+	}
+	if !granted {
+		return false, nil
+	}
+	if err = cacheIncrUserQuota(userId, int64(plan.Quota)); err != nil {
+		common.SysError("failed to increase user quota cache: " + err.Error())
+	}
+	if group != "" {
+		if err = updateUserGroupCache(userId, group); err != nil {
+			common.SysError("failed to update user group cache: " + err.Error())
+		}
+	}
+	RecordLog(userId, LogTypeTopup, fmt.Sprintf("订阅套餐 %s 续费成功，发放额度 %s", plan.Name, common.LogQuota(plan.Quota)))
+	return true, nil
+}
+
+// LapseSubscription 订阅被取消或到期未续费时将其标记为失效，并在用户仍处于套餐分组时恢复订阅前的分组
+func LapseSubscription(stripeSubscriptionId string) error {
+	var subscription *Subscription
+	var group string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		subscription = &Subscription{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("stripe_subscription_id = ?", stripeSubscriptionId).First(subscription).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 被拒绝的重复订阅取消后本地没有记录
+			subscription = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if subscription.Status != SubscriptionStatusActive {
+			subscription = nil
+			return nil
+		}
+		// 以生效状态为条件更新，重复的取消通知并发处理时只调整一次分组
+		result := tx.Model(&Subscription{}).Where("id = ? AND status = ?", subscription.Id, SubscriptionStatusActive).
+			Updates(map[string]interface{}{"status": SubscriptionStatusCanceled, "updated_time": common.GetTimestamp()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			subscription = nil
+			return nil
+		}
+		plan := &Plan{}
+		err = tx.First(plan, "id = ?", subscription.PlanId).Error
+		if err != nil || plan.Group == "" {
+			// 套餐已删除或不调整分组时，保留用户当前分组
+			return nil
+		}
+		user := &User{}
+		if err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, subscription.UserId).Error; err != nil {
+			return err
+		}
+		if user.Group != plan.Group {
+			// 管理员已手动调整过分组
+			return nil
+		}
+		group = subscription.PreviousGroup
+		if group == "" {
+			group = "default"
+		}
+		return tx.Model(&User{}).Where("id = ?", user.Id).Update("group", group).Error
+	})
+	if err != nil {
+		return err
+	}
+	if subscription == nil {
+		return nil
+	}
+	if group != "" {
+		if err = updateUserGroupCache(subscription.UserId, group); err != nil {
+			common.SysError("failed to update user group cache: " + err.Error())
+		}
+	}
+	RecordLog(subscription.UserId, LogTypeSystem, fmt.Sprintf("订阅 %s 已失效", stripeSubscriptionId))
+	return nil
+}
+
+// LapseExpiredSubscriptions 定期将周期结束后超过宽限期仍未续费的订阅标记为失效，兜底处理丢失的取消通知；
+// 同时为年付套餐发放到期的月度额度
+func LapseExpiredSubscriptions() {
+	for {
+		lapseExpiredSubscriptions(time.Now())
+		grantDueSubscriptionQuotas(time.Now())
+		time.Sleep(time.Hour)
+	}
+}
+
+func lapseExpiredSubscriptions(now time.Time) {
+	var subscriptions []*Subscription
+	deadline := now.Add(-subscriptionLapseGrace).Unix()
+	err := DB.Where("status = ? AND current_period_end < ?", SubscriptionStatusActive, deadline).Find(&subscriptions).Error
+	if err != nil {
+		common.SysError("failed to list expired subscriptions: " + err.Error())
+		return
+	}
+	for _, subscription := range subscriptions {
+		if err = LapseSubscription(subscription.StripeSubscriptionId); err != nil {
+			common.SysError("failed to lapse subscription: " + err.Error())
+		}
+	}
+}
+
+// grantDueSubscriptionQuotas 为年付套餐的生效订阅发放到期的月度额度，每月在计费周期开始日发放，错过的月份一并补发
+func grantDueSubscriptionQuotas(now time.Time) {
+	var subscriptions []*Subscription
+	err := DB.Where("status = ? AND granted_months > 0 AND current_period_end > current_period_start", SubscriptionStatusActive).
+		Find(&subscriptions).Error
+	if err != nil {
+		common.SysError("failed to list subscriptions for monthly grants: " + err.Error())
+		return
+	}
+	for _, subscription := range subscriptions {
+		plan, err := GetPlanById(subscription.PlanId)
+		if err != nil || plan.BillingPeriod != PlanBillingPeriodYear {
+			continue
+		}
+		for {
+			due := time.Unix(subscription.CurrentPeriodStart, 0).AddDate(0, subscription.GrantedMonths, 0)
+			if due.After(now) || due.Unix() >= subscription.CurrentPeriodEnd {
+				break
+			}
+			granted, err := grantSubscriptionMonth(subscription, plan)
+			if err != nil {
+				common.SysError("failed to grant subscription quota: " + err.Error())
+			}
+			if !granted {
+				break
+			}
+			subscription.GrantedMonths++
+		}
+	}
+}
+
+// grantSubscriptionMonth 发放订阅下一个月的额度，订阅已续费、失效或已被其它实例发放时返回 false
+func grantSubscriptionMonth(subscription *Subscription, plan *Plan) (bool, error) {
+	granted := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Subscription{}).
+			Where("id = ? AND status = ? AND current_period_start = ? AND granted_months = ?",
+				subscription.Id, SubscriptionStatusActive, subscription.CurrentPeriodStart, subscription.GrantedMonths).
+			Updates(map[string]interface{}{
+				"granted_months": subscription.GrantedMonths + 1,
+				"updated_time":   common.GetTimestamp(),
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		granted = true
+		return tx.Model(&User{}).Where("id = ?", subscription.UserId).Update("quota", gorm.Expr("quota + ?", plan.Quota)).Error
+	})
+	if err != nil || !granted {
+		return false, err
+	}
+	if err = cacheIncrUserQuota(subscription.UserId, int64(plan.Quota)); err != nil {
+		common.SysError("failed to increase user quota cache: " + err.Error())
+	}
+	RecordLog(subscription.UserId, LogTypeTopup, fmt.Sprintf("订阅套餐 %s 第 %d 个月额度发放 %s", plan.Name, subscription.GrantedMonths+1, common.LogQuota(plan.Quota)))
+	return true, nil
+}
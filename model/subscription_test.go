@@ -0,0 +1,283 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupSubscription 创建套餐与默认分组的用户
+func setupSubscription(t *testing.T, billingPeriod string) (*User, *Plan) {
+	setupTestDB(t, &User{}, &Log{}, &Plan{}, &Subscription{}, &SubscriptionCheckout{})
+	oldEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = oldEnabled })
+
+	user := &User{Username: "subscriber", Group: "default", Status: common.UserStatusEnabled}
+	assert.NoError(t, DB.Create(user).Error)
+	plan := &Plan{Name: "pro", StripePriceId: "price_pro", Quota: 100, Group: "vip", BillingPeriod: billingPeriod, Enabled: true}
+	assert.NoError(t, plan.Insert())
+	return user, plan
+}
+
+func getSubscriber(t *testing.T, id int) *User {
+	var user User
+	assert.NoError(t, DB.First(&user, id).Error)
+	return &user
+}
+
+func getSubscription(t *testing.T, stripeSubscriptionId string) *Subscription {
+	var subscription Subscription
+	assert.NoError(t, DB.Where("stripe_subscription_id = ?", stripeSubscriptionId).First(&subscription).Error)
+	return &subscription
+}
+
+// TestRenewSubscriptionIdempotent 测试同一张账单或更早周期的账单重复通知时不重复发放额度
+func TestRenewSubscriptionIdempotent(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	now := time.Now()
+	first := &SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		StripeCustomerId:     "cus_1",
+		InvoiceId:            "in_1",
+		PeriodStart:          now.Unix(),
+		PeriodEnd:            now.AddDate(0, 1, 0).Unix(),
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	}
+	granted, err := RenewSubscription(first)
+	assert.NoError(t, err)
+	assert.True(t, granted)
+	subscriber := getSubscriber(t, user.Id)
+	assert.Equal(t, 100, subscriber.Quota)
+	assert.Equal(t, "vip", subscriber.Group)
+
+	// 同一张账单重复通知
+	granted, err = RenewSubscription(first)
+	assert.NoError(t, err)
+	assert.False(t, granted)
+	// 不同账单但周期未超过已发放的周期
+	granted, err = RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_old",
+		PeriodEnd:            first.PeriodEnd,
+	})
+	assert.NoError(t, err)
+	assert.False(t, granted)
+	assert.Equal(t, 100, getSubscriber(t, user.Id).Quota)
+
+	// 下一周期的账单
+	granted, err = RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_2",
+		PeriodStart:          first.PeriodEnd,
+		PeriodEnd:            now.AddDate(0, 2, 0).Unix(),
+	})
+	assert.NoError(t, err)
+	assert.True(t, granted)
+	assert.Equal(t, 200, getSubscriber(t, user.Id).Quota)
+	subscription := getSubscription(t, "sub_1")
+	assert.Equal(t, "in_2", subscription.LastInvoiceId)
+	assert.Equal(t, "default", subscription.PreviousGroup)
+}
+
+// TestRenewSubscriptionConcurrent 测试同一张账单并发通知时只发放一次
+func TestRenewSubscriptionConcurrent(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	renewal := &SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_1",
+		PeriodEnd:            time.Now().AddDate(0, 1, 0).Unix(),
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = RenewSubscription(renewal)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, getSubscriber(t, user.Id).Quota)
+}
+
+// TestRenewSubscriptionRejectsSecond 测试用户已有生效中的订阅时拒绝另一个订阅的账单
+func TestRenewSubscriptionRejectsSecond(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	periodEnd := time.Now().AddDate(0, 1, 0).Unix()
+	_, err := RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_1",
+		PeriodEnd:            periodEnd,
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	})
+	assert.NoError(t, err)
+
+	granted, err := RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_2",
+		InvoiceId:            "in_2",
+		PeriodEnd:            periodEnd,
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	})
+	assert.False(t, granted)
+	assert.True(t, errors.Is(err, ErrSubscriptionDuplicate))
+	assert.Equal(t, 100, getSubscriber(t, user.Id).Quota)
+	var count int64
+	assert.NoError(t, DB.Model(&Subscription{}).Where("user_id = ?", user.Id).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// 重复订阅被取消时本地没有记录
+	assert.NoError(t, LapseSubscription("sub_2"))
+	assert.Equal(t, SubscriptionStatusActive, getSubscription(t, "sub_1").Status)
+}
+
+// TestLapseSubscriptionRestoresGroup 测试订阅失效时恢复订阅前的分组，管理员手动调整过的分组保持不变
+func TestLapseSubscriptionRestoresGroup(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	assert.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("group", "svip").Error)
+	_, err := RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_1",
+		PeriodEnd:            time.Now().AddDate(0, 1, 0).Unix(),
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "vip", getSubscriber(t, user.Id).Group)
+
+	assert.NoError(t, LapseSubscription("sub_1"))
+	assert.Equal(t, "svip", getSubscriber(t, user.Id).Group)
+	assert.Equal(t, SubscriptionStatusCanceled, getSubscription(t, "sub_1").Status)
+	// 重复的取消通知不再调整分组
+	assert.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("group", "vip").Error)
+	assert.NoError(t, LapseSubscription("sub_1"))
+	assert.Equal(t, "vip", getSubscriber(t, user.Id).Group)
+}
+
+// TestLapseExpiredSubscriptions 测试周期结束超过宽限期仍未续费的订阅失效并恢复分组
+func TestLapseExpiredSubscriptions(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	periodEnd := time.Now().AddDate(0, 1, 0)
+	_, err := RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_1",
+		PeriodEnd:            periodEnd.Unix(),
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	})
+	assert.NoError(t, err)
+
+	// 宽限期内不失效
+	lapseExpiredSubscriptions(periodEnd.Add(time.Hour))
+	assert.Equal(t, SubscriptionStatusActive, getSubscription(t, "sub_1").Status)
+	assert.Equal(t, "vip", getSubscriber(t, user.Id).Group)
+
+	lapseExpiredSubscriptions(periodEnd.Add(subscriptionLapseGrace + time.Hour))
+	assert.Equal(t, SubscriptionStatusCanceled, getSubscription(t, "sub_1").Status)
+	assert.Equal(t, "default", getSubscriber(t, user.Id).Group)
+}
+
+// TestYearlySubscriptionMonthlyGrants 测试年付套餐续费时发放第一个月，之后按月补发且不重复发放
+func TestYearlySubscriptionMonthlyGrants(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodYear)
+	now := time.Now()
+	periodStart := now.AddDate(0, -3, -1)
+	_, err := RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_1",
+		PeriodStart:          periodStart.Unix(),
+		PeriodEnd:            periodStart.AddDate(1, 0, 0).Unix(),
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, getSubscriber(t, user.Id).Quota)
+
+	// 多个实例同时发放时每个月只发放一次
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			grantDueSubscriptionQuotas(now)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 400, getSubscriber(t, user.Id).Quota)
+	assert.Equal(t, 4, getSubscription(t, "sub_1").GrantedMonths)
+
+	// 整个计费周期最多发放 12 个月
+	grantDueSubscriptionQuotas(periodStart.AddDate(2, 0, 0))
+	assert.Equal(t, 1200, getSubscriber(t, user.Id).Quota)
+	assert.Equal(t, 12, getSubscription(t, "sub_1").GrantedMonths)
+}
+
+// TestMonthlySubscriptionNoExtraGrants 测试月付套餐只在续费时发放
+func TestMonthlySubscriptionNoExtraGrants(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	periodStart := time.Now().AddDate(0, 0, -20)
+	_, err := RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_1",
+		PeriodStart:          periodStart.Unix(),
+		PeriodEnd:            periodStart.AddDate(0, 1, 0).Unix(),
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	})
+	assert.NoError(t, err)
+	grantDueSubscriptionQuotas(periodStart.AddDate(0, 2, 0))
+	assert.Equal(t, 100, getSubscriber(t, user.Id).Quota)
+}
+
+// TestSubscriptionCheckout 测试每个用户只保留一个结账会话
+func TestSubscriptionCheckout(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	assert.NoError(t, SaveSubscriptionCheckout(&SubscriptionCheckout{UserId: user.Id, PlanId: plan.Id, SessionId: "cs_1", Url: "https://checkout/1"}))
+	assert.NoError(t, SaveSubscriptionCheckout(&SubscriptionCheckout{UserId: user.Id, PlanId: plan.Id, SessionId: "cs_2", Url: "https://checkout/2"}))
+	checkout, err := GetSubscriptionCheckout(user.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "cs_2", checkout.SessionId)
+
+	// 已被替换的会话过期时不影响当前会话
+	assert.NoError(t, DeleteSubscriptionCheckout("cs_1"))
+	_, err = GetSubscriptionCheckout(user.Id)
+	assert.NoError(t, err)
+	assert.NoError(t, DeleteSubscriptionCheckout("cs_2"))
+	_, err = GetSubscriptionCheckout(user.Id)
+	assert.Error(t, err)
+}
+
+// TestLapseSubscriptionConcurrent 测试重复的取消通知并发处理时只恢复一次分组
+func TestLapseSubscriptionConcurrent(t *testing.T) {
+	user, plan := setupSubscription(t, PlanBillingPeriodMonth)
+	_, err := RenewSubscription(&SubscriptionRenewal{
+		StripeSubscriptionId: "sub_1",
+		InvoiceId:            "in_1",
+		PeriodEnd:            time.Now().AddDate(0, 1, 0).Unix(),
+		UserId:               user.Id,
+		PlanId:               plan.Id,
+	})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, LapseSubscription("sub_1"))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "default", getSubscriber(t, user.Id).Group)
+	var count int64
+	assert.NoError(t, DB.Model(&Log{}).Where("user_id = ? AND type = ?", user.Id, LogTypeSystem).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
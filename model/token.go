@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"one-api/common"
 	"strings"
+	"time"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -26,6 +27,15 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	BudgetPeriod       string         `json:"budget_period" gorm:"type:varchar(16);default:''"` // daily/weekly/monthly，空为不启用周期预算
+	BudgetResetDay     int            `json:"budget_reset_day" gorm:"default:0"`                // 每周重置为星期几（0-6），每月重置为几号（1-28）
+	BudgetResetHour    int            `json:"budget_reset_hour" gorm:"default:0"`               // 重置时刻（0-23 点）
+	PeriodQuotaLimit   int            `json:"period_quota_limit" gorm:"default:0"`              // 每个周期的额度上限，0 为只统计不限制
+	PeriodUsedQuota    int            `json:"period_used_quota" gorm:"default:0"`
+	PeriodStartTime    int64          `json:"period_start_time" gorm:"bigint;default:0"`
+	PeriodResetTime    int64          `json:"period_reset_time" gorm:"-"` // 下次重置时间，仅用于展示
+	RpmLimit           int            `json:"rpm_limit" gorm:"default:0"` // 每分钟请求数上限，0 为不限制
+	TpmLimit           int            `json:"tpm_limit" gorm:"default:0"` // 每分钟 token 数上限，0 为不限制
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -109,6 +119,9 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			keySuffix := key[len(key)-3:]
 			return token, errors.New(fmt.Sprintf("[sk-%s***%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", keyPrefix, keySuffix, token.RemainQuota))
 		}
+		if token.IsPeriodQuotaExhausted() {
+			return token, fmt.Errorf("该令牌本周期额度已用尽，将于 %s 重置", time.Unix(token.PeriodResetTime, 0).Format("2006-01-02 15:04:05"))
+		}
 		return token, nil
 	}
 	return nil, errors.New("无效的令牌")
@@ -184,7 +197,9 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group",
+		"budget_period", "budget_reset_day", "budget_reset_hour", "period_quota_limit",
+		"rpm_limit", "tpm_limit").Updates(token).Error
 	return err
 }
 
@@ -0,0 +1,293 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TokenBudgetPeriodDaily   = "daily"
+	TokenBudgetPeriodWeekly  = "weekly"
+	TokenBudgetPeriodMonthly = "monthly"
+)
+
+// 在缓存的令牌上原子地预留周期额度：周期已过时先重置；返回 -1 表示令牌不在缓存中，0 表示超出上限
+const tokenPeriodReserveScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+local start = tonumber(redis.call('HGET', KEYS[1], 'PeriodStartTime') or '0')
+if start < tonumber(ARGV[1]) then
+	redis.call('HSET', KEYS[1], 'PeriodStartTime', ARGV[1], 'PeriodUsedQuota', 0)
+end
+local used = tonumber(redis.call('HGET', KEYS[1], 'PeriodUsedQuota') or '0')
+local limit = tonumber(ARGV[2])
+if limit > 0 and used + tonumber(ARGV[3]) > limit then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], 'PeriodUsedQuota', ARGV[3])
+return 1
+`
+
+// 调整缓存的令牌的周期已用额度，退还时不低于 0；缓存中已是之后的周期时不再调整，返回 -1 表示令牌不在缓存中
+const tokenPeriodAdjustScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+local start = tonumber(redis.call('HGET', KEYS[1], 'PeriodStartTime') or '0')
+if start > tonumber(ARGV[1]) then
+	return 0
+end
+if start < tonumber(ARGV[1]) then
+	redis.call('HSET', KEYS[1], 'PeriodStartTime', ARGV[1], 'PeriodUsedQuota', 0)
+end
+local used = tonumber(redis.call('HGET', KEYS[1], 'PeriodUsedQuota') or '0') + tonumber(ARGV[2])
+if used < 0 then
+	used = 0
+end
+redis.call('HSET', KEYS[1], 'PeriodUsedQuota', used)
+return 1
+`
+
+// tokenPeriodDelta 等待批量写入数据库的周期已用额度变化
+type tokenPeriodDelta struct {
+	periodStart int64
+	quota       int
+}
+
+var (
+	tokenPeriodDeltas     = make(map[int]tokenPeriodDelta)
+	tokenPeriodDeltasLock sync.Mutex
+)
+
+func IsValidTokenBudgetPeriod(period string) bool {
+	switch period {
+	case "", TokenBudgetPeriodDaily, TokenBudgetPeriodWeekly, TokenBudgetPeriodMonthly:
+		return true
+	}
+	return false
+}
+
+// ValidateTokenBudget 检查令牌的周期预算配置
+func (token *Token) ValidateTokenBudget() error {
+	if !IsValidTokenBudgetPeriod(token.BudgetPeriod) {
+		return fmt.Errorf("无效的预算周期 %s", token.BudgetPeriod)
+	}
+	if token.PeriodQuotaLimit < 0 {
+		return errors.New("周期额度上限不能为负数")
+	}
+	if token.RpmLimit < 0 || token.TpmLimit < 0 {
+		return errors.New("每分钟请求数与 token 数上限不能为负数")
+	}
+	if token.BudgetResetHour < 0 || token.BudgetResetHour > 23 {
+		return errors.New("重置时刻必须在 0 到 23 之间")
+	}
+	switch token.BudgetPeriod {
+	case TokenBudgetPeriodWeekly:
+		if token.BudgetResetDay < 0 || token.BudgetResetDay > 6 {
+			return errors.New("每周重置日必须在 0（周日）到 6（周六）之间")
+		}
+	case TokenBudgetPeriodMonthly:
+		if token.BudgetResetDay < 1 || token.BudgetResetDay > 28 {
+			return errors.New("每月重置日必须在 1 到 28 之间")
+		}
+	}
+	return nil
+}
+
+// HasBudgetPeriod 令牌启用了周期预算
+func (token *Token) HasBudgetPeriod() bool {
+	return token.BudgetPeriod != ""
+}
+
+// currentPeriodStart 按服务器时区计算 now 所在周期的开始时间
+func (token *Token) currentPeriodStart(now time.Time) time.Time {
+	start := time.Date(now.Year(), now.Month(), now.Day(), token.BudgetResetHour, 0, 0, 0, now.Location())
+	switch token.BudgetPeriod {
+	case TokenBudgetPeriodWeekly:
+		start = start.AddDate(0, 0, -((int(now.Weekday()) - token.BudgetResetDay + 7) % 7))
+		if now.Before(start) {
+			start = start.AddDate(0, 0, -7)
+		}
+	case TokenBudgetPeriodMonthly:
+		start = time.Date(now.Year(), now.Month(), token.BudgetResetDay, token.BudgetResetHour, 0, 0, 0, now.Location())
+		if now.Before(start) {
+			start = start.AddDate(0, -1, 0)
+		}
+	default:
+		if now.Before(start) {
+			start = start.AddDate(0, 0, -1)
+		}
+	}
+	return start
+}
+
+func (token *Token) nextPeriodStart(start time.Time) time.Time {
+	switch token.BudgetPeriod {
+	case TokenBudgetPeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case TokenBudgetPeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// RefreshBudgetPeriod 周期已过时将已用额度视为 0，并填充下次重置时间，用于校验与展示，不写入数据库
+func (token *Token) RefreshBudgetPeriod() {
+	if !token.HasBudgetPeriod() {
+		return
+	}
+	start := token.currentPeriodStart(time.Now())
+	if token.PeriodStartTime < start.Unix() {
+		token.PeriodUsedQuota = 0
+		token.PeriodStartTime = start.Unix()
+	}
+	token.PeriodResetTime = token.nextPeriodStart(start).Unix()
+}
+
+// FillTokenBudgets 为令牌列表刷新周期已用额度与下次重置时间
+func FillTokenBudgets(tokens []*Token) {
+	for _, token := range tokens {
+		if token != nil {
+			token.RefreshBudgetPeriod()
+		}
+	}
+}
+
+// CurrentPeriodStart 当前周期的开始时间，未启用周期预算时为 0
+func (token *Token) CurrentPeriodStart() int64 {
+	if !token.HasBudgetPeriod() {
+		return 0
+	}
+	return token.currentPeriodStart(time.Now()).Unix()
+}
+
+// PeriodQuotaAvailable 令牌本周期的剩余额度足够 quota
+func (token *Token) PeriodQuotaAvailable(quota int) bool {
+	if !token.HasBudgetPeriod() || token.PeriodQuotaLimit <= 0 {
+		return true
+	}
+	token.RefreshBudgetPeriod()
+	return token.PeriodUsedQuota+quota <= token.PeriodQuotaLimit
+}
+
+// IsPeriodQuotaExhausted 令牌本周期的额度已用尽
+func (token *Token) IsPeriodQuotaExhausted() bool {
+	if !token.HasBudgetPeriod() || token.PeriodQuotaLimit <= 0 {
+		return false
+	}
+	token.RefreshBudgetPeriod()
+	return token.PeriodUsedQuota >= token.PeriodQuotaLimit
+}
+
+func tokenCacheKey(key string) string {
+	return fmt.Sprintf("token:%s", common.GenerateHMAC(key))
+}
+
+// resetTokenPeriod 周期已过时重置数据库中的周期已用额度，条件更新保证多个实例同时重置时只生效一次
+func resetTokenPeriod(id int, periodStart int64) error {
+	return DB.Model(&Token{}).Where("id = ? AND period_start_time < ?", id, periodStart).Updates(
+		map[string]interface{}{
+			"period_used_quota": 0,
+			"period_start_time": periodStart,
+		},
+	).Error
+}
+
+// updateTokenPeriodQuota 调整数据库中 periodStart 周期的已用额度，退还时不低于 0；数据库中已是之后的周期时不再调整
+func updateTokenPeriodQuota(id int, periodStart int64, quota int) error {
+	if err := resetTokenPeriod(id, periodStart); err != nil {
+		return err
+	}
+	return DB.Model(&Token{}).Where("id = ? AND period_start_time = ?", id, periodStart).Update("period_used_quota",
+		gorm.Expr("CASE WHEN period_used_quota + ? > 0 THEN period_used_quota + ? ELSE 0 END", quota, quota)).Error
+}
+
+// addTokenPeriodQuota 缓存已更新时同步数据库中的周期已用额度，启用批量更新时合并写入
+func addTokenPeriodQuota(id int, periodStart int64, quota int) error {
+	if !common.BatchUpdateEnabled {
+		return updateTokenPeriodQuota(id, periodStart, quota)
+	}
+	tokenPeriodDeltasLock.Lock()
+	defer tokenPeriodDeltasLock.Unlock()
+	delta, ok := tokenPeriodDeltas[id]
+	switch {
+	case !ok || delta.periodStart < periodStart:
+		// 之前周期的变化在重置后不再需要写入
+		tokenPeriodDeltas[id] = tokenPeriodDelta{periodStart: periodStart, quota: quota}
+	case delta.periodStart == periodStart:
+		delta.quota += quota
+		tokenPeriodDeltas[id] = delta
+	}
+	return nil
+}
+
+func hasTokenPeriodDeltas() bool {
+	tokenPeriodDeltasLock.Lock()
+	defer tokenPeriodDeltasLock.Unlock()
+	return len(tokenPeriodDeltas) > 0
+}
+
+// batchUpdateTokenPeriodQuota 将合并的周期已用额度写入数据库
+func batchUpdateTokenPeriodQuota() {
+	tokenPeriodDeltasLock.Lock()
+	deltas := tokenPeriodDeltas
+	tokenPeriodDeltas = make(map[int]tokenPeriodDelta)
+	tokenPeriodDeltasLock.Unlock()
+	for id, delta := range deltas {
+		if err := updateTokenPeriodQuota(id, delta.periodStart, delta.quota); err != nil {
+			common.SysError("failed to batch update token period quota: " + err.Error())
+		}
+	}
+}
+
+// ReserveTokenPeriodQuota 原子地检查并预留令牌 periodStart 周期的额度，超出上限时返回 false；
+// 启用 Redis 时在缓存的令牌上检查，数据库随批量更新同步；令牌不在缓存中时使用数据库的条件更新
+func ReserveTokenPeriodQuota(token *Token, periodStart int64, quota int) (bool, error) {
+	if !token.HasBudgetPeriod() {
+		return true, nil
+	}
+	if common.RedisEnabled {
+		result, err := common.RDB.Eval(context.Background(), tokenPeriodReserveScript, []string{tokenCacheKey(token.Key)}, periodStart, token.PeriodQuotaLimit, quota).Int()
+		if err != nil {
+			common.SysError("failed to reserve token period quota from redis: " + err.Error())
+		} else if result == 0 {
+			return false, nil
+		} else if result == 1 {
+			return true, addTokenPeriodQuota(token.Id, periodStart, quota)
+		}
+	}
+	if err := resetTokenPeriod(token.Id, periodStart); err != nil {
+		return false, err
+	}
+	tx := DB.Model(&Token{}).Where("id = ? AND period_start_time = ?", token.Id, periodStart)
+	if token.PeriodQuotaLimit > 0 {
+		tx = tx.Where("period_used_quota + ? <= ?", quota, token.PeriodQuotaLimit)
+	}
+	result := tx.Update("period_used_quota", gorm.Expr("period_used_quota + ?", quota))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// AdjustTokenPeriodQuota 按实际消耗调整令牌 periodStart 周期的已用额度，不检查上限，退还时不低于 0；
+// periodStart 为 0 表示令牌未启用周期预算
+func AdjustTokenPeriodQuota(id int, key string, periodStart int64, quota int) error {
+	if periodStart == 0 || quota == 0 {
+		return nil
+	}
+	if common.RedisEnabled {
+		if err := common.RDB.Eval(context.Background(), tokenPeriodAdjustScript, []string{tokenCacheKey(key)}, periodStart, quota).Err(); err != nil {
+			common.SysError("failed to adjust token period quota from redis: " + err.Error())
+		}
+	}
+	return addTokenPeriodQuota(id, periodStart, quota)
+}
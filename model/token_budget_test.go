@@ -0,0 +1,128 @@
+package model
+
+import (
+	"one-api/common"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createBudgetToken(t *testing.T, limit int) *Token {
+	token := &Token{
+		UserId:           1,
+		Key:              common.GetRandomString(48),
+		Name:             "budget",
+		BudgetPeriod:     TokenBudgetPeriodDaily,
+		PeriodQuotaLimit: limit,
+		UnlimitedQuota:   true,
+	}
+	assert.NoError(t, DB.Create(token).Error)
+	return token
+}
+
+func getPeriodUsedQuota(t *testing.T, id int) (int, int64) {
+	var token Token
+	assert.NoError(t, DB.First(&token, id).Error)
+	return token.PeriodUsedQuota, token.PeriodStartTime
+}
+
+// TestReserveTokenPeriodQuotaLimit 测试未启用 Redis 时按数据库条件更新检查周期额度上限
+func TestReserveTokenPeriodQuotaLimit(t *testing.T) {
+	setupTestDB(t, &Token{})
+	oldEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = oldEnabled })
+
+	token := createBudgetToken(t, 100)
+	periodStart := token.CurrentPeriodStart()
+
+	ok, err := ReserveTokenPeriodQuota(token, periodStart, 60)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = ReserveTokenPeriodQuota(token, periodStart, 50)
+	assert.NoError(t, err)
+	assert.False(t, ok, "超出周期上限时不应预留")
+	ok, err = ReserveTokenPeriodQuota(token, periodStart, 40)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	used, start := getPeriodUsedQuota(t, token.Id)
+	assert.Equal(t, 100, used)
+	assert.Equal(t, periodStart, start)
+
+	// 退还不低于 0
+	assert.NoError(t, AdjustTokenPeriodQuota(token.Id, token.Key, periodStart, -150))
+	used, _ = getPeriodUsedQuota(t, token.Id)
+	assert.Equal(t, 0, used)
+}
+
+// TestReserveTokenPeriodQuotaNewPeriod 测试进入新周期时重置已用额度，之前周期的结算不再计入
+func TestReserveTokenPeriodQuotaNewPeriod(t *testing.T) {
+	setupTestDB(t, &Token{})
+	oldEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = oldEnabled })
+
+	token := createBudgetToken(t, 100)
+	periodStart := token.CurrentPeriodStart()
+	lastPeriodStart := time.Unix(periodStart, 0).AddDate(0, 0, -1).Unix()
+	assert.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).Updates(map[string]interface{}{
+		"period_used_quota": 100,
+		"period_start_time": lastPeriodStart,
+	}).Error)
+
+	ok, err := ReserveTokenPeriodQuota(token, periodStart, 80)
+	assert.NoError(t, err)
+	assert.True(t, ok, "新周期应重新计算额度")
+
+	// 上一周期请求的结算不影响本周期
+	assert.NoError(t, AdjustTokenPeriodQuota(token.Id, token.Key, lastPeriodStart, 50))
+	used, start := getPeriodUsedQuota(t, token.Id)
+	assert.Equal(t, 80, used)
+	assert.Equal(t, periodStart, start)
+}
+
+// TestReserveTokenPeriodQuotaConcurrentRedis 测试启用 Redis 时并发预留不超过上限，数据库随批量更新同步
+func TestReserveTokenPeriodQuotaConcurrentRedis(t *testing.T) {
+	setupTestDB(t, &Token{})
+	setupTestRedis(t)
+	oldBatch := common.BatchUpdateEnabled
+	common.BatchUpdateEnabled = true
+	t.Cleanup(func() { common.BatchUpdateEnabled = oldBatch })
+
+	token := createBudgetToken(t, 100)
+	assert.NoError(t, cacheSetToken(*token))
+	periodStart := token.CurrentPeriodStart()
+
+	var granted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := ReserveTokenPeriodQuota(token, periodStart, 10)
+			assert.NoError(t, err)
+			if ok {
+				atomic.AddInt32(&granted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(10), granted)
+
+	cached, err := cacheGetTokenByKey(token.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, cached.PeriodUsedQuota)
+
+	// 预留只写缓存，数据库在批量更新时同步
+	used, _ := getPeriodUsedQuota(t, token.Id)
+	assert.Equal(t, 0, used)
+	assert.NoError(t, AdjustTokenPeriodQuota(token.Id, token.Key, periodStart, -30))
+	batchUpdateTokenPeriodQuota()
+	used, start := getPeriodUsedQuota(t, token.Id)
+	assert.Equal(t, 70, used)
+	assert.Equal(t, periodStart, start)
+}
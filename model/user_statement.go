@@ -0,0 +1,174 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 账单周期的格式，按服务器时区的自然月
+const statementPeriodLayout = "2006-01"
+
+// StatementModelUsage 账单中按模型汇总的用量
+type StatementModelUsage struct {
+	ModelName        string `json:"model_name"`
+	Quota            int    `json:"quota"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+// UserStatement 用户的月度用量账单，由日志表中的消费记录汇总生成
+type UserStatement struct {
+	UserId           int                    `json:"user_id"`
+	Period           string                 `json:"period"`
+	StartTime        int64                  `json:"start_time"`
+	EndTime          int64                  `json:"end_time"`
+	Quota            int                    `json:"quota"`
+	RequestCount     int                    `json:"request_count"`
+	PromptTokens     int                    `json:"prompt_tokens"`
+	CompletionTokens int                    `json:"completion_tokens"`
+	Models           []*StatementModelUsage `json:"models"`
+	Balance          int                    `json:"balance"`       // 当前余额，授信用户可能为负数
+	CreditLimit      int                    `json:"credit_limit"`  // 授信额度
+	SettledQuota     int                    `json:"settled_quota"` // 已结算入账的额度
+	SettledAt        int64                  `json:"settled_at"`    // 结算时间，0 为未结算
+}
+
+// UserSettlement 月结账单的结算记录，同一用户的同一账单周期只能有一条
+type UserSettlement struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"uniqueIndex:idx_user_settlement_period"`
+	Period    string `json:"period" gorm:"type:varchar(16);uniqueIndex:idx_user_settlement_period"`
+	Quota     int    `json:"quota"`
+	AdminId   int    `json:"admin_id"`
+	SettledAt int64  `json:"settled_at" gorm:"bigint"`
+}
+
+// ParseStatementPeriod 解析账单周期（如 2025-01），为空时返回当前月份
+func ParseStatementPeriod(period string) (time.Time, error) {
+	if period == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), nil
+	}
+	start, err := time.ParseInLocation(statementPeriodLayout, period, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("无效的账单周期，格式应为 YYYY-MM")
+	}
+	return start, nil
+}
+
+// GetUserStatement 生成用户在指定月份的用量账单
+func GetUserStatement(userId int, period string) (*UserStatement, error) {
+	start, err := ParseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	end := start.AddDate(0, 1, 0)
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	statement := &UserStatement{
+		UserId:      userId,
+		Period:      start.Format(statementPeriodLayout),
+		StartTime:   start.Unix(),
+		EndTime:     end.Unix(),
+		Models:      make([]*StatementModelUsage, 0),
+		Balance:     user.Quota,
+		CreditLimit: user.CreditLimit,
+	}
+	err = LOG_DB.Table("logs").
+		Select("model_name, sum(quota) quota, count(*) request_count, sum(prompt_tokens) prompt_tokens, sum(completion_tokens) completion_tokens").
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at < ?", userId, LogTypeConsume, statement.StartTime, statement.EndTime).
+		Group("model_name").Order("quota desc").
+		Scan(&statement.Models).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, usage := range statement.Models {
+		statement.Quota += usage.Quota
+		statement.RequestCount += usage.RequestCount
+		statement.PromptTokens += usage.PromptTokens
+		statement.CompletionTokens += usage.CompletionTokens
+	}
+	var settlement UserSettlement
+	err = DB.Where("user_id = ? AND period = ?", userId, statement.Period).First(&settlement).Error
+	if err == nil {
+		statement.SettledQuota = settlement.Quota
+		statement.SettledAt = settlement.SettledAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// SettleUserStatement 结算用户已结束月份的账单：将结算额度（默认为账单的消费额度）计入余额，并记录一条充值日志；
+// 结算记录与入账在同一事务中完成，同一账单并发结算时只有一次入账
+func SettleUserStatement(userId int, period string, quota int, adminId int) (*UserStatement, error) {
+	statement, err := GetUserStatement(userId, period)
+	if err != nil {
+		return nil, err
+	}
+	if statement.EndTime > time.Now().Unix() {
+		return nil, errors.New("只能结算已结束月份的账单")
+	}
+	if statement.SettledAt != 0 {
+		return nil, fmt.Errorf("%s 的账单已结算", statement.Period)
+	}
+	if quota <= 0 {
+		quota = statement.Quota
+	}
+	if quota <= 0 {
+		return nil, fmt.Errorf("%s 的账单没有需要结算的额度", statement.Period)
+	}
+	settlement := &UserSettlement{
+		UserId:    userId,
+		Period:    statement.Period,
+		Quota:     quota,
+		AdminId:   adminId,
+		SettledAt: common.GetTimestamp(),
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(settlement)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%s 的账单已结算", statement.Period)
+		}
+		return tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = cacheIncrUserQuota(userId, int64(quota)); err != nil {
+		common.SysError("failed to increase user quota cache: " + err.Error())
+	}
+	username, _ := GetUsernameById(userId, false)
+	settlementLog := &Log{
+		UserId:    userId,
+		Username:  username,
+		CreatedAt: settlement.SettledAt,
+		Type:      LogTypeTopup,
+		Content:   fmt.Sprintf("月结账单 %s 结算入账 %s", statement.Period, common.LogQuota(quota)),
+		Quota:     quota,
+		Other: common.MapToJsonStr(map[string]interface{}{
+			"statement_period": statement.Period,
+			"admin_info": map[string]interface{}{
+				"admin_id": adminId,
+			},
+		}),
+	}
+	if err = LOG_DB.Create(settlementLog).Error; err != nil {
+		return nil, fmt.Errorf("%s 的账单已结算入账，但记录结算日志失败: %w", statement.Period, err)
+	}
+	statement.Balance += quota
+	statement.SettledQuota = quota
+	statement.SettledAt = settlement.SettledAt
+	return statement, nil
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"one-api/common"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupStatementUser 创建透支中的授信用户，并在上个月写入消费记录，返回上个月的账单周期
+func setupStatementUser(t *testing.T, quota int, consumes ...int) (*User, string) {
+	setupTestDB(t, &User{}, &Log{}, &UserSettlement{})
+	oldEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = oldEnabled })
+
+	user := &User{Username: "statement", Quota: quota, CreditLimit: 1000, Status: common.UserStatusEnabled}
+	assert.NoError(t, DB.Create(user).Error)
+	now := time.Now()
+	lastMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	for i, consume := range consumes {
+		assert.NoError(t, DB.Create(&Log{
+			UserId:    user.Id,
+			CreatedAt: lastMonth.Add(time.Duration(i+1) * time.Hour).Unix(),
+			Type:      LogTypeConsume,
+			ModelName: "gpt-4o",
+			Quota:     consume,
+		}).Error)
+	}
+	return user, lastMonth.Format(statementPeriodLayout)
+}
+
+func getUserQuota(t *testing.T, id int) int {
+	var user User
+	assert.NoError(t, DB.First(&user, id).Error)
+	return user.Quota
+}
+
+// TestSettleUserStatement 测试结算将账单额度计入余额，之后账单显示已结算且不能重复结算
+func TestSettleUserStatement(t *testing.T) {
+	user, period := setupStatementUser(t, -600, 400, 200)
+
+	statement, err := GetUserStatement(user.Id, period)
+	assert.NoError(t, err)
+	assert.Equal(t, 600, statement.Quota)
+	assert.Equal(t, int64(0), statement.SettledAt)
+
+	statement, err = SettleUserStatement(user.Id, period, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 600, statement.SettledQuota)
+	assert.Equal(t, 0, statement.Balance)
+	assert.Equal(t, 0, getUserQuota(t, user.Id))
+
+	statement, err = GetUserStatement(user.Id, period)
+	assert.NoError(t, err)
+	assert.Equal(t, 600, statement.SettledQuota)
+	assert.NotZero(t, statement.SettledAt)
+
+	_, err = SettleUserStatement(user.Id, period, 100, 1)
+	assert.Error(t, err, "已结算的账单不能再次结算")
+	assert.Equal(t, 0, getUserQuota(t, user.Id))
+
+	var topups int64
+	assert.NoError(t, DB.Model(&Log{}).Where("user_id = ? AND type = ?", user.Id, LogTypeTopup).Count(&topups).Error)
+	assert.Equal(t, int64(1), topups)
+}
+
+// TestSettleUserStatementLimits 测试未结束的月份与没有消费的账单不能结算
+func TestSettleUserStatementLimits(t *testing.T) {
+	user, period := setupStatementUser(t, -100)
+
+	_, err := SettleUserStatement(user.Id, "", 100, 1)
+	assert.Error(t, err, "当前月份尚未结束")
+	_, err = SettleUserStatement(user.Id, period, 0, 1)
+	assert.Error(t, err, "没有消费的账单没有需要结算的额度")
+	_, err = SettleUserStatement(user.Id, "2025/01", 100, 1)
+	assert.Error(t, err)
+	assert.Equal(t, -100, getUserQuota(t, user.Id))
+
+	// 指定结算额度时按指定额度入账
+	statement, err := SettleUserStatement(user.Id, period, 100, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, statement.SettledQuota)
+	assert.Equal(t, 0, getUserQuota(t, user.Id))
+}
+
+// TestSettleUserStatementConcurrent 测试同一账单并发结算时只入账一次
+func TestSettleUserStatementConcurrent(t *testing.T) {
+	user, period := setupStatementUser(t, -500, 500)
+
+	var settled int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := SettleUserStatement(user.Id, period, 0, 1); err == nil {
+				atomic.AddInt32(&settled, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), settled)
+	assert.Equal(t, 0, getUserQuota(t, user.Id))
+	var settlements int64
+	assert.NoError(t, DB.Model(&UserSettlement{}).Where("user_id = ?", user.Id).Count(&settlements).Error)
+	assert.Equal(t, int64(1), settlements)
+}
@@ -61,7 +61,7 @@ func batchUpdate() {
 		batchUpdateLocks[i].Unlock()
 	}
 
-	if !hasData {
+	if !hasData && !hasTokenPeriodDeltas() {
 		return
 	}
 
@@ -93,6 +93,7 @@ func batchUpdate() {
 			}
 		}
 	}
+	batchUpdateTokenPeriodQuota()
 	common.SysLog("batch update finished")
 }
 
@@ -28,6 +28,23 @@ type Adaptor interface {
 	ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error)
 }
 
+// RealtimeConverter 上游实时协议与 OpenAI realtime 不同的渠道实现该接口，由 RealtimeHandler 负责连接读写与计费。
+// 方法在同一会话内串行调用
+type RealtimeConverter interface {
+	// Start 上游连接建立后调用
+	Start() (*RealtimeMessages, error)
+	// ConvertClientEvent 转换客户端发送的 OpenAI realtime 事件
+	ConvertClientEvent(event *dto.RealtimeEvent, message []byte) (*RealtimeMessages, error)
+	// ConvertUpstreamMessage 转换上游消息为 OpenAI realtime 事件
+	ConvertUpstreamMessage(message []byte) (*RealtimeMessages, error)
+}
+
+type RealtimeMessages struct {
+	Upstream [][]byte             // 发往上游的消息
+	Client   []*dto.RealtimeEvent // 发往客户端的事件
+	Usage    *dto.RealtimeUsage   // 上游在 response.done 之后单独返回的用量，代替上一次 response 的本地估算
+}
+
 type TaskAdaptor interface {
 	Init(info *relaycommon.TaskRelayInfo)
 
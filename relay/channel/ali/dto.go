@@ -100,6 +100,20 @@ type AliImageRequest struct {
 	ResponseFormat string `json:"response_format,omitempty"`
 }
 
+// AliImageEditRequest 通用图像编辑（image2image），edits 与 variations 均转换为该请求
+type AliImageEditRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Function     string `json:"function"`
+		Prompt       string `json:"prompt"`
+		BaseImageUrl string `json:"base_image_url"`
+		MaskImageUrl string `json:"mask_image_url,omitempty"`
+	} `json:"input"`
+	Parameters struct {
+		N int `json:"n,omitempty"`
+	} `json:"parameters,omitempty"`
+}
+
 type AliRerankParameters struct {
 	TopN            *int  `json:"top_n,omitempty"`
 	ReturnDocuments *bool `json:"return_documents,omitempty"`
@@ -9,6 +9,7 @@ import (
 	"one-api/common"
 	"one-api/dto"
 	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
 	"one-api/service"
 	"one-api/types"
 	"strings"
@@ -28,6 +29,33 @@ func oaiImage2Ali(request dto.ImageRequest) *AliImageRequest {
 	return &imageRequest
 }
 
+func oaiImageEdit2Ali(c *gin.Context, request dto.ImageRequest) (*AliImageEditRequest, error) {
+	form, err := helper.ParseImageForm(c)
+	if err != nil {
+		return nil, err
+	}
+	var imageRequest AliImageEditRequest
+	imageRequest.Model = request.Model
+	imageRequest.Input.Prompt = request.Prompt
+	if imageRequest.Input.Prompt == "" {
+		imageRequest.Input.Prompt = helper.ImageVariationPrompt
+	}
+	// 只支持单张参考图
+	imageRequest.Input.BaseImageUrl = form.Images[0].DataUrl()
+	imageRequest.Input.Function = c.Request.PostForm.Get("function")
+	if form.Mask != nil {
+		imageRequest.Input.MaskImageUrl = form.Mask.DataUrl()
+		if imageRequest.Input.Function == "" {
+			imageRequest.Input.Function = "description_edit_with_mask"
+		}
+	}
+	if imageRequest.Input.Function == "" {
+		imageRequest.Input.Function = "description_edit"
+	}
+	imageRequest.Parameters.N = request.N
+	return &imageRequest, nil
+}
+
 func updateTask(info *relaycommon.RelayInfo, taskID string) (*AliResponse, error, []byte) {
 	url := fmt.Sprintf("%s/api/v1/tasks/%s", info.BaseUrl, taskID)
 
@@ -238,6 +238,10 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	if helper.IsStreamHedged(c) {
+		// 对冲请求落败时随上下文取消上游请求
+		req = req.WithContext(c.Request.Context())
+	}
 	resp, err := client.Do(req)
 
 	if err != nil {
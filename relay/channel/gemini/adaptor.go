@@ -11,6 +11,7 @@ import (
 	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	"one-api/relay/constant"
+	"one-api/relay/helper"
 	"one-api/setting/model_setting"
 	"one-api/types"
 	"strings"
@@ -33,6 +34,12 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	if info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations {
+		if strings.HasPrefix(info.UpstreamModelName, "imagen") {
+			return nil, errors.New("imagen models do not support image edits or variations")
+		}
+		return imageEditRequest2Gemini(c, request)
+	}
 	if !strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return nil, errors.New("not supported model for image generation")
 	}
@@ -85,6 +92,13 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 
 	version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
 
+	if info.RelayMode == constant.RelayModeRealtime {
+		// Gemini Live: wss://generativelanguage.googleapis.com/ws/google.ai.generativelanguage.v1beta.GenerativeService.BidiGenerateContent
+		baseUrl := strings.Replace(info.BaseUrl, "https://", "wss://", 1)
+		baseUrl = strings.Replace(baseUrl, "http://", "ws://", 1)
+		return fmt.Sprintf("%s/ws/google.ai.generativelanguage.%s.GenerativeService.BidiGenerateContent?key=%s", baseUrl, version, info.ApiKey), nil
+	}
+
 	if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return fmt.Sprintf("%s/%s/models/%s:predict", info.BaseUrl, version, info.UpstreamModelName), nil
 	}
@@ -165,10 +179,18 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		return channel.DoWssRequest(a, c, info, requestBody)
+	}
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		err, usage = channel.RealtimeHandler(c, info, newRealtimeConverter(c, info))
+		return
+	}
+
 	if info.RelayMode == constant.RelayModeGemini {
 		if info.IsStream {
 			return GeminiTextGenerationStreamHandler(c, info, resp)
@@ -177,6 +199,10 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		}
 	}
 
+	if info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations {
+		return GeminiImageEditHandler(c, info, resp)
+	}
+
 	if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return GeminiImageHandler(c, info, resp)
 	}
@@ -262,6 +288,91 @@ func GeminiImageHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.
 	return usage, nil
 }
 
+// imageEditRequest2Gemini 使用支持图片输出的 Gemini 模型（如 gemini-2.5-flash-image）完成编辑与变体，
+// 上传的图片作为 inlineData 与提示词一起发送。Gemini 不支持 mask，忽略该字段
+func imageEditRequest2Gemini(c *gin.Context, request dto.ImageRequest) (*GeminiChatRequest, error) {
+	form, err := helper.ParseImageForm(c)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]GeminiPart, 0, len(form.Images)+1)
+	for _, image := range form.Images {
+		parts = append(parts, GeminiPart{
+			InlineData: &GeminiInlineData{
+				MimeType: image.MimeType,
+				Data:     image.Base64(),
+			},
+		})
+	}
+	prompt := request.Prompt
+	if prompt == "" {
+		prompt = helper.ImageVariationPrompt
+	}
+	parts = append(parts, GeminiPart{Text: prompt})
+	return &GeminiChatRequest{
+		Contents: []GeminiChatContent{
+			{
+				Role:  "user",
+				Parts: parts,
+			},
+		},
+		GenerationConfig: GeminiChatGenerationConfig{
+			ResponseModalities: []string{"TEXT", "IMAGE"},
+		},
+	}, nil
+}
+
+// GeminiImageEditHandler 将 generateContent 返回的图片转换为 OpenAI images 响应
+func GeminiImageEditHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeReadResponseBodyFailed)
+	}
+	common.CloseResponseBodyGracefully(resp)
+
+	var geminiResponse GeminiChatResponse
+	if err := common.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+
+	openAIResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+	}
+	var revisedPrompt string
+	for _, candidate := range geminiResponse.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "image/") {
+				openAIResponse.Data = append(openAIResponse.Data, dto.ImageData{
+					B64Json: part.InlineData.Data,
+				})
+			} else if part.Text != "" && !part.Thought {
+				revisedPrompt += part.Text
+			}
+		}
+	}
+	if len(openAIResponse.Data) == 0 {
+		return nil, types.NewError(errors.New("no images generated"), types.ErrorCodeBadResponseBody)
+	}
+	for i := range openAIResponse.Data {
+		openAIResponse.Data[i].RevisedPrompt = revisedPrompt
+	}
+
+	jsonResponse, err := common.Marshal(openAIResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+
+	usage := &dto.Usage{
+		PromptTokens:     geminiResponse.UsageMetadata.PromptTokenCount,
+		CompletionTokens: geminiResponse.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      geminiResponse.UsageMetadata.TotalTokenCount,
+	}
+	return usage, nil
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return ModelList
 }
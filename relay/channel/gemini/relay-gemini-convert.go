@@ -0,0 +1,764 @@
+package gemini
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/setting/model_setting"
+	"strings"
+)
+
+// Gemini 原生格式（/v1beta/models/*:generateContent）请求在非 Gemini 渠道上的转换
+
+type geminiFunctionDeclaration struct {
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Parameters           any    `json:"parameters,omitempty"`
+	ParametersJsonSchema any    `json:"parametersJsonSchema,omitempty"`
+}
+
+// geminiCallIds Gemini 的 functionCall 通常不带 id，按函数名依次与 functionResponse 配对
+type geminiCallIds struct {
+	seq     int
+	pending map[string][]string
+}
+
+func newGeminiCallIds() *geminiCallIds {
+	return &geminiCallIds{pending: make(map[string][]string)}
+}
+
+func (g *geminiCallIds) call(call *FunctionCall) string {
+	id := call.Id
+	if id == "" {
+		g.seq++
+		id = fmt.Sprintf("call_%d", g.seq)
+	}
+	g.pending[call.FunctionName] = append(g.pending[call.FunctionName], id)
+	return id
+}
+
+func (g *geminiCallIds) response(response *FunctionResponse) string {
+	ids := g.pending[response.Name]
+	if response.Id != "" {
+		for i, id := range ids {
+			if id == response.Id {
+				g.pending[response.Name] = append(ids[:i:i], ids[i+1:]...)
+				break
+			}
+		}
+		return response.Id
+	}
+	if len(ids) == 0 {
+		g.seq++
+		return fmt.Sprintf("call_%d", g.seq)
+	}
+	g.pending[response.Name] = ids[1:]
+	return ids[0]
+}
+
+func geminiSystemText(content *GeminiChatContent) string {
+	if content == nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range content.Parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// geminiThinkingBudget 未指定或动态（-1）预算返回 0
+func geminiThinkingBudget(request *GeminiChatRequest) int {
+	thinkingConfig := request.GenerationConfig.ThinkingConfig
+	if thinkingConfig == nil || thinkingConfig.ThinkingBudget == nil {
+		return 0
+	}
+	return max(*thinkingConfig.ThinkingBudget, 0)
+}
+
+func geminiFunctionDeclarations(tools []GeminiChatTool) ([]geminiFunctionDeclaration, error) {
+	var declarations []geminiFunctionDeclaration
+	for _, tool := range tools {
+		if tool.FunctionDeclarations == nil {
+			continue
+		}
+		data, err := common.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, err
+		}
+		var toolDeclarations []geminiFunctionDeclaration
+		if err := common.Unmarshal(data, &toolDeclarations); err != nil {
+			return nil, fmt.Errorf("invalid functionDeclarations: %w", err)
+		}
+		declarations = append(declarations, toolDeclarations...)
+	}
+	return declarations, nil
+}
+
+func (d *geminiFunctionDeclaration) schema() any {
+	if d.ParametersJsonSchema != nil {
+		return d.ParametersJsonSchema
+	}
+	return normalizeGeminiSchema(d.Parameters)
+}
+
+// normalizeGeminiSchema Gemini 的 OpenAPI Schema 类型名为大写（如 OBJECT），转换为 JSON Schema 的小写形式
+func normalizeGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "type" {
+				if typeName, ok := value.(string); ok {
+					result[key] = strings.ToLower(typeName)
+					continue
+				}
+			}
+			result[key] = normalizeGeminiSchema(value)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, value := range v {
+			result[i] = normalizeGeminiSchema(value)
+		}
+		return result
+	}
+	return schema
+}
+
+func geminiFunctionArgs(call *FunctionCall) any {
+	if call.Arguments == nil {
+		return map[string]any{}
+	}
+	return call.Arguments
+}
+
+func geminiFunctionResponseText(response *FunctionResponse) string {
+	data, err := common.Marshal(response.Response)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func geminiDataUrl(data *GeminiInlineData) string {
+	return fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data)
+}
+
+func geminiCodeText(part *GeminiPart) string {
+	if part.ExecutableCode != nil {
+		return fmt.Sprintf("```%s\n%s\n```", strings.ToLower(part.ExecutableCode.Language), part.ExecutableCode.Code)
+	}
+	return part.CodeExecutionResult.Output
+}
+
+// GeminiRequest2OpenAI 将 Gemini 请求转换为 Chat Completions 请求
+func GeminiRequest2OpenAI(request *GeminiChatRequest, info *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
+	generationConfig := request.GenerationConfig
+	openAIRequest := &dto.GeneralOpenAIRequest{
+		Model:       info.UpstreamModelName,
+		Stream:      info.IsStream,
+		MaxTokens:   generationConfig.MaxOutputTokens,
+		Temperature: generationConfig.Temperature,
+		TopP:        generationConfig.TopP,
+		TopK:        int(generationConfig.TopK),
+		Seed:        float64(generationConfig.Seed),
+	}
+	if len(generationConfig.StopSequences) > 0 {
+		openAIRequest.Stop = generationConfig.StopSequences
+	}
+	if generationConfig.CandidateCount > 1 {
+		openAIRequest.N = generationConfig.CandidateCount
+	}
+	if budget := geminiThinkingBudget(request); budget > 0 {
+		switch {
+		case budget <= 1024:
+			openAIRequest.ReasoningEffort = "low"
+		case budget <= 8192:
+			openAIRequest.ReasoningEffort = "medium"
+		default:
+			openAIRequest.ReasoningEffort = "high"
+		}
+	}
+	if generationConfig.ResponseMimeType == "application/json" {
+		if generationConfig.ResponseSchema != nil {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &dto.FormatJsonSchema{
+					Name:   "response",
+					Schema: normalizeGeminiSchema(generationConfig.ResponseSchema),
+				},
+			}
+		} else {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	messages := make([]dto.Message, 0, len(request.Contents)+1)
+	if system := geminiSystemText(request.SystemInstructions); system != "" {
+		message := dto.Message{Role: "system"}
+		message.SetStringContent(system)
+		messages = append(messages, message)
+	}
+	callIds := newGeminiCallIds()
+	for _, content := range request.Contents {
+		contentMessages, err := geminiContentToOpenAIMessages(content, callIds)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, contentMessages...)
+	}
+	openAIRequest.Messages = messages
+
+	declarations, err := geminiFunctionDeclarations(request.Tools)
+	if err != nil {
+		return nil, err
+	}
+	for _, declaration := range declarations {
+		openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        declaration.Name,
+				Description: declaration.Description,
+				Parameters:  declaration.schema(),
+			},
+		})
+	}
+	if request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil && len(openAIRequest.Tools) > 0 {
+		functionCallingConfig := request.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(functionCallingConfig.Mode) {
+		case "ANY":
+			if len(functionCallingConfig.AllowedFunctionNames) == 1 {
+				openAIRequest.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]any{"name": functionCallingConfig.AllowedFunctionNames[0]},
+				}
+			} else {
+				openAIRequest.ToolChoice = "required"
+			}
+		case "NONE":
+			openAIRequest.ToolChoice = "none"
+		}
+	}
+	return openAIRequest, nil
+}
+
+func geminiContentToOpenAIMessages(content GeminiChatContent, callIds *geminiCallIds) ([]dto.Message, error) {
+	var messages []dto.Message
+	if content.Role == "model" {
+		message := dto.Message{Role: "assistant"}
+		var texts []string
+		var toolCalls []dto.ToolCallRequest
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+				// 思考内容没有签名，无法回传给其它上游
+			case part.FunctionCall != nil:
+				arguments, err := common.Marshal(geminiFunctionArgs(part.FunctionCall))
+				if err != nil {
+					return nil, err
+				}
+				toolCalls = append(toolCalls, dto.ToolCallRequest{
+					ID:   callIds.call(part.FunctionCall),
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: string(arguments),
+					},
+				})
+			case part.Text != "":
+				texts = append(texts, part.Text)
+			case part.ExecutableCode != nil || part.CodeExecutionResult != nil:
+				texts = append(texts, geminiCodeText(&part))
+			}
+		}
+		if len(texts) > 0 {
+			message.SetStringContent(strings.Join(texts, ""))
+		} else {
+			message.SetNullContent()
+		}
+		if len(toolCalls) > 0 {
+			message.SetToolCalls(toolCalls)
+		} else if len(texts) == 0 {
+			return nil, nil
+		}
+		return append(messages, message), nil
+	}
+
+	var mediaContents []dto.MediaContent
+	for _, part := range content.Parts {
+		switch {
+		case part.Thought:
+		case part.FunctionResponse != nil:
+			// 函数结果在 Chat Completions 中是独立的 tool 消息
+			message := dto.Message{
+				Role:       "tool",
+				ToolCallId: callIds.response(part.FunctionResponse),
+			}
+			message.SetStringContent(geminiFunctionResponseText(part.FunctionResponse))
+			messages = append(messages, message)
+		case part.Text != "":
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: part.Text,
+			})
+		case part.InlineData != nil:
+			mediaContent, err := geminiInlineDataToOpenAI(part.InlineData)
+			if err != nil {
+				return nil, err
+			}
+			mediaContents = append(mediaContents, mediaContent)
+		case part.FileData != nil:
+			if part.FileData.MimeType != "" && !strings.HasPrefix(part.FileData.MimeType, "image/") {
+				return nil, fmt.Errorf("unsupported fileData mime type: %s", part.FileData.MimeType)
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: part.FileData.FileUri, Detail: "auto"},
+			})
+		case part.ExecutableCode != nil || part.CodeExecutionResult != nil:
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: geminiCodeText(&part),
+			})
+		}
+	}
+	if len(mediaContents) > 0 {
+		message := dto.Message{Role: "user"}
+		if len(mediaContents) == 1 && mediaContents[0].Type == dto.ContentTypeText {
+			message.SetStringContent(mediaContents[0].Text)
+		} else {
+			message.SetMediaContent(mediaContents)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func geminiInlineDataToOpenAI(data *GeminiInlineData) (dto.MediaContent, error) {
+	switch {
+	case strings.HasPrefix(data.MimeType, "image/"):
+		return dto.MediaContent{
+			Type:     dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{Url: geminiDataUrl(data), Detail: "auto"},
+		}, nil
+	case strings.HasPrefix(data.MimeType, "audio/"):
+		format := strings.TrimPrefix(data.MimeType, "audio/")
+		if format == "mpeg" {
+			format = "mp3"
+		}
+		return dto.MediaContent{
+			Type:       dto.ContentTypeInputAudio,
+			InputAudio: &dto.MessageInputAudio{Data: data.Data, Format: format},
+		}, nil
+	case data.MimeType == "application/pdf":
+		return dto.MediaContent{
+			Type: dto.ContentTypeFile,
+			File: &dto.MessageFile{FileName: "file.pdf", FileData: geminiDataUrl(data)},
+		}, nil
+	}
+	return dto.MediaContent{}, fmt.Errorf("unsupported inlineData mime type: %s", data.MimeType)
+}
+
+// GeminiRequest2Claude 将 Gemini 请求转换为 Claude Messages 请求
+func GeminiRequest2Claude(request *GeminiChatRequest, info *relaycommon.RelayInfo) (*dto.ClaudeRequest, error) {
+	generationConfig := request.GenerationConfig
+	claudeRequest := &dto.ClaudeRequest{
+		Model:         info.UpstreamModelName,
+		MaxTokens:     generationConfig.MaxOutputTokens,
+		StopSequences: generationConfig.StopSequences,
+		Temperature:   generationConfig.Temperature,
+		TopP:          generationConfig.TopP,
+		TopK:          int(generationConfig.TopK),
+		Stream:        info.IsStream,
+	}
+	if claudeRequest.MaxTokens == 0 {
+		claudeRequest.MaxTokens = uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(info.UpstreamModelName))
+	}
+	if budget := geminiThinkingBudget(request); budget > 0 {
+		// Claude 要求 1024 <= budget_tokens < max_tokens
+		if claudeRequest.MaxTokens < 1280 {
+			claudeRequest.MaxTokens = 1280
+		}
+		budget = max(budget, 1024)
+		budget = min(budget, int(claudeRequest.MaxTokens)-1)
+		claudeRequest.Thinking = &dto.Thinking{
+			Type:         "enabled",
+			BudgetTokens: common.GetPointer[int](budget),
+		}
+		// 开启思考时不支持调整采样参数
+		claudeRequest.Temperature = common.GetPointer[float64](1.0)
+		claudeRequest.TopP = 0
+		claudeRequest.TopK = 0
+	}
+	if system := geminiSystemText(request.SystemInstructions); system != "" {
+		claudeRequest.System = system
+	}
+
+	callIds := newGeminiCallIds()
+	for _, content := range request.Contents {
+		message, err := geminiContentToClaudeMessage(content, callIds)
+		if err != nil {
+			return nil, err
+		}
+		if message != nil {
+			claudeRequest.Messages = append(claudeRequest.Messages, *message)
+		}
+	}
+
+	declarations, err := geminiFunctionDeclarations(request.Tools)
+	if err != nil {
+		return nil, err
+	}
+	for _, declaration := range declarations {
+		inputSchema, _ := declaration.schema().(map[string]any)
+		if inputSchema == nil {
+			inputSchema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		claudeRequest.AddTool(dto.Tool{
+			Name:        declaration.Name,
+			Description: declaration.Description,
+			InputSchema: inputSchema,
+		})
+	}
+	for _, tool := range request.Tools {
+		if tool.GoogleSearch != nil || tool.GoogleSearchRetrieval != nil {
+			claudeRequest.AddTool(dto.ClaudeWebSearchTool{
+				Type: "web_search_20250305",
+				Name: "web_search",
+			})
+			break
+		}
+	}
+	if request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil && len(declarations) > 0 {
+		functionCallingConfig := request.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(functionCallingConfig.Mode) {
+		case "ANY":
+			if len(functionCallingConfig.AllowedFunctionNames) == 1 {
+				claudeRequest.ToolChoice = map[string]any{"type": "tool", "name": functionCallingConfig.AllowedFunctionNames[0]}
+			} else {
+				claudeRequest.ToolChoice = map[string]any{"type": "any"}
+			}
+		case "NONE":
+			claudeRequest.ToolChoice = map[string]any{"type": "none"}
+		}
+	}
+	return claudeRequest, nil
+}
+
+func geminiContentToClaudeMessage(content GeminiChatContent, callIds *geminiCallIds) (*dto.ClaudeMessage, error) {
+	role := "user"
+	if content.Role == "model" {
+		role = "assistant"
+	}
+	// tool_result 必须位于 user 消息的开头
+	var toolResults, blocks []dto.ClaudeMediaMessage
+	for _, part := range content.Parts {
+		switch {
+		case part.Thought:
+			// 思考内容没有签名，无法回传给 Claude
+		case part.FunctionCall != nil:
+			blocks = append(blocks, dto.ClaudeMediaMessage{
+				Type:  "tool_use",
+				Id:    callIds.call(part.FunctionCall),
+				Name:  part.FunctionCall.FunctionName,
+				Input: geminiFunctionArgs(part.FunctionCall),
+			})
+		case part.FunctionResponse != nil:
+			toolResults = append(toolResults, dto.ClaudeMediaMessage{
+				Type:      "tool_result",
+				ToolUseId: callIds.response(part.FunctionResponse),
+				Content:   geminiFunctionResponseText(part.FunctionResponse),
+			})
+		case part.Text != "":
+			block := dto.ClaudeMediaMessage{Type: "text"}
+			block.SetText(part.Text)
+			blocks = append(blocks, block)
+		case part.InlineData != nil:
+			blockType, err := geminiClaudeBlockType(part.InlineData.MimeType)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, dto.ClaudeMediaMessage{
+				Type: blockType,
+				Source: &dto.ClaudeMessageSource{
+					Type:      "base64",
+					MediaType: part.InlineData.MimeType,
+					Data:      part.InlineData.Data,
+				},
+			})
+		case part.FileData != nil:
+			blockType := "image"
+			if part.FileData.MimeType != "" {
+				var err error
+				if blockType, err = geminiClaudeBlockType(part.FileData.MimeType); err != nil {
+					return nil, err
+				}
+			}
+			blocks = append(blocks, dto.ClaudeMediaMessage{
+				Type: blockType,
+				Source: &dto.ClaudeMessageSource{
+					Type: "url",
+					Url:  part.FileData.FileUri,
+				},
+			})
+		case part.ExecutableCode != nil || part.CodeExecutionResult != nil:
+			block := dto.ClaudeMediaMessage{Type: "text"}
+			block.SetText(geminiCodeText(&part))
+			blocks = append(blocks, block)
+		}
+	}
+	blocks = append(toolResults, blocks...)
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	return &dto.ClaudeMessage{
+		Role:    role,
+		Content: blocks,
+	}, nil
+}
+
+func geminiClaudeBlockType(mimeType string) (string, error) {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image", nil
+	case mimeType == "application/pdf":
+		return "document", nil
+	}
+	return "", fmt.Errorf("unsupported mime type: %s", mimeType)
+}
+
+// finishReason2Gemini 同时处理 OpenAI 与 Claude 的结束原因
+func finishReason2Gemini(reason string) string {
+	switch reason {
+	case "length", "max_tokens":
+		return "MAX_TOKENS"
+	case "content_filter", "refusal":
+		return "SAFETY"
+	}
+	return "STOP"
+}
+
+func usage2Gemini(usage *dto.Usage, info *relaycommon.RelayInfo) GeminiUsageMetadata {
+	if usage == nil {
+		return GeminiUsageMetadata{}
+	}
+	promptTokens := usage.PromptTokens
+	if info.RelayFormat == relaycommon.RelayFormatClaude {
+		// Claude 的 input_tokens 不包含缓存部分
+		promptTokens += usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	}
+	reasoningTokens := usage.CompletionTokenDetails.ReasoningTokens
+	return GeminiUsageMetadata{
+		PromptTokenCount:        promptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens - reasoningTokens,
+		TotalTokenCount:         promptTokens + usage.CompletionTokens,
+		ThoughtsTokenCount:      reasoningTokens,
+		CachedContentTokenCount: usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
+func newGeminiConvertResponse(info *relaycommon.RelayInfo, candidates []GeminiChatCandidate) *GeminiChatResponse {
+	return &GeminiChatResponse{
+		Candidates:   candidates,
+		ModelVersion: info.GeminiConvertInfo.Model,
+	}
+}
+
+func geminiModelCandidate(index int, parts []GeminiPart, finishReason string) GeminiChatCandidate {
+	candidate := GeminiChatCandidate{
+		Content: GeminiChatContent{
+			Role:  "model",
+			Parts: parts,
+		},
+		Index: int64(index),
+	}
+	if finishReason != "" {
+		candidate.FinishReason = common.GetPointer[string](finishReason2Gemini(finishReason))
+	}
+	return candidate
+}
+
+func geminiFunctionCallPart(id string, name string, arguments string) GeminiPart {
+	var args any
+	if arguments != "" {
+		if err := common.UnmarshalJsonStr(arguments, &args); err != nil {
+			args = map[string]any{}
+		}
+	}
+	return GeminiPart{
+		FunctionCall: &FunctionCall{
+			Id:           id,
+			FunctionName: name,
+			Arguments:    args,
+		},
+	}
+}
+
+// ResponseOpenAI2Gemini 非流式 Chat Completions 响应转换为 Gemini 响应
+func ResponseOpenAI2Gemini(response *dto.OpenAITextResponse, info *relaycommon.RelayInfo, usage *dto.Usage) *GeminiChatResponse {
+	candidates := make([]GeminiChatCandidate, 0, len(response.Choices))
+	for _, choice := range response.Choices {
+		parts := make([]GeminiPart, 0)
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			parts = append(parts, GeminiPart{Text: text})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			parts = append(parts, geminiFunctionCallPart(toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+		candidates = append(candidates, geminiModelCandidate(choice.Index, parts, choice.FinishReason))
+	}
+	geminiResponse := newGeminiConvertResponse(info, candidates)
+	geminiResponse.ResponseId = response.Id
+	geminiResponse.UsageMetadata = usage2Gemini(usage, info)
+	return geminiResponse
+}
+
+// StreamResponseOpenAI2Gemini 流式 Chat Completions 响应块转换为 Gemini 响应块，返回 nil 表示无需输出
+// 只转换第一个候选，函数调用在参数完整后由 FinishStreamResponse2Gemini 输出
+func StreamResponseOpenAI2Gemini(streamResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) *GeminiChatResponse {
+	convertInfo := info.GeminiConvertInfo
+	if len(streamResponse.Choices) == 0 {
+		return nil
+	}
+	choice := streamResponse.Choices[0]
+	parts := make([]GeminiPart, 0)
+	if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+		parts = append(parts, GeminiPart{Text: reasoning, Thought: true})
+	}
+	if text := choice.Delta.GetContentString(); text != "" {
+		parts = append(parts, GeminiPart{Text: text})
+	}
+	for _, toolCall := range choice.Delta.ToolCalls {
+		index := 0
+		if toolCall.Index != nil {
+			index = *toolCall.Index
+		}
+		current, ok := convertInfo.ToolCalls[index]
+		if !ok {
+			current = &dto.ToolCallResponse{}
+			convertInfo.ToolCalls[index] = current
+			convertInfo.ToolCallOrder = append(convertInfo.ToolCallOrder, index)
+		}
+		if toolCall.ID != "" {
+			current.ID = toolCall.ID
+		}
+		if toolCall.Function.Name != "" {
+			current.Function.Name = toolCall.Function.Name
+		}
+		current.Function.Arguments += toolCall.Function.Arguments
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		convertInfo.FinishReason = *choice.FinishReason
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	geminiResponse := newGeminiConvertResponse(info, []GeminiChatCandidate{geminiModelCandidate(0, parts, "")})
+	geminiResponse.ResponseId = streamResponse.Id
+	return geminiResponse
+}
+
+// ResponseClaude2Gemini 非流式 Claude 响应转换为 Gemini 响应
+func ResponseClaude2Gemini(response *dto.ClaudeResponse, info *relaycommon.RelayInfo, usage *dto.Usage) *GeminiChatResponse {
+	parts := make([]GeminiPart, 0)
+	for _, content := range response.Content {
+		switch content.Type {
+		case "thinking":
+			parts = append(parts, GeminiPart{Text: content.Thinking, Thought: true})
+		case "text":
+			parts = append(parts, GeminiPart{Text: content.GetText()})
+		case "tool_use":
+			parts = append(parts, GeminiPart{
+				FunctionCall: &FunctionCall{
+					Id:           content.Id,
+					FunctionName: content.Name,
+					Arguments:    content.Input,
+				},
+			})
+		}
+	}
+	geminiResponse := newGeminiConvertResponse(info, []GeminiChatCandidate{geminiModelCandidate(0, parts, response.StopReason)})
+	geminiResponse.ResponseId = response.Id
+	geminiResponse.UsageMetadata = usage2Gemini(usage, info)
+	return geminiResponse
+}
+
+// StreamResponseClaude2Gemini Claude 流式事件转换为 Gemini 响应块，返回 nil 表示无需输出
+func StreamResponseClaude2Gemini(claudeResponse *dto.ClaudeResponse, info *relaycommon.RelayInfo) *GeminiChatResponse {
+	convertInfo := info.GeminiConvertInfo
+	index := claudeResponse.GetIndex()
+	parts := make([]GeminiPart, 0)
+	switch claudeResponse.Type {
+	case "content_block_start":
+		if block := claudeResponse.ContentBlock; block != nil {
+			switch block.Type {
+			case "tool_use":
+				convertInfo.ToolCalls[index] = &dto.ToolCallResponse{
+					ID:       block.Id,
+					Function: dto.FunctionResponse{Name: block.Name},
+				}
+			case "text":
+				if text := block.GetText(); text != "" {
+					parts = append(parts, GeminiPart{Text: text})
+				}
+			}
+		}
+	case "content_block_delta":
+		if delta := claudeResponse.Delta; delta != nil {
+			switch delta.Type {
+			case "text_delta":
+				parts = append(parts, GeminiPart{Text: delta.GetText()})
+			case "thinking_delta":
+				parts = append(parts, GeminiPart{Text: delta.Thinking, Thought: true})
+			case "input_json_delta":
+				if toolCall, ok := convertInfo.ToolCalls[index]; ok && delta.PartialJson != nil {
+					toolCall.Function.Arguments += *delta.PartialJson
+				}
+			}
+		}
+	case "content_block_stop":
+		// tool_use 在 content block 结束时参数完整
+		if toolCall, ok := convertInfo.ToolCalls[index]; ok {
+			delete(convertInfo.ToolCalls, index)
+			parts = append(parts, geminiFunctionCallPart(toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+	case "message_delta":
+		if claudeResponse.Delta != nil && claudeResponse.Delta.StopReason != nil {
+			convertInfo.FinishReason = *claudeResponse.Delta.StopReason
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return newGeminiConvertResponse(info, []GeminiChatCandidate{geminiModelCandidate(0, parts, "")})
+}
+
+// FinishStreamResponse2Gemini 流结束时输出剩余的函数调用、结束原因与用量
+func FinishStreamResponse2Gemini(info *relaycommon.RelayInfo, usage *dto.Usage) *GeminiChatResponse {
+	convertInfo := info.GeminiConvertInfo
+	parts := make([]GeminiPart, 0)
+	for _, index := range convertInfo.ToolCallOrder {
+		if toolCall, ok := convertInfo.ToolCalls[index]; ok {
+			parts = append(parts, geminiFunctionCallPart(toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+	}
+	finishReason := convertInfo.FinishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	geminiResponse := newGeminiConvertResponse(info, []GeminiChatCandidate{geminiModelCandidate(0, parts, finishReason)})
+	geminiResponse.UsageMetadata = usage2Gemini(usage, info)
+	return geminiResponse
+}
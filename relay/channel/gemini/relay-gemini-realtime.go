@@ -0,0 +1,574 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/types"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAI realtime 的 pcm16 为 24kHz 单声道，Gemini Live 输出同为 24kHz，输入需声明采样率
+const geminiLiveInputAudioMimeType = "audio/pcm;rate=24000"
+
+// OpenAI 音色映射到 Gemini 预置音色，Gemini 音色名直接透传
+var geminiLiveVoices = map[string]string{
+	"alloy":   "Aoede",
+	"ash":     "Charon",
+	"ballad":  "Orus",
+	"coral":   "Kore",
+	"echo":    "Puck",
+	"sage":    "Leda",
+	"shimmer": "Zephyr",
+	"verse":   "Fenrir",
+}
+
+// realtimeConverter 将 OpenAI realtime 事件转换为 Gemini Live 协议。
+// Gemini Live 的会话配置只能在连接后的第一条 setup 消息中设置，因此 setup 延迟到客户端发送第一个事件时再发送，
+// 使客户端在 session.created 之后发送的 session.update 仍然生效
+type realtimeConverter struct {
+	c    *gin.Context
+	info *relaycommon.RelayInfo
+
+	session         dto.RealtimeSession
+	manualActivity  bool // turn_detection 为 null 时由客户端 commit 控制轮次
+	setupSent       bool
+	activityStarted bool
+	pendingTurn     bool // 已通过 conversation.item.create 发送内容，等待 response.create
+
+	responseId  string
+	itemId      string // 当前 response 中 assistant 消息的 item，有音频或文本输出时才创建
+	inputItemId string
+	outputItems int
+	transcript  strings.Builder
+	usage       *dto.RealtimeUsage
+	callNames   map[string]string
+}
+
+func newRealtimeConverter(c *gin.Context, info *relaycommon.RelayInfo) *realtimeConverter {
+	return &realtimeConverter{
+		c:    c,
+		info: info,
+		session: dto.RealtimeSession{
+			Modalities:        []string{"text", "audio"},
+			InputAudioFormat:  "pcm16",
+			OutputAudioFormat: "pcm16",
+			TurnDetection:     map[string]any{"type": "server_vad"},
+		},
+		callNames: make(map[string]string),
+	}
+}
+
+func (r *realtimeConverter) Start() (*channel.RealtimeMessages, error) {
+	session := r.session
+	return &channel.RealtimeMessages{
+		Client: []*dto.RealtimeEvent{{
+			Type:    dto.RealtimeEventTypeSessionCreated,
+			Session: &session,
+		}},
+	}, nil
+}
+
+func (r *realtimeConverter) ConvertClientEvent(event *dto.RealtimeEvent, message []byte) (*channel.RealtimeMessages, error) {
+	messages := &channel.RealtimeMessages{}
+	if event.Type == dto.RealtimeEventTypeSessionUpdate {
+		return r.updateSession(event, message)
+	}
+	if err := r.ensureSetup(messages); err != nil {
+		return nil, err
+	}
+
+	switch event.Type {
+	case dto.RealtimeEventInputAudioBufferAppend:
+		if r.manualActivity && !r.activityStarted {
+			r.activityStarted = true
+			if err := appendLiveMessage(messages, GeminiLiveClientMessage{
+				RealtimeInput: &GeminiLiveRealtimeInput{ActivityStart: &struct{}{}},
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if err := appendLiveMessage(messages, GeminiLiveClientMessage{
+			RealtimeInput: &GeminiLiveRealtimeInput{
+				Audio: &GeminiInlineData{MimeType: geminiLiveInputAudioMimeType, Data: event.Audio},
+			},
+		}); err != nil {
+			return nil, err
+		}
+	case dto.RealtimeEventInputAudioBufferCommit:
+		if r.manualActivity && r.activityStarted {
+			// 手动轮次下 activityEnd 即触发生成，之后的 response.create 无需再发送
+			r.activityStarted = false
+			if err := appendLiveMessage(messages, GeminiLiveClientMessage{
+				RealtimeInput: &GeminiLiveRealtimeInput{ActivityEnd: &struct{}{}},
+			}); err != nil {
+				return nil, err
+			}
+		}
+		r.inputItemId = newRealtimeId("item")
+		messages.Client = append(messages.Client, &dto.RealtimeEvent{
+			Type:   dto.RealtimeEventInputAudioBufferCommitted,
+			ItemId: r.inputItemId,
+		})
+	case dto.RealtimeEventInputAudioBufferClear:
+		// 已发送的音频无法撤回，仅回复客户端
+		messages.Client = append(messages.Client, &dto.RealtimeEvent{
+			Type: dto.RealtimeEventInputAudioBufferCleared,
+		})
+	case dto.RealtimeEventTypeConversationCreate:
+		if event.Item == nil {
+			return messages, nil
+		}
+		item := *event.Item
+		if item.Id == "" {
+			item.Id = newRealtimeId("item")
+		}
+		switch item.Type {
+		case "function_call_output":
+			if err := appendLiveMessage(messages, GeminiLiveClientMessage{
+				ToolResponse: &GeminiLiveToolResponse{
+					FunctionResponses: []FunctionResponse{{
+						Id:       item.CallId,
+						Name:     r.callNames[item.CallId],
+						Response: functionOutput2Gemini(item.Output),
+					}},
+				},
+			}); err != nil {
+				return nil, err
+			}
+		case "message":
+			content := realtimeItem2Gemini(item)
+			if len(content.Parts) > 0 {
+				r.pendingTurn = true
+				if err := appendLiveMessage(messages, GeminiLiveClientMessage{
+					ClientContent: &GeminiLiveClientContent{Turns: []GeminiChatContent{content}},
+				}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		messages.Client = append(messages.Client, &dto.RealtimeEvent{
+			Type: dto.RealtimeEventConversationItemCreated,
+			Item: &item,
+		})
+	case dto.RealtimeEventTypeResponseCreate:
+		// 语音输入由上游自动检测轮次，只有文本输入需要显式结束本轮
+		if r.pendingTurn {
+			r.pendingTurn = false
+			if err := appendLiveMessage(messages, GeminiLiveClientMessage{
+				ClientContent: &GeminiLiveClientContent{TurnComplete: true},
+			}); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		common.LogInfo(r.c, fmt.Sprintf("gemini live ignores realtime event: %s", event.Type))
+	}
+	return messages, nil
+}
+
+func (r *realtimeConverter) updateSession(event *dto.RealtimeEvent, message []byte) (*channel.RealtimeMessages, error) {
+	messages := &channel.RealtimeMessages{}
+	if event.Session == nil {
+		return messages, nil
+	}
+	for _, format := range []string{event.Session.InputAudioFormat, event.Session.OutputAudioFormat} {
+		if format != "" && format != "pcm16" {
+			messages.Client = append(messages.Client, &dto.RealtimeEvent{
+				Type: dto.RealtimeEventTypeError,
+				Error: &types.OpenAIError{
+					Message: fmt.Sprintf("audio format %s is not supported by this model, only pcm16 is supported", format),
+					Type:    "invalid_request_error",
+					Code:    "unsupported_audio_format",
+				},
+			})
+			return messages, nil
+		}
+	}
+
+	if r.setupSent {
+		common.LogWarn(r.c, "gemini live does not support updating session after setup, session.update ignored")
+	} else {
+		var raw struct {
+			Session map[string]json.RawMessage `json:"session"`
+		}
+		if err := common.Unmarshal(message, &raw); err != nil {
+			return nil, err
+		}
+		update := event.Session
+		if update.Modalities != nil {
+			r.session.Modalities = update.Modalities
+		}
+		r.session.Instructions = common.GetStringIfEmpty(update.Instructions, r.session.Instructions)
+		r.session.Voice = common.GetStringIfEmpty(update.Voice, r.session.Voice)
+		if update.InputAudioTranscription.Model != "" {
+			r.session.InputAudioTranscription = update.InputAudioTranscription
+		}
+		if update.Tools != nil {
+			r.session.Tools = update.Tools
+		}
+		if update.Temperature != 0 {
+			r.session.Temperature = update.Temperature
+		}
+		if turnDetection, ok := raw.Session["turn_detection"]; ok {
+			r.session.TurnDetection = update.TurnDetection
+			r.manualActivity = string(turnDetection) == "null"
+		}
+		if err := r.ensureSetup(messages); err != nil {
+			return nil, err
+		}
+	}
+	session := r.session
+	messages.Client = append(messages.Client, &dto.RealtimeEvent{
+		Type:    dto.RealtimeEventTypeSessionUpdated,
+		Session: &session,
+	})
+	return messages, nil
+}
+
+func (r *realtimeConverter) ensureSetup(messages *channel.RealtimeMessages) error {
+	if r.setupSent {
+		return nil
+	}
+	r.setupSent = true
+	return appendLiveMessage(messages, GeminiLiveClientMessage{Setup: r.buildSetup()})
+}
+
+func (r *realtimeConverter) buildSetup() *GeminiLiveSetup {
+	setup := &GeminiLiveSetup{
+		Model:            "models/" + r.info.UpstreamModelName,
+		GenerationConfig: &GeminiChatGenerationConfig{},
+	}
+	// Gemini Live 每个会话只支持一种输出模态
+	if r.outputAudio() {
+		setup.GenerationConfig.ResponseModalities = []string{"AUDIO"}
+		setup.OutputAudioTranscription = &struct{}{}
+		if r.session.Voice != "" {
+			voice := r.session.Voice
+			if mapped, ok := geminiLiveVoices[strings.ToLower(voice)]; ok {
+				voice = mapped
+			}
+			speechConfig, _ := common.Marshal(map[string]any{
+				"voiceConfig": map[string]any{
+					"prebuiltVoiceConfig": map[string]any{"voiceName": voice},
+				},
+			})
+			setup.GenerationConfig.SpeechConfig = speechConfig
+		}
+	} else {
+		setup.GenerationConfig.ResponseModalities = []string{"TEXT"}
+	}
+	if r.session.Temperature > 0 {
+		temperature := r.session.Temperature
+		setup.GenerationConfig.Temperature = &temperature
+	}
+	if r.session.Instructions != "" {
+		setup.SystemInstruction = &GeminiChatContent{
+			Parts: []GeminiPart{{Text: r.session.Instructions}},
+		}
+	}
+	var functions []dto.FunctionRequest
+	for _, tool := range r.session.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		functions = append(functions, dto.FunctionRequest{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  cleanFunctionParameters(tool.Parameters),
+		})
+	}
+	if len(functions) > 0 {
+		setup.Tools = []GeminiChatTool{{FunctionDeclarations: functions}}
+	}
+	if r.manualActivity {
+		setup.RealtimeInputConfig = &GeminiLiveRealtimeInputConfig{
+			AutomaticActivityDetection: &GeminiLiveActivityDetection{Disabled: true},
+		}
+	}
+	if r.session.InputAudioTranscription.Model != "" {
+		setup.InputAudioTranscription = &struct{}{}
+	}
+	return setup
+}
+
+func (r *realtimeConverter) outputAudio() bool {
+	return common.StringsContains(r.session.Modalities, "audio")
+}
+
+func (r *realtimeConverter) ConvertUpstreamMessage(message []byte) (*channel.RealtimeMessages, error) {
+	var liveMessage GeminiLiveServerMessage
+	if err := common.Unmarshal(message, &liveMessage); err != nil {
+		return nil, fmt.Errorf("error unmarshalling gemini live message: %v", err)
+	}
+	messages := &channel.RealtimeMessages{}
+
+	if liveMessage.UsageMetadata != nil {
+		// 同一轮中以最后一次返回的用量为准，在 response.done 时计费
+		r.usage = liveUsage2Realtime(liveMessage.UsageMetadata)
+	}
+	if liveMessage.GoAway != nil {
+		common.LogWarn(r.c, "gemini live session will be closed soon, time left: "+liveMessage.GoAway.TimeLeft)
+	}
+	if liveMessage.ToolCallCancellation != nil {
+		common.LogInfo(r.c, fmt.Sprintf("gemini live tool calls cancelled: %v", liveMessage.ToolCallCancellation.Ids))
+	}
+
+	if content := liveMessage.ServerContent; content != nil {
+		if content.InputTranscription != nil && content.InputTranscription.Text != "" {
+			if r.inputItemId == "" {
+				r.inputItemId = newRealtimeId("item")
+			}
+			messages.Client = append(messages.Client, &dto.RealtimeEvent{
+				Type:   dto.RealtimeEventInputAudioTranscriptionDelta,
+				ItemId: r.inputItemId,
+				Delta:  content.InputTranscription.Text,
+			})
+		}
+		if content.Interrupted {
+			messages.Client = append(messages.Client, &dto.RealtimeEvent{
+				Type: dto.RealtimeEventInputAudioBufferSpeechStarted,
+			})
+			r.finishResponse(messages, "cancelled")
+		}
+		if content.ModelTurn != nil {
+			for _, part := range content.ModelTurn.Parts {
+				if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "audio/") {
+					r.startMessage(messages)
+					messages.Client = append(messages.Client, r.contentEvent(dto.RealtimeEventResponseAudioDelta, part.InlineData.Data))
+				} else if part.Text != "" && !part.Thought && !r.outputAudio() {
+					r.startMessage(messages)
+					r.transcript.WriteString(part.Text)
+					messages.Client = append(messages.Client, r.contentEvent(dto.RealtimeEventResponseTextDelta, part.Text))
+				}
+			}
+		}
+		if content.OutputTranscription != nil && content.OutputTranscription.Text != "" {
+			r.startMessage(messages)
+			r.transcript.WriteString(content.OutputTranscription.Text)
+			messages.Client = append(messages.Client, r.contentEvent(dto.RealtimeEventResponseAudioTranscriptionDelta, content.OutputTranscription.Text))
+		}
+		if content.TurnComplete {
+			r.finishResponse(messages, "completed")
+		}
+	}
+
+	if liveMessage.ToolCall != nil && len(liveMessage.ToolCall.FunctionCalls) > 0 {
+		r.startResponse(messages)
+		for _, call := range liveMessage.ToolCall.FunctionCalls {
+			callId := call.Id
+			if callId == "" {
+				callId = newRealtimeId("call")
+			}
+			r.callNames[callId] = call.FunctionName
+			arguments, err := common.Marshal(call.Arguments)
+			if err != nil {
+				return nil, err
+			}
+			item := &dto.RealtimeItem{
+				Id:        newRealtimeId("item"),
+				Type:      "function_call",
+				Status:    "completed",
+				Name:      common.GetPointer(call.FunctionName),
+				CallId:    callId,
+				Arguments: string(arguments),
+			}
+			base := dto.RealtimeEvent{
+				ResponseId:  r.responseId,
+				ItemId:      item.Id,
+				OutputIndex: r.outputItems,
+				CallId:      callId,
+			}
+			r.outputItems++
+			added := base
+			added.Type = dto.RealtimeEventResponseOutputItemAdded
+			added.Item = item
+			delta := base
+			delta.Type = dto.RealtimeEventResponseFunctionCallArgumentsDelta
+			delta.Delta = string(arguments)
+			done := base
+			done.Type = dto.RealtimeEventResponseFunctionCallArgumentsDone
+			done.Name = call.FunctionName
+			done.Arguments = string(arguments)
+			itemDone := base
+			itemDone.Type = dto.RealtimeEventResponseOutputItemDone
+			itemDone.Item = item
+			messages.Client = append(messages.Client, &added, &delta, &done, &itemDone)
+		}
+		// 与 OpenAI 一致，函数调用后结束本次 response，等待客户端返回结果
+		r.finishResponse(messages, "completed")
+	}
+	if r.responseId == "" && r.usage != nil {
+		// 用量在 response.done 之后才返回，属于上一次 response
+		messages.Usage = r.usage
+		r.usage = nil
+	}
+	return messages, nil
+}
+
+func (r *realtimeConverter) startResponse(messages *channel.RealtimeMessages) {
+	if r.responseId != "" {
+		return
+	}
+	r.responseId = newRealtimeId("resp")
+	r.outputItems = 0
+	messages.Client = append(messages.Client, &dto.RealtimeEvent{
+		Type: dto.RealtimeEventResponseCreated,
+		Response: &dto.RealtimeResponse{
+			Id:     r.responseId,
+			Object: "realtime.response",
+			Status: "in_progress",
+		},
+	})
+}
+
+func (r *realtimeConverter) startMessage(messages *channel.RealtimeMessages) {
+	r.startResponse(messages)
+	if r.itemId != "" {
+		return
+	}
+	r.itemId = newRealtimeId("item")
+	r.transcript.Reset()
+	messages.Client = append(messages.Client, &dto.RealtimeEvent{
+		Type:        dto.RealtimeEventResponseOutputItemAdded,
+		ResponseId:  r.responseId,
+		OutputIndex: r.outputItems,
+		Item: &dto.RealtimeItem{
+			Id:     r.itemId,
+			Type:   "message",
+			Status: "in_progress",
+			Role:   "assistant",
+		},
+	})
+	r.outputItems++
+}
+
+func (r *realtimeConverter) contentEvent(eventType string, delta string) *dto.RealtimeEvent {
+	return &dto.RealtimeEvent{
+		Type:       eventType,
+		ResponseId: r.responseId,
+		ItemId:     r.itemId,
+		Delta:      delta,
+	}
+}
+
+func (r *realtimeConverter) finishResponse(messages *channel.RealtimeMessages, status string) {
+	if r.responseId == "" {
+		return
+	}
+	if r.itemId != "" {
+		transcript := r.transcript.String()
+		content := dto.RealtimeContent{Type: "text", Text: transcript}
+		if r.outputAudio() {
+			messages.Client = append(messages.Client,
+				&dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioDone, ResponseId: r.responseId, ItemId: r.itemId},
+				&dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioTranscriptionDone, ResponseId: r.responseId, ItemId: r.itemId, Transcript: transcript},
+			)
+			content = dto.RealtimeContent{Type: "audio", Transcript: transcript}
+		} else {
+			messages.Client = append(messages.Client,
+				&dto.RealtimeEvent{Type: dto.RealtimeEventResponseTextDone, ResponseId: r.responseId, ItemId: r.itemId, Text: transcript},
+			)
+		}
+		messages.Client = append(messages.Client, &dto.RealtimeEvent{
+			Type:       dto.RealtimeEventResponseOutputItemDone,
+			ResponseId: r.responseId,
+			Item: &dto.RealtimeItem{
+				Id:      r.itemId,
+				Type:    "message",
+				Status:  status,
+				Role:    "assistant",
+				Content: []dto.RealtimeContent{content},
+			},
+		})
+	}
+	messages.Client = append(messages.Client, &dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeResponseDone,
+		Response: &dto.RealtimeResponse{
+			Id:     r.responseId,
+			Object: "realtime.response",
+			Status: status,
+			Usage:  r.usage,
+		},
+	})
+	r.usage = nil
+	r.responseId = ""
+	r.itemId = ""
+}
+
+func appendLiveMessage(messages *channel.RealtimeMessages, message GeminiLiveClientMessage) error {
+	data, err := common.Marshal(message)
+	if err != nil {
+		return err
+	}
+	messages.Upstream = append(messages.Upstream, data)
+	return nil
+}
+
+func realtimeItem2Gemini(item dto.RealtimeItem) GeminiChatContent {
+	content := GeminiChatContent{Role: "user"}
+	if item.Role == "assistant" {
+		content.Role = "model"
+	}
+	for _, c := range item.Content {
+		switch c.Type {
+		case "input_text", "text":
+			if c.Text != "" {
+				content.Parts = append(content.Parts, GeminiPart{Text: c.Text})
+			}
+		case "input_audio", "audio":
+			if c.Audio != "" {
+				content.Parts = append(content.Parts, GeminiPart{
+					InlineData: &GeminiInlineData{MimeType: geminiLiveInputAudioMimeType, Data: c.Audio},
+				})
+			} else if c.Transcript != "" {
+				content.Parts = append(content.Parts, GeminiPart{Text: c.Transcript})
+			}
+		}
+	}
+	return content
+}
+
+// functionOutput2Gemini function_call_output 的 output 为字符串，JSON 对象直接作为 response
+func functionOutput2Gemini(output string) map[string]interface{} {
+	var response map[string]interface{}
+	if err := common.Unmarshal([]byte(output), &response); err == nil {
+		return response
+	}
+	return map[string]interface{}{"output": output}
+}
+
+func liveUsage2Realtime(metadata *GeminiLiveUsageMetadata) *dto.RealtimeUsage {
+	usage := &dto.RealtimeUsage{
+		InputTokens:  metadata.PromptTokenCount,
+		OutputTokens: metadata.ResponseTokenCount + metadata.ThoughtsTokenCount,
+		TotalTokens:  metadata.TotalTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	usage.InputTokenDetails.AudioTokens = modalityTokens(metadata.PromptTokensDetails, "AUDIO")
+	usage.InputTokenDetails.TextTokens = usage.InputTokens - usage.InputTokenDetails.AudioTokens
+	usage.OutputTokenDetails.AudioTokens = modalityTokens(metadata.ResponseTokensDetails, "AUDIO")
+	usage.OutputTokenDetails.TextTokens = usage.OutputTokens - usage.OutputTokenDetails.AudioTokens
+	return usage
+}
+
+func modalityTokens(details []GeminiPromptTokensDetails, modality string) int {
+	tokens := 0
+	for _, detail := range details {
+		if detail.Modality == modality {
+			tokens += detail.TokenCount
+		}
+	}
+	return tokens
+}
+
+func newRealtimeId(prefix string) string {
+	return fmt.Sprintf("%s_%s", prefix, common.GetRandomString(24))
+}
@@ -12,6 +12,7 @@ import (
 	"one-api/relay/channel/openai"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
 	"one-api/types"
 )
 
@@ -71,6 +72,21 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 		payload.ReturnURL = true // Default to returning image URLs
 	}
 
+	switch info.RelayMode {
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
+		// 图生图：参考图以 base64 传入
+		form, err := helper.ParseImageForm(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range form.Images {
+			payload.BinaryData = append(payload.BinaryData, image.Base64())
+		}
+		if payload.Prompt == "" {
+			payload.Prompt = helper.ImageVariationPrompt
+		}
+	}
+
 	if len(request.ExtraFields) > 0 {
 		if err := json.Unmarshal(request.ExtraFields, &payload); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal extra fields: %w", err)
@@ -117,12 +133,15 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
-	if info.RelayMode == relayconstant.RelayModeImagesGenerations {
+	switch info.RelayMode {
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		usage, err = jimengImageHandler(c, resp, info)
-	} else if info.IsStream {
-		usage, err = openai.OaiStreamHandler(c, info, resp)
-	} else {
-		usage, err = openai.OpenaiHandler(c, info, resp)
+	default:
+		if info.IsStream {
+			usage, err = openai.OaiStreamHandler(c, info, resp)
+		} else {
+			usage, err = openai.OpenaiHandler(c, info, resp)
+		}
 	}
 	return
 }
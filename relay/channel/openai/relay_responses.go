@@ -1,6 +1,8 @@
 package openai
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -31,6 +33,9 @@ func OaiResponsesHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 	if responsesResponse.Error != nil {
 		return nil, types.WithOpenAIError(*responsesResponse.Error, resp.StatusCode)
 	}
+	if info.ResponsesStoreInfo != nil {
+		info.ResponsesStoreInfo.Response = responseBody
+	}
 
 	// 写入新的 response body
 	common.IOCopyBytesGracefully(c, resp, responseBody)
@@ -64,6 +69,14 @@ func OaiResponsesStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 			sendResponsesStreamData(c, streamResponse, data)
 			switch streamResponse.Type {
 			case "response.completed":
+				if info.ResponsesStoreInfo != nil {
+					var completed struct {
+						Response json.RawMessage `json:"response"`
+					}
+					if err := common.UnmarshalJsonStr(data, &completed); err == nil {
+						info.ResponsesStoreInfo.Response = completed.Response
+					}
+				}
 				usage.PromptTokens = streamResponse.Response.Usage.InputTokens
 				usage.CompletionTokens = streamResponse.Response.Usage.OutputTokens
 				usage.TotalTokens = streamResponse.Response.Usage.TotalTokens
@@ -95,3 +108,116 @@ func OaiResponsesStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 
 	return usage, nil
 }
+
+// OaiResponsesToChatHandler Chat Completions 请求以 Responses API 请求上游时，将响应转换回 Chat Completions
+func OaiResponsesToChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer common.CloseResponseBodyGracefully(resp)
+
+	var responsesResponse dto.OpenAIResponsesResponse
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeReadResponseBodyFailed)
+	}
+	err = common.Unmarshal(responseBody, &responsesResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	if responsesResponse.Error != nil {
+		return nil, types.WithOpenAIError(*responsesResponse.Error, resp.StatusCode)
+	}
+
+	openAIResponse := service.ResponseResponses2OpenAI(&responsesResponse, info)
+	responseBody, err = common.Marshal(openAIResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	common.IOCopyBytesGracefully(c, resp, responseBody)
+
+	usage := openAIResponse.Usage
+	return &usage, nil
+}
+
+// OaiResponsesToChatStreamHandler 将 Responses 流式事件转换为 Chat Completions 流式块
+func OaiResponsesToChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	if resp == nil || resp.Body == nil {
+		common.LogError(c, "invalid response or response body")
+		return nil, types.NewError(fmt.Errorf("invalid response"), types.ErrorCodeBadResponse)
+	}
+
+	defer common.CloseResponseBodyGracefully(resp)
+
+	var usage *dto.Usage
+	var responseTextBuilder strings.Builder
+	var streamErr *types.OpenAIError
+	streamErrWritten := false
+
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		var streamResponse dto.ResponsesStreamResponse
+		if err := common.UnmarshalJsonStr(data, &streamResponse); err != nil {
+			common.SysError("error unmarshalling responses stream response: " + err.Error())
+			return true
+		}
+		switch streamResponse.Type {
+		case dto.ResponsesStreamTypeCompleted, dto.ResponsesStreamTypeIncomplete:
+			if streamResponse.Response != nil && streamResponse.Response.Usage != nil {
+				usage = service.UsageResponses2OpenAI(streamResponse.Response.Usage)
+			}
+		case dto.ResponsesStreamTypeFailed, dto.ResponsesStreamTypeError:
+			streamErr = responsesStreamError(&streamResponse)
+			common.LogError(c, "responses stream failed: "+streamErr.Message)
+			if c.Writer.Written() {
+				// 已向客户端输出内容，以 Chat Completions 的错误块结束流
+				streamErrWritten = true
+				if err := helper.ObjectData(c, gin.H{"error": streamErr}); err != nil {
+					common.SysError("error sending stream response: " + err.Error())
+				}
+			}
+			return false
+		case dto.ResponsesStreamTypeOutputTextDelta, dto.ResponsesStreamTypeReasoningTextDelta, dto.ResponsesStreamTypeFunctionArgumentDelta:
+			responseTextBuilder.WriteString(streamResponse.Delta)
+		}
+		if chunk := service.StreamResponseResponses2OpenAI(&streamResponse, info); chunk != nil {
+			if err := helper.ObjectData(c, chunk); err != nil {
+				common.SysError("error sending stream response: " + err.Error())
+			}
+		}
+		return true
+	})
+
+	if streamErr != nil {
+		if streamErrWritten {
+			// 已输出部分内容，不能再换渠道重试，作为流错误返回
+			return nil, types.NewErrorWithStatusCode(errors.New(streamErr.Message), types.ErrorCodeBadResponse, http.StatusBadGateway)
+		}
+		// 尚未输出内容，按上游错误返回，由上层换渠道重试
+		return nil, types.WithOpenAIError(*streamErr, http.StatusInternalServerError)
+	}
+	if usage == nil || usage.CompletionTokens == 0 {
+		// 非正常结束，使用输出文本的 token 数量
+		usage = service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+	if info.ShouldIncludeUsage {
+		convertInfo := info.ChatCompletionsConvertInfo
+		_ = helper.ObjectData(c, helper.GenerateFinalUsageResponse(convertInfo.ResponseId, convertInfo.Created, convertInfo.Model, *usage))
+	}
+	helper.Done(c)
+	return usage, nil
+}
+
+// responsesStreamError 取出 response.failed 或 error 事件中的错误信息
+func responsesStreamError(streamResponse *dto.ResponsesStreamResponse) *types.OpenAIError {
+	streamErr := &types.OpenAIError{
+		Message: streamResponse.Message,
+		Code:    streamResponse.Code,
+	}
+	if streamResponse.Response != nil && streamResponse.Response.Error != nil {
+		streamErr = streamResponse.Response.Error
+	}
+	if streamErr.Type == "" {
+		streamErr.Type = "upstream_error"
+	}
+	if streamErr.Message == "" {
+		streamErr.Message = "upstream response failed"
+	}
+	return streamErr
+}
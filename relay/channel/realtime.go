@@ -0,0 +1,267 @@
+package channel
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/types"
+	"sync"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// RealtimeHandler 在客户端的 OpenAI realtime 会话与其它实时协议的上游之间转发消息，
+// 每次 response 优先使用上游返回的用量，上游未返回时才按事件本地估算
+func RealtimeHandler(c *gin.Context, info *relaycommon.RelayInfo, converter RealtimeConverter) (*types.NewAPIError, *dto.RealtimeUsage) {
+	if info == nil || info.ClientWs == nil || info.TargetWs == nil {
+		return types.NewError(fmt.Errorf("invalid websocket connection"), types.ErrorCodeBadResponse), nil
+	}
+
+	info.IsStream = true
+	clientConn := info.ClientWs
+	targetConn := info.TargetWs
+
+	clientClosed := make(chan struct{})
+	targetClosed := make(chan struct{})
+	errChan := make(chan error, 2)
+
+	// 两个方向的转换共享会话状态，同时 websocket 不支持并发写
+	var mu sync.Mutex
+	localUsage := &dto.RealtimeUsage{}
+	sumUsage := &dto.RealtimeUsage{}
+	// 已结束但上游未返回用量的 response 的本地估算，上游随后补发用量时丢弃，否则在下一次 response 开始或会话结束时计费
+	var pendingUsage *dto.RealtimeUsage
+	consumePending := func() error {
+		if pendingUsage == nil {
+			return nil
+		}
+		usage := pendingUsage
+		pendingUsage = nil
+		return PreConsumeRealtimeUsage(c, info, usage, sumUsage)
+	}
+
+	countLocal := func(event *dto.RealtimeEvent, input bool) error {
+		textToken, audioToken, err := service.CountTokenRealtime(info, *event, info.UpstreamModelName)
+		if err != nil {
+			return fmt.Errorf("error counting text token: %v", err)
+		}
+		localUsage.TotalTokens += textToken + audioToken
+		if input {
+			localUsage.InputTokens += textToken + audioToken
+			localUsage.InputTokenDetails.TextTokens += textToken
+			localUsage.InputTokenDetails.AudioTokens += audioToken
+		} else {
+			localUsage.OutputTokens += textToken + audioToken
+			localUsage.OutputTokenDetails.TextTokens += textToken
+			localUsage.OutputTokenDetails.AudioTokens += audioToken
+		}
+		return nil
+	}
+
+	// dispatch 发送转换结果并计费，调用方持有 mu
+	dispatch := func(messages *RealtimeMessages, fromUpstream bool) error {
+		if messages == nil {
+			return nil
+		}
+		for _, message := range messages.Upstream {
+			if err := helper.WssString(c, targetConn, string(message)); err != nil {
+				return fmt.Errorf("error writing to target: %v", err)
+			}
+		}
+		if messages.Usage != nil {
+			// 上游补发了上一次 response 的用量，以此代替本地估算
+			pendingUsage = nil
+			if err := PreConsumeRealtimeUsage(c, info, messages.Usage, sumUsage); err != nil {
+				return fmt.Errorf("error consume usage: %v", err)
+			}
+		}
+		for _, event := range messages.Client {
+			if event.EventId == "" {
+				event.EventId = helper.GetLocalRealtimeID(c)
+			}
+			if fromUpstream {
+				switch event.Type {
+				case dto.RealtimeEventTypeSessionCreated, dto.RealtimeEventTypeSessionUpdated:
+					if event.Session != nil {
+						info.InputAudioFormat = common.GetStringIfEmpty(event.Session.InputAudioFormat, info.InputAudioFormat)
+						info.OutputAudioFormat = common.GetStringIfEmpty(event.Session.OutputAudioFormat, info.OutputAudioFormat)
+					}
+				case dto.RealtimeEventResponseCreated:
+					if err := consumePending(); err != nil {
+						return fmt.Errorf("error consume usage: %v", err)
+					}
+				case dto.RealtimeEventTypeResponseDone:
+					if err := consumePending(); err != nil {
+						return fmt.Errorf("error consume usage: %v", err)
+					}
+					if event.Response != nil && event.Response.Usage != nil {
+						// 以上游用量为准，丢弃本地估算
+						localUsage = &dto.RealtimeUsage{}
+						if err := PreConsumeRealtimeUsage(c, info, event.Response.Usage, sumUsage); err != nil {
+							return fmt.Errorf("error consume usage: %v", err)
+						}
+					} else {
+						if err := countLocal(event, true); err != nil {
+							return err
+						}
+						pendingUsage = localUsage
+						localUsage = &dto.RealtimeUsage{}
+					}
+					info.IsFirstRequest = false
+				default:
+					if err := countLocal(event, false); err != nil {
+						return err
+					}
+				}
+			}
+			if err := helper.WssObject(c, clientConn, event); err != nil {
+				return fmt.Errorf("error writing to client: %v", err)
+			}
+		}
+		return nil
+	}
+
+	mu.Lock()
+	messages, err := converter.Start()
+	if err == nil {
+		err = dispatch(messages, true)
+	}
+	mu.Unlock()
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in client reader: %v", r)
+			}
+		}()
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+				_, message, err := clientConn.ReadMessage()
+				if err != nil {
+					if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+						errChan <- fmt.Errorf("error reading from client: %v", err)
+					}
+					close(clientClosed)
+					return
+				}
+
+				realtimeEvent := &dto.RealtimeEvent{}
+				err = common.Unmarshal(message, realtimeEvent)
+				if err != nil {
+					errChan <- fmt.Errorf("error unmarshalling message: %v", err)
+					return
+				}
+				if realtimeEvent.Type == dto.RealtimeEventTypeSessionUpdate && realtimeEvent.Session != nil {
+					if realtimeEvent.Session.Tools != nil {
+						info.RealtimeTools = realtimeEvent.Session.Tools
+					}
+				}
+
+				mu.Lock()
+				err = countLocal(realtimeEvent, true)
+				if err == nil {
+					var messages *RealtimeMessages
+					messages, err = converter.ConvertClientEvent(realtimeEvent, message)
+					if err == nil {
+						err = dispatch(messages, false)
+					}
+				}
+				mu.Unlock()
+				if err != nil {
+					errChan <- err
+					return
+				}
+			}
+		}
+	})
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in target reader: %v", r)
+			}
+		}()
+		for {
+			select {
+			case <-c.Done():
+				return
+			default:
+				_, message, err := targetConn.ReadMessage()
+				if err != nil {
+					if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code != websocket.CloseNormalClosure && closeErr.Text != "" {
+						// 上游通过关闭帧返回错误原因，转发给客户端
+						mu.Lock()
+						helper.WssError(c, clientConn, types.OpenAIError{
+							Message: closeErr.Text,
+							Type:    "upstream_error",
+							Code:    closeErr.Code,
+						})
+						mu.Unlock()
+					}
+					if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+						errChan <- fmt.Errorf("error reading from target: %v", err)
+					}
+					close(targetClosed)
+					return
+				}
+				info.SetFirstResponseTime()
+
+				mu.Lock()
+				messages, err := converter.ConvertUpstreamMessage(message)
+				if err == nil {
+					err = dispatch(messages, true)
+				}
+				mu.Unlock()
+				if err != nil {
+					errChan <- err
+					return
+				}
+			}
+		}
+	})
+
+	select {
+	case <-clientClosed:
+	case <-targetClosed:
+	case err := <-errChan:
+		common.LogError(c, "realtime error: "+err.Error())
+	case <-c.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	_ = consumePending()
+	if localUsage.TotalTokens != 0 {
+		_ = PreConsumeRealtimeUsage(c, info, localUsage, sumUsage)
+	}
+	common.LogInfo(c, fmt.Sprintf("realtime streaming sumUsage: %v", sumUsage))
+	return nil, sumUsage
+}
+
+// PreConsumeRealtimeUsage 累计会话用量并按本次用量扣费
+func PreConsumeRealtimeUsage(ctx *gin.Context, info *relaycommon.RelayInfo, usage *dto.RealtimeUsage, totalUsage *dto.RealtimeUsage) error {
+	if usage == nil || totalUsage == nil {
+		return fmt.Errorf("invalid usage pointer")
+	}
+
+	totalUsage.TotalTokens += usage.TotalTokens
+	totalUsage.InputTokens += usage.InputTokens
+	totalUsage.OutputTokens += usage.OutputTokens
+	totalUsage.InputTokenDetails.CachedTokens += usage.InputTokenDetails.CachedTokens
+	totalUsage.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	totalUsage.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	totalUsage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	totalUsage.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+	return service.PreWssConsumeQuota(ctx, info, usage)
+}
@@ -0,0 +1,11 @@
+package volcengine
+
+// ImageRequest images/generations 图生图请求，image 为单张图片或图片数组
+type ImageRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	Image          any    `json:"image,omitempty"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+	Watermark      *bool  `json:"watermark,omitempty"`
+}
@@ -140,7 +140,12 @@ func ClaudeHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 	}
 
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, relayInfo)
+	recordHedgeLoserCost(c, relayInfo, usage, priceData)
 	//log.Printf("usage: %v", usage)
+	if failoverErr := helper.StreamFailoverError(c); failoverErr != nil {
+		// 首个内容块前失败，本次尝试不计费，交由上层重试
+		newAPIError = failoverErr
+	}
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"encoding/json"
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
@@ -59,6 +60,55 @@ type ResponsesUsageInfo struct {
 	BuiltInTools map[string]*BuildInToolInfo
 }
 
+// ResponsesConvertInfo Responses 请求转换为 Chat Completions 后，响应转换回 Responses 所需的状态
+type ResponsesConvertInfo struct {
+	Request        *dto.OpenAIResponsesRequest
+	ResponseId     string
+	CreatedAt      int
+	Model          string
+	SequenceNumber int
+	Started        bool
+	Output         []dto.ResponsesOutput
+	// 当前正在输出的 reasoning 或 message
+	CurrentItem *dto.ResponsesOutput
+	CurrentText strings.Builder
+	// 正在输出的函数调用，key 为 chat completions 中的 tool call index
+	ToolCallItems map[int]*dto.ResponsesOutput
+	ToolCallOrder []int
+	FinishReason  string
+}
+
+// ChatCompletionsConvertInfo Chat Completions 请求转换为 Responses 后，响应转换回 Chat Completions 所需的状态
+type ChatCompletionsConvertInfo struct {
+	ResponseId string
+	Created    int64
+	Model      string
+	// Responses 中函数调用的 item id 到 tool call index 的映射
+	ToolCallIndexes map[string]int
+	FinishReason    string
+}
+
+// GeminiConvertInfo Gemini 格式请求转换为 OpenAI 或 Claude 格式后，响应转换回 Gemini 所需的状态
+type GeminiConvertInfo struct {
+	Model string
+	// 流式函数调用的参数分片到达，完整后再作为 functionCall 输出
+	// OpenAI 以 tool call index 为 key，Claude 以 content block index 为 key
+	ToolCalls     map[int]*dto.ToolCallResponse
+	ToolCallOrder []int
+	FinishReason  string
+}
+
+// ResponsesStoreInfo 网关保存 Responses 会话状态所需的信息
+type ResponsesStoreInfo struct {
+	// 本轮新增的输入 items
+	Input json.RawMessage
+	// 上一轮 response 与所在会话，保存时沿用为会话链
+	PreviousResponseId string
+	ConversationId     string
+	// 最终返回给客户端的 response 对象，由各响应处理函数填充
+	Response json.RawMessage
+}
+
 type RelayInfo struct {
 	ChannelType       int
 	ChannelId         int
@@ -68,6 +118,11 @@ type RelayInfo struct {
 	UsingGroup        string // 使用的分组
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
+	TokenPeriodStart  int64  // 令牌预算本周期的开始时间，周期额度按此周期预留与结算，0 为未启用
+	UserCreditLimit   int    // 用户的授信额度，余额最多可透支到 -UserCreditLimit
+	TokenTpmLimit     int    // 令牌的每分钟 token 数上限，0 为不限制
+	TokenTpmCharged   int    // 本次尝试按预估的提示词 token 数计入 TPM 的数量，结算时按实际用量校正
+	ReservationId     string // 额度预留账本中的预扣记录 id，结算时释放
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -109,6 +164,13 @@ type RelayInfo struct {
 	*ClaudeConvertInfo
 	*RerankerInfo
 	*ResponsesUsageInfo
+	ResponsesConvertInfo *ResponsesConvertInfo
+	// 不为 nil 表示 Chat Completions 请求已转换为 Responses 请求上游
+	ChatCompletionsConvertInfo *ChatCompletionsConvertInfo
+	// 不为 nil 表示 Gemini 格式请求已转换为其它格式请求上游
+	GeminiConvertInfo *GeminiConvertInfo
+	// 不为 nil 表示需要在网关保存本次 response
+	ResponsesStoreInfo *ResponsesStoreInfo
 }
 
 // 定义支持流式选项的通道类型
@@ -156,6 +218,51 @@ func GenRelayInfoRerank(c *gin.Context, req *dto.RerankRequest) *RelayInfo {
 	return info
 }
 
+// ConvertResponsesToChatCompletions 上游不支持 Responses API 时，改为以 Chat Completions 请求上游
+func (info *RelayInfo) ConvertResponsesToChatCompletions(request *dto.OpenAIResponsesRequest) {
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RelayFormat = RelayFormatOpenAI
+	info.RequestURLPath = "/v1/chat/completions"
+	info.SupportStreamOptions = streamSupportedChannels[info.ChannelType]
+	// 流式响应需要最后的 usage 块来生成 response.completed
+	info.ShouldIncludeUsage = info.IsStream
+	info.ResponsesConvertInfo = &ResponsesConvertInfo{
+		Request:       request,
+		ResponseId:    "resp_" + common.GetUUID(),
+		CreatedAt:     int(info.StartTime.Unix()),
+		Model:         info.OriginModelName,
+		ToolCallItems: make(map[int]*dto.ResponsesOutput),
+	}
+}
+
+// ConvertGeminiToOpenAI 非 Gemini 渠道以 Chat Completions 请求上游
+func (info *RelayInfo) ConvertGeminiToOpenAI() {
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RelayFormat = RelayFormatOpenAI
+	info.RequestURLPath = "/v1/chat/completions"
+	info.SupportStreamOptions = streamSupportedChannels[info.ChannelType]
+	// 流式响应需要最后的 usage 块来生成 usageMetadata
+	info.ShouldIncludeUsage = info.IsStream
+	info.GeminiConvertInfo = &GeminiConvertInfo{
+		Model:     info.OriginModelName,
+		ToolCalls: make(map[int]*dto.ToolCallResponse),
+	}
+}
+
+// ConvertGeminiToClaude Claude 渠道以 Messages 请求上游
+func (info *RelayInfo) ConvertGeminiToClaude() {
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RelayFormat = RelayFormatClaude
+	info.RequestURLPath = "/v1/messages"
+	info.ClaudeConvertInfo = &ClaudeConvertInfo{
+		LastMessagesType: LastMessageTypeNone,
+	}
+	info.GeminiConvertInfo = &GeminiConvertInfo{
+		Model:     info.OriginModelName,
+		ToolCalls: make(map[int]*dto.ToolCallResponse),
+	}
+}
+
 func GenRelayInfoOpenAIAudio(c *gin.Context) *RelayInfo {
 	info := GenRelayInfo(c)
 	info.RelayFormat = RelayFormatOpenAIAudio
@@ -228,6 +335,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 
 	info := &RelayInfo{
 		UserQuota:         common.GetContextKeyInt(c, constant.ContextKeyUserQuota),
+		UserCreditLimit:   common.GetContextKeyInt(c, constant.ContextKeyUserCredit),
 		UserEmail:         common.GetContextKeyString(c, constant.ContextKeyUserEmail),
 		isFirstResponse:   true,
 		RelayMode:         relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -241,6 +349,8 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		UsingGroup:        common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
 		UserGroup:         common.GetContextKeyString(c, constant.ContextKeyUserGroup),
 		TokenUnlimited:    tokenUnlimited,
+		TokenPeriodStart:  c.GetInt64(string(constant.ContextKeyTokenPeriodStart)),
+		TokenTpmLimit:     common.GetContextKeyInt(c, constant.ContextKeyTokenTpmLimit),
 		StartTime:         startTime,
 		FirstResponseTime: startTime.Add(-time.Second),
 		OriginModelName:   common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
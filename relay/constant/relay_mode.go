@@ -53,6 +53,11 @@ const (
 	RelayModeRealtime
 
 	RelayModeGemini
+
+	RelayModeClaudeCountTokens
+	RelayModeGeminiCountTokens
+
+	RelayModeImagesVariations
 )
 
 func Path2RelayMode(path string) int {
@@ -71,6 +76,8 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeImagesGenerations
 	} else if strings.HasPrefix(path, "/v1/images/edits") {
 		relayMode = RelayModeImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = RelayModeImagesVariations
 	} else if strings.HasPrefix(path, "/v1/edits") {
 		relayMode = RelayModeEdits
 	} else if strings.HasPrefix(path, "/v1/responses") {
@@ -85,8 +92,14 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeRerank
 	} else if strings.HasPrefix(path, "/v1/realtime") {
 		relayMode = RelayModeRealtime
+	} else if strings.HasPrefix(path, "/v1/messages/count_tokens") {
+		relayMode = RelayModeClaudeCountTokens
 	} else if strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1/models") {
-		relayMode = RelayModeGemini
+		if strings.HasSuffix(path, ":countTokens") {
+			relayMode = RelayModeGeminiCountTokens
+		} else {
+			relayMode = RelayModeGemini
+		}
 	}
 	return relayMode
 }
@@ -165,3 +178,8 @@ func Path2RelayJimeng(method, path string) int {
 	}
 	return relayMode
 }
+
+// IsCountTokensMode count_tokens 仅用于预估，其结果不应影响渠道健康状态
+func IsCountTokensMode(relayMode int) bool {
+	return relayMode == RelayModeClaudeCountTokens || relayMode == RelayModeGeminiCountTokens
+}
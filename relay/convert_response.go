@@ -0,0 +1,34 @@
+package relay
+
+import (
+	"net/http"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// doConvertResponse 由渠道适配器处理响应，输出经 converter 转换为客户端请求的格式
+func doConvertResponse(c *gin.Context, adaptor channel.Adaptor, resp *http.Response, info *relaycommon.RelayInfo, converter helper.ResponseConverter) (any, *types.NewAPIError) {
+	writer := helper.NewConvertWriter(c, info.IsStream, converter)
+	c.Writer = writer
+	usage, newAPIError := adaptor.DoResponse(c, resp, info)
+	// 转换前的输出已被丢弃，不能再补发结束事件
+	failoverErr := helper.StreamFailoverError(c)
+	c.Writer = writer.ResponseWriter
+	if failoverErr != nil {
+		// 对冲落败时调用方仍需要本次尝试的用量
+		return usage, failoverErr
+	}
+	if newAPIError != nil {
+		return nil, newAPIError
+	}
+	openAIUsage, _ := usage.(*dto.Usage)
+	if err := writer.Finish(openAIUsage); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	return usage, nil
+}
@@ -0,0 +1,153 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/relay/channel"
+	"one-api/relay/channel/gemini"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting/model_setting"
+	"one-api/types"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// count_tokens 只用于预估，不预扣也不记录消费
+
+// ClaudeCountTokensHelper /v1/messages/count_tokens
+// Anthropic 渠道直接转发到上游，其它渠道或上游请求失败时使用本地估算
+func ClaudeCountTokensHelper(c *gin.Context) *types.NewAPIError {
+	relayInfo := relaycommon.GenRelayInfoClaude(c)
+
+	textRequest, err := getAndValidateClaudeRequest(c)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeInvalidRequest)
+	}
+	err = helper.ModelMappedHelper(c, relayInfo, textRequest)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError)
+	}
+
+	if relayInfo.ChannelType == constant.ChannelTypeAnthropic {
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed)
+		}
+		// 透传原始请求，仅替换为映射后的模型
+		var body map[string]any
+		if err := common.Unmarshal(requestBody, &body); err != nil {
+			return types.NewError(err, types.ErrorCodeInvalidRequest)
+		}
+		body["model"] = relayInfo.UpstreamModelName
+		url := fmt.Sprintf("%s/v1/messages/count_tokens", relayInfo.BaseUrl)
+		newAPIError := doCountTokensRequest(c, relayInfo, url, body)
+		if newAPIError == nil {
+			return nil
+		}
+		// 部分兼容 Anthropic 协议的渠道不支持 count_tokens，改用本地估算
+		common.LogWarn(c, "upstream count_tokens failed, fallback to local count: "+newAPIError.Error())
+	}
+
+	inputTokens, err := service.CountTokenClaudeRequest(*textRequest, relayInfo.UpstreamModelName)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeCountTokenFailed)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"input_tokens": inputTokens,
+	})
+	return nil
+}
+
+// GeminiCountTokensHelper /v1beta/models/{model}:countTokens
+// Gemini 渠道直接转发到上游，其它渠道或上游请求失败时使用本地估算
+func GeminiCountTokensHelper(c *gin.Context) *types.NewAPIError {
+	relayInfo := relaycommon.GenRelayInfoGemini(c)
+
+	var request gemini.GeminiCountTokensRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		return types.NewError(err, types.ErrorCodeInvalidRequest)
+	}
+	chatRequest := request.GenerateContentRequest
+	if chatRequest == nil {
+		chatRequest = &gemini.GeminiChatRequest{Contents: request.Contents}
+	}
+	err := helper.ModelMappedHelper(c, relayInfo, chatRequest)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError)
+	}
+
+	if relayInfo.ChannelType == constant.ChannelTypeGemini {
+		version := model_setting.GetGeminiVersionSetting(relayInfo.UpstreamModelName)
+		url := fmt.Sprintf("%s/%s/models/%s:countTokens", relayInfo.BaseUrl, version, relayInfo.UpstreamModelName)
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed)
+		}
+		var body map[string]any
+		if err := common.Unmarshal(requestBody, &body); err != nil {
+			return types.NewError(err, types.ErrorCodeInvalidRequest)
+		}
+		// generateContentRequest 中的 model 必须与上游模型一致
+		if generateContentRequest, ok := body["generateContentRequest"].(map[string]any); ok {
+			generateContentRequest["model"] = "models/" + relayInfo.UpstreamModelName
+		}
+		newAPIError := doCountTokensRequest(c, relayInfo, url, body)
+		if newAPIError == nil {
+			return nil
+		}
+		// 上游不支持 countTokens 时改用本地估算
+		common.LogWarn(c, "upstream countTokens failed, fallback to local count: "+newAPIError.Error())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"totalTokens": getGeminiInputTokens(chatRequest, relayInfo),
+	})
+	return nil
+}
+
+func doCountTokensRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo, url string, body any) *types.NewAPIError {
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return types.NewError(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), types.ErrorCodeInvalidApiType)
+	}
+	adaptor.Init(relayInfo)
+
+	jsonData, err := common.Marshal(body)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeDoRequestFailed)
+	}
+	if err := adaptor.SetupRequestHeader(c, &req.Header, relayInfo); err != nil {
+		return types.NewError(err, types.ErrorCodeDoRequestFailed)
+	}
+	resp, err := channel.DoRequest(c, req, relayInfo)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		newAPIError := service.RelayErrorHandler(resp, false)
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return newAPIError
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeReadResponseBodyFailed)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/json") {
+		contentType = "application/json"
+	}
+	c.Data(http.StatusOK, contentType, responseBody)
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"one-api/common"
+	"one-api/constant"
 	"one-api/dto"
 	"one-api/relay/channel/gemini"
 	relaycommon "one-api/relay/common"
@@ -178,6 +179,12 @@ func GeminiHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		return types.NewError(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), types.ErrorCodeInvalidApiType)
 	}
 
+	switch geminiConvertFormat(relayInfo) {
+	case relaycommon.RelayFormatOpenAI:
+		relayInfo.ConvertGeminiToOpenAI()
+	case relaycommon.RelayFormatClaude:
+		relayInfo.ConvertGeminiToClaude()
+	}
 	adaptor.Init(relayInfo)
 
 	// Clean up empty system instruction
@@ -194,7 +201,25 @@ func GeminiHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		}
 	}
 
-	requestBody, err := json.Marshal(req)
+	var convertedRequest any = req
+	switch relayInfo.RelayFormat {
+	case relaycommon.RelayFormatOpenAI:
+		var openAIRequest *dto.GeneralOpenAIRequest
+		openAIRequest, err = gemini.GeminiRequest2OpenAI(req, relayInfo)
+		if err == nil {
+			convertedRequest, err = adaptor.ConvertOpenAIRequest(c, relayInfo, openAIRequest)
+		}
+	case relaycommon.RelayFormatClaude:
+		var claudeRequest *dto.ClaudeRequest
+		claudeRequest, err = gemini.GeminiRequest2Claude(req, relayInfo)
+		if err == nil {
+			convertedRequest, err = adaptor.ConvertClaudeRequest(c, relayInfo, claudeRequest)
+		}
+	}
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed)
+	}
+	requestBody, err := json.Marshal(convertedRequest)
 	if err != nil {
 		return types.NewError(err, types.ErrorCodeConvertRequestFailed)
 	}
@@ -223,12 +248,90 @@ func GeminiHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		}
 	}
 
-	usage, openaiErr := adaptor.DoResponse(c, resp.(*http.Response), relayInfo)
+	var usage any
+	var openaiErr *types.NewAPIError
+	if relayInfo.GeminiConvertInfo != nil {
+		usage, openaiErr = doConvertResponse(c, adaptor, httpResp, relayInfo, geminiConverter(c, relayInfo))
+	} else {
+		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
+	}
+	recordHedgeLoserCost(c, relayInfo, usage, priceData)
+	if failoverErr := helper.StreamFailoverError(c); failoverErr != nil {
+		// 首个内容块前失败，本次尝试不计费，交由上层重试
+		openaiErr = failoverErr
+	}
 	if openaiErr != nil {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
 	}
 
-	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	if relayInfo.RelayFormat == relaycommon.RelayFormatClaude {
+		service.PostClaudeConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	} else {
+		postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	}
 	return nil
 }
+
+// geminiConvertFormat Gemini 与 Vertex 渠道原生支持，Claude 渠道转换为 Messages，其它渠道转换为 Chat Completions
+func geminiConvertFormat(info *relaycommon.RelayInfo) string {
+	switch info.ChannelType {
+	case constant.ChannelTypeGemini, constant.ChannelTypeVertexAi:
+		return ""
+	case constant.ChannelTypeAnthropic, constant.ChannelTypeAws:
+		return relaycommon.RelayFormatClaude
+	}
+	return relaycommon.RelayFormatOpenAI
+}
+
+// geminiConverter 将渠道输出的 OpenAI 或 Claude 格式响应转换为 Gemini 格式
+func geminiConverter(c *gin.Context, info *relaycommon.RelayInfo) helper.ResponseConverter {
+	formatChunk := func(geminiResponse *gemini.GeminiChatResponse) (string, error) {
+		if geminiResponse == nil {
+			return "", nil
+		}
+		data, err := common.Marshal(geminiResponse)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("data: %s\r\n\r\n", data), nil
+	}
+	return helper.ResponseConverter{
+		Stream: func(data string) (string, error) {
+			if info.RelayFormat == relaycommon.RelayFormatClaude {
+				var claudeResponse dto.ClaudeResponse
+				if err := common.UnmarshalJsonStr(data, &claudeResponse); err != nil {
+					common.LogError(c, "error unmarshalling claude stream response: "+err.Error())
+					return "", nil
+				}
+				return formatChunk(gemini.StreamResponseClaude2Gemini(&claudeResponse, info))
+			}
+			var streamResponse dto.ChatCompletionsStreamResponse
+			if err := common.UnmarshalJsonStr(data, &streamResponse); err != nil {
+				common.LogError(c, "error unmarshalling chat completions stream response: "+err.Error())
+				return "", nil
+			}
+			return formatChunk(gemini.StreamResponseOpenAI2Gemini(&streamResponse, info))
+		},
+		StreamEnd: func(usage *dto.Usage) (string, error) {
+			return formatChunk(gemini.FinishStreamResponse2Gemini(info, usage))
+		},
+		Response: func(body []byte, usage *dto.Usage) ([]byte, error) {
+			var geminiResponse *gemini.GeminiChatResponse
+			if info.RelayFormat == relaycommon.RelayFormatClaude {
+				var claudeResponse dto.ClaudeResponse
+				if err := common.Unmarshal(body, &claudeResponse); err != nil {
+					return nil, err
+				}
+				geminiResponse = gemini.ResponseClaude2Gemini(&claudeResponse, info, usage)
+			} else {
+				var openAIResponse dto.OpenAITextResponse
+				if err := common.Unmarshal(body, &openAIResponse); err != nil {
+					return nil, err
+				}
+				geminiResponse = gemini.ResponseOpenAI2Gemini(&openAIResponse, info, usage)
+			}
+			return common.Marshal(geminiResponse)
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"bytes"
+	"one-api/dto"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseConverter 渠道响应到客户端请求格式的转换函数
+type ResponseConverter struct {
+	// Stream 转换一条流式 data 内容，返回需写回客户端的 SSE 文本，为空时不输出
+	Stream func(data string) (string, error)
+	// StreamEnd 返回流结束时需补发的 SSE 文本
+	StreamEnd func(usage *dto.Usage) (string, error)
+	// Response 转换完整的非流式响应体
+	Response func(body []byte, usage *dto.Usage) ([]byte, error)
+}
+
+// ConvertWriter 拦截渠道输出的响应，经 ResponseConverter 转换后写回客户端
+type ConvertWriter struct {
+	gin.ResponseWriter
+	c         *gin.Context
+	isStream  bool
+	converter ResponseConverter
+	buffer    bytes.Buffer
+}
+
+func NewConvertWriter(c *gin.Context, isStream bool, converter ResponseConverter) *ConvertWriter {
+	return &ConvertWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		isStream:       isStream,
+		converter:      converter,
+	}
+}
+
+func (w *ConvertWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.isStream {
+		if err := w.processStreamLines(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *ConvertWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ConvertWriter) Flush() {
+	// 非流式响应在 Finish 中一次性写出，避免提前发送响应头
+	if w.isStream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *ConvertWriter) processStreamLines() error {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行留到下次写入
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, ":") {
+			// 保持连接的注释行原样转发
+			if err := w.writeEvent(line + "\n\n"); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		event, err := w.converter.Stream(data)
+		if err != nil {
+			return err
+		}
+		if err := w.writeEvent(event); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *ConvertWriter) writeEvent(event string) error {
+	if event == "" {
+		return nil
+	}
+	SetEventStreamHeaders(w.c)
+	if _, err := w.ResponseWriter.WriteString(event); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// Finish 处理剩余的流式内容并补发结束事件，非流式响应在此转换后一次性写出
+func (w *ConvertWriter) Finish(usage *dto.Usage) error {
+	if w.isStream {
+		if err := w.processStreamLines(); err != nil {
+			return err
+		}
+		event, err := w.converter.StreamEnd(usage)
+		if err != nil {
+			return err
+		}
+		return w.writeEvent(event)
+	}
+	data, err := w.converter.Response(w.buffer.Bytes(), usage)
+	if err != nil {
+		return err
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	_, err = w.ResponseWriter.Write(data)
+	return err
+}
@@ -0,0 +1,184 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImageVariationPrompt 上游不支持无提示词生成变体时使用的默认提示词
+const ImageVariationPrompt = "Generate a variation of this image, keeping the main subject, composition and style."
+
+// ImageFormFile images/edits、images/variations 表单中上传的图片
+type ImageFormFile struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+func (f *ImageFormFile) Base64() string {
+	return base64.StdEncoding.EncodeToString(f.Data)
+}
+
+func (f *ImageFormFile) DataUrl() string {
+	return fmt.Sprintf("data:%s;base64,%s", f.MimeType, f.Base64())
+}
+
+type ImageForm struct {
+	Images []*ImageFormFile
+	Mask   *ImageFormFile
+}
+
+// ParseImageForm 解析 multipart 表单中的图片，支持 image、image[] 与 image[N] 三种字段名
+func ParseImageForm(c *gin.Context) (*ImageForm, error) {
+	if c.Request.MultipartForm == nil {
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil { // 32MB max memory
+			return nil, errors.New("failed to parse multipart form")
+		}
+	}
+	if c.Request.MultipartForm == nil || c.Request.MultipartForm.File == nil {
+		return nil, errors.New("no multipart form data found")
+	}
+	files := c.Request.MultipartForm.File
+
+	imageFiles := files["image"]
+	if len(imageFiles) == 0 {
+		imageFiles = files["image[]"]
+	}
+	if len(imageFiles) == 0 {
+		// image[0]、image[1] ... 按下标排序
+		var fieldNames []string
+		for fieldName, headers := range files {
+			if strings.HasPrefix(fieldName, "image[") && len(headers) > 0 {
+				fieldNames = append(fieldNames, fieldName)
+			}
+		}
+		sort.Strings(fieldNames)
+		for _, fieldName := range fieldNames {
+			imageFiles = append(imageFiles, files[fieldName]...)
+		}
+	}
+	if len(imageFiles) == 0 {
+		return nil, errors.New("image is required")
+	}
+
+	form := &ImageForm{}
+	for i, fileHeader := range imageFiles {
+		file, err := readImageFormFile(fileHeader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image file %d: %w", i, err)
+		}
+		form.Images = append(form.Images, file)
+	}
+	if maskFiles := files["mask"]; len(maskFiles) > 0 {
+		mask, err := readImageFormFile(maskFiles[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mask file: %w", err)
+		}
+		form.Mask = mask
+	}
+	return form, nil
+}
+
+func readImageFormFile(fileHeader *multipart.FileHeader) (*ImageFormFile, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := DetectImageMimeType(fileHeader.Filename)
+	if ext := filepath.Ext(fileHeader.Filename); ext == "" {
+		// 没有扩展名时根据内容判断
+		if detected := http.DetectContentType(data); strings.HasPrefix(detected, "image/") {
+			mimeType = detected
+		}
+	}
+	return &ImageFormFile{
+		Filename: fileHeader.Filename,
+		MimeType: mimeType,
+		Data:     data,
+	}, nil
+}
+
+// DetectImageMimeType determines the MIME type based on the file extension
+func DetectImageMimeType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	default:
+		// Try to detect from extension if possible
+		if strings.HasPrefix(ext, ".jp") {
+			return "image/jpeg"
+		}
+		// Default to png as a fallback
+		return "image/png"
+	}
+}
+
+// ImageFormRequestBody 按 OpenAI 格式重新编码 multipart 表单，model 替换为映射后的模型
+func ImageFormRequestBody(c *gin.Context, model string, form *ImageForm) (io.Reader, error) {
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+
+	writer.WriteField("model", model)
+	for key, values := range c.Request.PostForm {
+		if key == "model" {
+			continue
+		}
+		for _, value := range values {
+			writer.WriteField(key, value)
+		}
+	}
+
+	// If multiple images, use image[] as the field name
+	fieldName := "image"
+	if len(form.Images) > 1 {
+		fieldName = "image[]"
+	}
+	for i, image := range form.Images {
+		if err := writeImageFormPart(writer, fieldName, image); err != nil {
+			return nil, fmt.Errorf("write form part failed for image %d: %w", i, err)
+		}
+	}
+	if form.Mask != nil {
+		if err := writeImageFormPart(writer, "mask", form.Mask); err != nil {
+			return nil, fmt.Errorf("write form part failed for mask: %w", err)
+		}
+	}
+
+	// 关闭 multipart 编写器以设置分界线
+	writer.Close()
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return bytes.NewReader(requestBody.Bytes()), nil
+}
+
+func writeImageFormPart(writer *multipart.Writer, fieldName string, file *ImageFormFile) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fieldName, file.Filename))
+	h.Set("Content-Type", file.MimeType)
+	part, err := writer.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(file.Data)
+	return err
+}
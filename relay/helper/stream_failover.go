@@ -0,0 +1,245 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"one-api/common"
+	"one-api/types"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const streamFailoverErrorKey = "stream_failover_error"
+
+// streamFailoverWriter 在首个内容块之前缓存输出，上游在此之前失败时丢弃缓存，客户端无感知地换渠道重试
+type streamFailoverWriter struct {
+	gin.ResponseWriter
+	mu        sync.Mutex
+	buffer    bytes.Buffer
+	status    int
+	committed bool
+	failed    bool
+	maxBuffer int
+}
+
+func newStreamFailoverWriter(writer gin.ResponseWriter, maxBuffer int) *streamFailoverWriter {
+	return &streamFailoverWriter{ResponseWriter: writer, maxBuffer: maxBuffer}
+}
+
+func (w *streamFailoverWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.failed {
+		// 已放弃本次尝试，丢弃后续输出
+		return len(data), nil
+	}
+	n, _ := w.buffer.Write(data)
+	if w.maxBuffer > 0 && w.buffer.Len() > w.maxBuffer {
+		return n, w.commitLocked()
+	}
+	return n, nil
+}
+
+func (w *streamFailoverWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *streamFailoverWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *streamFailoverWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *streamFailoverWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *streamFailoverWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.committed && w.ResponseWriter.Written()
+}
+
+// commit 将缓存的输出发送给客户端，此后不再重试
+func (w *streamFailoverWriter) commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.commitLocked()
+}
+
+func (w *streamFailoverWriter) commitLocked() error {
+	if w.committed || w.failed {
+		return nil
+	}
+	w.committed = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buffer.Len() > 0 {
+		_, err := w.ResponseWriter.Write(w.buffer.Bytes())
+		w.buffer.Reset()
+		if errors.Is(err, ErrStreamHedgeLost) {
+			// 对冲请求中其它尝试已先输出内容，丢弃本次尝试的后续输出
+			w.committed = false
+			w.failed = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// fail 放弃本次尝试，已发送给客户端时返回 false
+func (w *streamFailoverWriter) fail() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.committed {
+		return false
+	}
+	w.failed = true
+	w.buffer.Reset()
+	return true
+}
+
+func (w *streamFailoverWriter) isCommitted() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.committed
+}
+
+// StreamFailoverError 流式响应在发送首个内容块前失败或对冲落败时返回错误，同时丢弃本次尝试的输出；
+// 流式转发之后都需要调用，以恢复原始的 ResponseWriter
+func StreamFailoverError(c *gin.Context) *types.NewAPIError {
+	writer, ok := c.Writer.(*streamFailoverWriter)
+	if !ok {
+		return nil
+	}
+	c.Writer = writer.ResponseWriter
+	value, ok := c.Get(streamFailoverErrorKey)
+	if !ok {
+		if IsStreamHedgeLoser(c) {
+			return types.NewOpenAIError(ErrStreamHedgeLost, types.ErrorCodeBadResponse, http.StatusBadGateway)
+		}
+		return nil
+	}
+	delete(c.Keys, streamFailoverErrorKey)
+	// 事件流响应头由下一次尝试或错误响应重新设置
+	for _, header := range []string{"Content-Type", "Cache-Control", "Connection", "Transfer-Encoding", "X-Accel-Buffering"} {
+		c.Writer.Header().Del(header)
+	}
+	delete(c.Keys, "event_stream_headers_set")
+	err, _ := value.(error)
+	if err == nil {
+		err = errors.New("stream failed before first token")
+	}
+	return types.NewOpenAIError(err, types.ErrorCodeBadResponse, http.StatusBadGateway)
+}
+
+// 这些字段非空时认为上游已开始输出内容（或已正常结束）
+var streamContentKeys = map[string]bool{
+	"content":           true,
+	"text":              true,
+	"delta":             true,
+	"arguments":         true,
+	"partial_json":      true,
+	"thinking":          true,
+	"reasoning_content": true,
+	"reasoning":         true,
+	"refusal":           true,
+	"name":              true,
+	"answer":            true,
+	"result":            true,
+	"inlineData":        true,
+	"functionCall":      true,
+	"finish_reason":     true,
+	"finishReason":      true,
+	"stop_reason":       true,
+}
+
+// streamEventHasContent 判断上游事件是否包含内容，只检查字符串字段，
+// 避免 OpenAI 首个只有 role 的 delta 等空事件被当作内容
+func streamEventHasContent(data string) bool {
+	var event any
+	if err := common.UnmarshalJsonStr(data, &event); err != nil {
+		return false
+	}
+	return hasStreamContent(event)
+}
+
+func hasStreamContent(value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if streamContentKeys[key] {
+				switch c := child.(type) {
+				case string:
+					if c != "" {
+						return true
+					}
+				case map[string]any:
+					// Gemini 的 inlineData、functionCall
+					if (key == "inlineData" || key == "functionCall") && len(c) > 0 {
+						return true
+					}
+				}
+			}
+			if hasStreamContent(child) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if hasStreamContent(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamEventIsError 上游在流中返回的错误事件，包括 Claude 与 Responses API 的错误事件
+func streamEventIsError(data string) bool {
+	var event struct {
+		Type  string          `json:"type"`
+		Error json.RawMessage `json:"error"`
+	}
+	if err := common.UnmarshalJsonStr(data, &event); err != nil {
+		return false
+	}
+	if event.Type == "error" || event.Type == "response.failed" {
+		return true
+	}
+	return len(event.Error) > 0 && string(event.Error) != "null"
+}
+
+func truncateStreamEvent(data string, maxLen int) string {
+	if len(data) <= maxLen {
+		return data
+	}
+	return data[:maxLen] + "..."
+}
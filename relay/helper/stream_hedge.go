@@ -0,0 +1,209 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const streamHedgeKey = "stream_hedge"
+
+var ErrStreamHedgeLost = errors.New("another hedged attempt responded first")
+
+// StreamHedge 一次对冲请求中各尝试之间的竞速，先向客户端输出内容的尝试获胜
+type StreamHedge struct {
+	mu     sync.Mutex
+	winner *hedgeWriter
+	won    chan struct{}
+}
+
+func NewStreamHedge() *StreamHedge {
+	return &StreamHedge{won: make(chan struct{})}
+}
+
+// Attach 将一次尝试的输出接入竞速，获胜之前的响应头与状态码只保存在本地
+func (h *StreamHedge) Attach(c *gin.Context) {
+	writer := &hedgeWriter{
+		ResponseWriter: c.Writer,
+		hedge:          h,
+		header:         make(http.Header),
+	}
+	c.Writer = writer
+	c.Set(streamHedgeKey, writer)
+}
+
+// Won 有尝试获胜后关闭
+func (h *StreamHedge) Won() <-chan struct{} {
+	return h.won
+}
+
+func (h *StreamHedge) IsWinner(c *gin.Context) bool {
+	writer := getHedgeWriter(c)
+	if writer == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.winner == writer
+}
+
+func (h *StreamHedge) tryWin(writer *hedgeWriter) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.winner == nil {
+		h.winner = writer
+		close(h.won)
+	}
+	return h.winner == writer
+}
+
+func (h *StreamHedge) lost(writer *hedgeWriter) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.winner != nil && h.winner != writer
+}
+
+func getHedgeWriter(c *gin.Context) *hedgeWriter {
+	value, ok := c.Get(streamHedgeKey)
+	if !ok {
+		return nil
+	}
+	writer, _ := value.(*hedgeWriter)
+	return writer
+}
+
+// IsStreamHedged 当前尝试是对冲请求的一部分
+func IsStreamHedged(c *gin.Context) bool {
+	return getHedgeWriter(c) != nil
+}
+
+// IsStreamHedgeLoser 其它尝试已先输出内容，当前尝试不应计费
+func IsStreamHedgeLoser(c *gin.Context) bool {
+	writer := getHedgeWriter(c)
+	return writer != nil && writer.hedge.lost(writer)
+}
+
+// hedgeWriter 首次输出内容时参与竞速，获胜后直接写给客户端，落败后丢弃所有输出
+type hedgeWriter struct {
+	gin.ResponseWriter
+	hedge  *StreamHedge
+	mu     sync.Mutex
+	header http.Header
+	status int
+	won    bool
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.won {
+		// 获胜前的 SSE 保活注释不参与竞速，直接丢弃
+		if isStreamComment(data) {
+			return len(data), nil
+		}
+		if !w.winLocked() {
+			return 0, ErrStreamHedgeLost
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		return w.ResponseWriter.Status()
+	}
+	if w.status != 0 {
+		return w.status
+	}
+	return http.StatusOK
+}
+
+func (w *hedgeWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.won && w.ResponseWriter.Written()
+}
+
+func (w *hedgeWriter) winLocked() bool {
+	if !w.hedge.tryWin(w) {
+		return false
+	}
+	w.won = true
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	return true
+}
+
+// isStreamComment 数据只包含 SSE 注释行（如 ": PING"）
+func isStreamComment(data []byte) bool {
+	hasComment := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != ':' {
+			return false
+		}
+		hasComment = true
+	}
+	return hasComment
+}
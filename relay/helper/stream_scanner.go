@@ -3,6 +3,8 @@ package helper
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -71,6 +73,50 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		println("ping interval seconds:", int64(pingInterval.Seconds()))
 	}
 
+	// 首个内容块之前缓存输出，上游在此之前超时、报错或中断时放弃本次尝试，由上层换渠道重试
+	var (
+		failover       *streamFailoverWriter
+		failoverErr    error
+		failoverMutex  sync.Mutex
+		firstTokenWait <-chan time.Time
+	)
+	setFailoverErr := func(err error) {
+		if failover == nil || failover.isCommitted() {
+			return
+		}
+		failoverMutex.Lock()
+		defer failoverMutex.Unlock()
+		if failoverErr == nil {
+			failoverErr = err
+		}
+	}
+	failoverSetting := operation_setting.GetStreamFailoverSetting()
+	// 对冲请求依赖首个内容块之前的缓存来决定胜负
+	if failoverSetting.Enabled || IsStreamHedged(c) {
+		failover = newStreamFailoverWriter(c.Writer, failoverSetting.MaxBufferBytes)
+		c.Writer = failover
+		if failoverSetting.FirstTokenTimeoutSeconds > 0 {
+			firstTokenTimer := time.NewTimer(time.Duration(failoverSetting.FirstTokenTimeoutSeconds) * time.Second)
+			defer firstTokenTimer.Stop()
+			firstTokenWait = firstTokenTimer.C
+		}
+		// 在下面的清理逻辑等待所有 goroutine 退出之后执行
+		defer func() {
+			failoverMutex.Lock()
+			err := failoverErr
+			failoverMutex.Unlock()
+			if err != nil && failover.fail() {
+				common.LogError(c, "stream failed before first token: "+err.Error())
+				c.Set(streamFailoverErrorKey, err)
+				return
+			}
+			if err := failover.commit(); err != nil {
+				common.LogError(c, "write buffered stream failed: "+err.Error())
+			}
+			c.Writer = failover.ResponseWriter
+		}()
+	}
+
 	// 改进资源清理，确保所有 goroutine 正确退出
 	defer func() {
 		// 通知所有 goroutine 停止
@@ -183,6 +229,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			}
 		}()
 
+		streamDone := false
 		for scanner.Scan() {
 			// 检查是否需要停止
 			select {
@@ -210,20 +257,40 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			data = data[5:]
 			data = strings.TrimLeft(data, " ")
 			data = strings.TrimSuffix(data, "\r")
-			if !strings.HasPrefix(data, "[DONE]") {
+			if strings.HasPrefix(data, "[DONE]") {
+				streamDone = true
+			} else {
 				info.SetFirstResponseTime()
 
+				if failover != nil && !failover.isCommitted() {
+					if !json.Valid([]byte(data)) {
+						setFailoverErr(fmt.Errorf("malformed stream event: %s", truncateStreamEvent(data, 200)))
+						return
+					}
+					if streamEventIsError(data) {
+						setFailoverErr(fmt.Errorf("upstream error event: %s", truncateStreamEvent(data, 500)))
+						return
+					}
+				}
+
 				// 使用超时机制防止写操作阻塞
 				done := make(chan bool, 1)
 				go func() {
 					writeMutex.Lock()
 					defer writeMutex.Unlock()
-					done <- dataHandler(data)
+					success := dataHandler(data)
+					if success && failover != nil && !failover.isCommitted() && streamEventHasContent(data) {
+						if err := failover.commit(); err != nil {
+							common.LogError(c, "write buffered stream failed: "+err.Error())
+						}
+					}
+					done <- success
 				}()
 
 				select {
 				case success := <-done:
 					if !success {
+						setFailoverErr(errors.New("failed to handle stream event"))
 						return
 					}
 				case <-time.After(10 * time.Second):
@@ -241,19 +308,33 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			if err != io.EOF {
 				common.LogError(c, "scanner error: "+err.Error())
 			}
+			setFailoverErr(fmt.Errorf("upstream stream interrupted: %w", err))
+		} else if !streamDone {
+			setFailoverErr(errors.New("upstream stream ended without content"))
 		}
 	})
 
 	// 主循环等待完成或超时
-	select {
-	case <-ticker.C:
-		// 超时处理逻辑
-		common.LogError(c, "streaming timeout")
-	case <-stopChan:
-		// 正常结束
-		common.LogInfo(c, "streaming finished")
-	case <-c.Request.Context().Done():
-		// 客户端断开连接
-		common.LogInfo(c, "client disconnected")
+	for {
+		select {
+		case <-firstTokenWait:
+			if failover.isCommitted() {
+				firstTokenWait = nil
+				continue
+			}
+			common.LogError(c, "first token timeout")
+			setFailoverErr(errors.New("first token timeout"))
+		case <-ticker.C:
+			// 超时处理逻辑
+			common.LogError(c, "streaming timeout")
+			setFailoverErr(errors.New("streaming timeout"))
+		case <-stopChan:
+			// 正常结束
+			common.LogInfo(c, "streaming finished")
+		case <-c.Request.Context().Done():
+			// 客户端断开连接
+			common.LogInfo(c, "client disconnected")
+		}
+		return
 	}
 }
@@ -26,17 +26,30 @@ func getAndValidImageRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.
 	imageRequest := &dto.ImageRequest{}
 
 	switch info.RelayMode {
-	case relayconstant.RelayModeImagesEdits:
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		_, err := c.MultipartForm()
 		if err != nil {
 			return nil, err
 		}
+		// 提前校验上传的图片，避免请求到上游才报错
+		if _, err := helper.ParseImageForm(c); err != nil {
+			return nil, err
+		}
 		formData := c.Request.PostForm
 		imageRequest.Prompt = formData.Get("prompt")
 		imageRequest.Model = formData.Get("model")
 		imageRequest.N = common.String2Int(formData.Get("n"))
 		imageRequest.Quality = formData.Get("quality")
 		imageRequest.Size = formData.Get("size")
+		imageRequest.ResponseFormat = formData.Get("response_format")
+
+		if info.RelayMode == relayconstant.RelayModeImagesEdits {
+			if imageRequest.Prompt == "" {
+				return nil, errors.New("prompt is required")
+			}
+		} else if imageRequest.Model == "" {
+			imageRequest.Model = "dall-e-2"
+		}
 
 		if imageRequest.Model == "gpt-image-1" {
 			if imageRequest.Quality == "" {
@@ -174,7 +187,7 @@ func ImageHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeQueryDataError)
 		}
-		if userQuota-quota < 0 {
+		if userQuota+relayInfo.UserCreditLimit-quota < 0 {
 			return types.NewError(fmt.Errorf("image pre-consumed quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(quota)), types.ErrorCodeInsufficientUserQuota)
 		}
 	}
@@ -191,14 +204,17 @@ func ImageHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 	if err != nil {
 		return types.NewError(err, types.ErrorCodeConvertRequestFailed)
 	}
-	if relayInfo.RelayMode == relayconstant.RelayModeImagesEdits {
-		requestBody = convertedRequest.(io.Reader)
+	// edits、variations 可能由适配器重新编码为 multipart 表单，也可能转换为上游的 JSON 请求
+	if reader, ok := convertedRequest.(io.Reader); ok {
+		requestBody = reader
 	} else {
 		jsonData, err := json.Marshal(convertedRequest)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed)
 		}
 		requestBody = bytes.NewBuffer(jsonData)
+		// multipart 表单转换为 JSON 请求时同步修改 Content-Type
+		c.Request.Header.Set("Content-Type", "application/json")
 	}
 
 	if common.DebugEnabled {
@@ -197,12 +197,18 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 		}
 	}
 
-	if userQuota-priceData.Quota < 0 {
+	if userQuota+relayInfo.UserCreditLimit-priceData.Quota < 0 {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
 		}
 	}
+	if err := service.CheckTokenPeriodQuota(relayInfo, priceData.Quota); err != nil {
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: "token_period_quota_not_enough",
+		}
+	}
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	baseURL := c.GetString("base_url")
 	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
@@ -504,12 +510,20 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 		}
 	}
 
-	if consumeQuota && userQuota-priceData.Quota < 0 {
+	if consumeQuota && userQuota+relayInfo.UserCreditLimit-priceData.Quota < 0 {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
 		}
 	}
+	if consumeQuota {
+		if err := service.CheckTokenPeriodQuota(relayInfo, priceData.Quota); err != nil {
+			return &dto.MidjourneyResponse{
+				Code:        4,
+				Description: "token_period_quota_not_enough",
+			}
+		}
+	}
 
 	midjResponseWithStatus, responseBody, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
 	if err != nil {
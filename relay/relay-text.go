@@ -113,6 +113,12 @@ func TextHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError)
 	}
 
+	// 将引用的网关文件转换为当前渠道可用的形式
+	err = service.ResolveFileReferences(c, relayInfo, textRequest)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed)
+	}
+
 	// 获取 promptTokens，如果上下文中已经存在，则直接使用
 	var promptTokens int
 	if value, exists := c.Get("prompt_tokens"); exists {
@@ -138,7 +144,8 @@ func TextHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		return newApiErr
 	}
 	defer func() {
-		if newApiErr != nil {
+		// 检查返回值而不是 newApiErr，请求上游失败等提前返回的错误同样需要退还预扣的额度
+		if newAPIError != nil {
 			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
 		}
 	}()
@@ -227,6 +234,11 @@ func TextHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 	}
 
 	usage, newApiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	recordHedgeLoserCost(c, relayInfo, usage, priceData)
+	if failoverErr := helper.StreamFailoverError(c); failoverErr != nil {
+		// 首个内容块前失败，本次尝试不计费，交由上层重试
+		newApiErr = failoverErr
+	}
 	if newApiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
@@ -283,14 +295,17 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 	if err != nil {
 		return 0, 0, types.NewError(err, types.ErrorCodeQueryDataError)
 	}
-	if userQuota <= 0 {
+	// 授信用户的余额可以透支到 -UserCreditLimit
+	availableQuota := userQuota + relayInfo.UserCreditLimit
+	if availableQuota <= 0 {
 		return 0, 0, types.NewErrorWithStatusCode(errors.New("user quota is not enough"), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden)
 	}
-	if userQuota-preConsumedQuota < 0 {
+	if availableQuota-preConsumedQuota < 0 {
 		return 0, 0, types.NewErrorWithStatusCode(fmt.Errorf("pre-consume quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(preConsumedQuota)), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden)
 	}
 	relayInfo.UserQuota = userQuota
-	if userQuota > 100*preConsumedQuota {
+	// 启用周期预算的令牌每次都需要预扣费，以便原子地检查周期额度；启用额度预留账本时同样不信任
+	if availableQuota > 100*preConsumedQuota && relayInfo.TokenPeriodStart == 0 && !model.QuotaReservationEnabled() {
 		// 用户额度充足，判断令牌额度是否充足
 		if !relayInfo.TokenUnlimited {
 			// 非无限令牌，判断令牌额度是否充足
@@ -308,13 +323,23 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		}
 	}
 
-	if preConsumedQuota > 0 {
+	if newAPIError := service.ChargeTokenTpm(c, relayInfo); newAPIError != nil {
+		return 0, 0, newAPIError
+	}
+	if preConsumedQuota > 0 && model.QuotaReservationEnabled() {
+		if newAPIError := service.ReserveQuota(relayInfo, preConsumedQuota); newAPIError != nil {
+			service.ReconcileTokenTpm(relayInfo, 0)
+			return 0, 0, newAPIError
+		}
+	} else if preConsumedQuota > 0 {
 		err := service.PreConsumeTokenQuota(relayInfo, preConsumedQuota)
 		if err != nil {
+			service.ReconcileTokenTpm(relayInfo, 0)
 			return 0, 0, types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden)
 		}
 		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
 		if err != nil {
+			service.ReconcileTokenTpm(relayInfo, 0)
 			return 0, 0, types.NewError(err, types.ErrorCodeUpdateDataError)
 		}
 	}
@@ -322,6 +347,8 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 }
 
 func returnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, userQuota int, preConsumedQuota int) {
+	service.ReconcileTokenTpm(relayInfo, 0)
+	preConsumedQuota = service.SettleQuotaReservation(relayInfo, preConsumedQuota)
 	if preConsumedQuota != 0 {
 		gopool.Go(func() {
 			relayInfoCopy := *relayInfo
@@ -334,8 +361,63 @@ func returnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, us
 	}
 }
 
+// recordHedgeLoserCost 对冲请求中落败的尝试不向用户计费，按其用量与计费相同的方式估算上游成本计入渠道已用额度，用于成本分析
+func recordHedgeLoserCost(c *gin.Context, relayInfo *relaycommon.RelayInfo, usage any, priceData helper.PriceData) {
+	if !helper.IsStreamHedgeLoser(c) {
+		return
+	}
+	loserUsage, _ := usage.(*dto.Usage)
+	if loserUsage == nil {
+		loserUsage = &dto.Usage{PromptTokens: relayInfo.PromptTokens}
+	}
+	quota := int(calculateTokenQuota(loserUsage, priceData, false).Round(0).IntPart())
+	if quota <= 0 {
+		return
+	}
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+	common.LogInfo(c, fmt.Sprintf("hedged attempt on channel #%d lost, upstream cost %s recorded to channel", relayInfo.ChannelId, common.LogQuota(quota)))
+}
+
+// calculateTokenQuota 按 token 用量计算额度，不含按次计费的工具调用；separateAudio 为 true 时音频输入另行计费
+func calculateTokenQuota(usage *dto.Usage, priceData helper.PriceData, separateAudio bool) decimal.Decimal {
+	dGroupRatio := decimal.NewFromFloat(priceData.GroupRatioInfo.GroupRatio)
+	if priceData.UsePrice {
+		return decimal.NewFromFloat(priceData.ModelPrice).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).Mul(dGroupRatio)
+	}
+	dCacheTokens := decimal.NewFromInt(int64(usage.PromptTokensDetails.CachedTokens))
+	dImageTokens := decimal.NewFromInt(int64(usage.PromptTokensDetails.ImageTokens))
+	ratio := decimal.NewFromFloat(priceData.ModelRatio).Mul(dGroupRatio)
+
+	baseTokens := decimal.NewFromInt(int64(usage.PromptTokens))
+	// 减去 cached tokens
+	var cachedTokensWithRatio decimal.Decimal
+	if !dCacheTokens.IsZero() {
+		baseTokens = baseTokens.Sub(dCacheTokens)
+		cachedTokensWithRatio = dCacheTokens.Mul(decimal.NewFromFloat(priceData.CacheRatio))
+	}
+	// 减去 image tokens
+	var imageTokensWithRatio decimal.Decimal
+	if !dImageTokens.IsZero() {
+		baseTokens = baseTokens.Sub(dImageTokens)
+		imageTokensWithRatio = dImageTokens.Mul(decimal.NewFromFloat(priceData.ImageRatio))
+	}
+	// 减去单独计费的 audio tokens
+	if separateAudio {
+		baseTokens = baseTokens.Sub(decimal.NewFromInt(int64(usage.PromptTokensDetails.AudioTokens)))
+	}
+	promptQuota := baseTokens.Add(cachedTokensWithRatio).Add(imageTokensWithRatio)
+	completionQuota := decimal.NewFromInt(int64(usage.CompletionTokens)).Mul(decimal.NewFromFloat(priceData.CompletionRatio))
+
+	quota := promptQuota.Add(completionQuota).Mul(ratio)
+	if !ratio.IsZero() && quota.LessThanOrEqual(decimal.Zero) {
+		quota = decimal.NewFromInt(1)
+	}
+	return quota
+}
+
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
+	preConsumedQuota = service.SettleQuotaReservation(relayInfo, preConsumedQuota)
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -361,21 +443,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	modelPrice := priceData.ModelPrice
 
 	// Convert values to decimal for precise calculation
-	dPromptTokens := decimal.NewFromInt(int64(promptTokens))
-	dCacheTokens := decimal.NewFromInt(int64(cacheTokens))
-	dImageTokens := decimal.NewFromInt(int64(imageTokens))
 	dAudioTokens := decimal.NewFromInt(int64(audioTokens))
-	dCompletionTokens := decimal.NewFromInt(int64(completionTokens))
-	dCompletionRatio := decimal.NewFromFloat(completionRatio)
-	dCacheRatio := decimal.NewFromFloat(cacheRatio)
-	dImageRatio := decimal.NewFromFloat(imageRatio)
-	dModelRatio := decimal.NewFromFloat(modelRatio)
 	dGroupRatio := decimal.NewFromFloat(groupRatio)
-	dModelPrice := decimal.NewFromFloat(modelPrice)
 	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
 
-	ratio := dModelRatio.Mul(dGroupRatio)
-
 	// openai web search 工具计费
 	var dWebSearchQuota decimal.Decimal
 	var webSearchPrice float64
@@ -427,48 +498,17 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		}
 	}
 
-	var quotaCalculateDecimal decimal.Decimal
-
 	var audioInputQuota decimal.Decimal
 	var audioInputPrice float64
-	if !priceData.UsePrice {
-		baseTokens := dPromptTokens
-		// 减去 cached tokens
-		var cachedTokensWithRatio decimal.Decimal
-		if !dCacheTokens.IsZero() {
-			baseTokens = baseTokens.Sub(dCacheTokens)
-			cachedTokensWithRatio = dCacheTokens.Mul(dCacheRatio)
+	if !priceData.UsePrice && !dAudioTokens.IsZero() {
+		// Gemini audio tokens 单独计费
+		audioInputPrice = operation_setting.GetGeminiInputAudioPricePerMillionTokens(modelName)
+		if audioInputPrice > 0 {
+			audioInputQuota = decimal.NewFromFloat(audioInputPrice).Div(decimal.NewFromInt(1000000)).Mul(dAudioTokens).Mul(dGroupRatio).Mul(dQuotaPerUnit)
+			extraContent += fmt.Sprintf("Audio Input 花费 %s", audioInputQuota.String())
 		}
-
-		// 减去 image tokens
-		var imageTokensWithRatio decimal.Decimal
-		if !dImageTokens.IsZero() {
-			baseTokens = baseTokens.Sub(dImageTokens)
-			imageTokensWithRatio = dImageTokens.Mul(dImageRatio)
-		}
-
-		// 减去 Gemini audio tokens
-		if !dAudioTokens.IsZero() {
-			audioInputPrice = operation_setting.GetGeminiInputAudioPricePerMillionTokens(modelName)
-			if audioInputPrice > 0 {
-				// 重新计算 base tokens
-				baseTokens = baseTokens.Sub(dAudioTokens)
-				audioInputQuota = decimal.NewFromFloat(audioInputPrice).Div(decimal.NewFromInt(1000000)).Mul(dAudioTokens).Mul(dGroupRatio).Mul(dQuotaPerUnit)
-				extraContent += fmt.Sprintf("Audio Input 花费 %s", audioInputQuota.String())
-			}
-		}
-		promptQuota := baseTokens.Add(cachedTokensWithRatio).Add(imageTokensWithRatio)
-
-		completionQuota := dCompletionTokens.Mul(dCompletionRatio)
-
-		quotaCalculateDecimal = promptQuota.Add(completionQuota).Mul(ratio)
-
-		if !ratio.IsZero() && quotaCalculateDecimal.LessThanOrEqual(decimal.Zero) {
-			quotaCalculateDecimal = decimal.NewFromInt(1)
-		}
-	} else {
-		quotaCalculateDecimal = dModelPrice.Mul(dQuotaPerUnit).Mul(dGroupRatio)
 	}
+	quotaCalculateDecimal := calculateTokenQuota(usage, priceData, audioInputPrice > 0)
 	// 添加 responses tools call 调用的配额
 	quotaCalculateDecimal = quotaCalculateDecimal.Add(dWebSearchQuota)
 	quotaCalculateDecimal = quotaCalculateDecimal.Add(dFileSearchQuota)
@@ -477,6 +517,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 
 	quota := int(quotaCalculateDecimal.Round(0).IntPart())
 	totalTokens := promptTokens + completionTokens
+	service.ReconcileTokenTpm(relayInfo, totalTokens)
 
 	var logContent string
 	if !priceData.UsePrice {
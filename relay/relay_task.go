@@ -66,10 +66,14 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		return
 	}
 	quota := int(ratio * common.QuotaPerUnit)
-	if userQuota-quota < 0 {
+	if userQuota+relayInfo.UserCreditLimit-quota < 0 {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
+	if err := service.CheckTokenPeriodQuota(relayInfo.RelayInfo, quota); err != nil {
+		taskErr = service.TaskErrorWrapperLocal(err, "token_period_quota_not_enough", http.StatusForbidden)
+		return
+	}
 
 	if relayInfo.OriginTaskID != "" {
 		originTask, exist, err := model.GetByTaskId(relayInfo.UserId, relayInfo.OriginTaskID)
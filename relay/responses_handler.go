@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
+	"one-api/relay/channel/openai"
 	relaycommon "one-api/relay/common"
 	"one-api/relay/helper"
 	"one-api/service"
@@ -69,6 +70,17 @@ func ResponsesHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError)
 	}
 
+	convertToChat := shouldConvertResponsesToChat(relayInfo)
+	err = service.ExpandPreviousResponse(c, relayInfo, req, !convertToChat)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest)
+	}
+
+	err = service.ResolveResponsesFileReferences(c, relayInfo, req)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed)
+	}
+
 	if value, exists := c.Get("prompt_tokens"); exists {
 		promptTokens := value.(int)
 		relayInfo.SetPromptTokens(promptTokens)
@@ -95,16 +107,28 @@ func ResponsesHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), types.ErrorCodeInvalidApiType)
 	}
+	if convertToChat {
+		relayInfo.ConvertResponsesToChatCompletions(req)
+	}
 	adaptor.Init(relayInfo)
 	var requestBody io.Reader
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled {
+	if model_setting.GetGlobalSettings().PassThroughRequestEnabled && !convertToChat {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed)
 		}
 		requestBody = bytes.NewBuffer(body)
 	} else {
-		convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, relayInfo, *req)
+		var convertedRequest any
+		if convertToChat {
+			var chatRequest *dto.GeneralOpenAIRequest
+			chatRequest, err = service.ResponsesRequestToOpenAIRequest(req, relayInfo)
+			if err == nil {
+				convertedRequest, err = adaptor.ConvertOpenAIRequest(c, relayInfo, chatRequest)
+			}
+		} else {
+			convertedRequest, err = adaptor.ConvertOpenAIResponsesRequest(c, relayInfo, *req)
+		}
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed)
 		}
@@ -153,7 +177,17 @@ func ResponsesHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 		}
 	}
 
-	usage, newAPIError := adaptor.DoResponse(c, httpResp, relayInfo)
+	var usage any
+	if convertToChat {
+		usage, newAPIError = doConvertResponse(c, adaptor, httpResp, relayInfo, responsesChatConverter(c, relayInfo))
+	} else {
+		usage, newAPIError = adaptor.DoResponse(c, httpResp, relayInfo)
+	}
+	recordHedgeLoserCost(c, relayInfo, usage, priceData)
+	if failoverErr := helper.StreamFailoverError(c); failoverErr != nil {
+		// 首个内容块前失败，本次尝试不计费，交由上层重试
+		newAPIError = failoverErr
+	}
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -165,5 +199,66 @@ func ResponsesHelper(c *gin.Context) (newAPIError *types.NewAPIError) {
 	} else {
 		postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
 	}
+	service.SaveStoredResponse(c, relayInfo)
 	return nil
 }
+
+// shouldConvertResponsesToChat 使用 OpenAI 适配器的渠道（包括 Azure 与各类 OpenAI 兼容渠道）原样转发 Responses 请求，
+// 渠道设置开启转换时改走 Chat Completions；其它适配器不支持 Responses API，始终转换
+func shouldConvertResponsesToChat(info *relaycommon.RelayInfo) bool {
+	if info.ChannelSetting.ResponsesToChatCompletions {
+		return true
+	}
+	_, ok := GetAdaptor(info.ApiType).(*openai.Adaptor)
+	return !ok
+}
+
+// responsesChatConverter 将渠道输出的 Chat Completions 响应转换为 Responses 格式
+func responsesChatConverter(c *gin.Context, info *relaycommon.RelayInfo) helper.ResponseConverter {
+	formatEvents := func(events []dto.ResponsesStreamResponse) (string, error) {
+		var sb strings.Builder
+		for _, event := range events {
+			data, err := common.Marshal(event)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, data))
+		}
+		return sb.String(), nil
+	}
+	return helper.ResponseConverter{
+		Stream: func(data string) (string, error) {
+			var streamResponse dto.ChatCompletionsStreamResponse
+			if err := common.UnmarshalJsonStr(data, &streamResponse); err != nil {
+				common.LogError(c, "error unmarshalling chat completions stream response: "+err.Error())
+				return "", nil
+			}
+			return formatEvents(service.StreamResponseOpenAI2Responses(&streamResponse, info))
+		},
+		StreamEnd: func(usage *dto.Usage) (string, error) {
+			events := service.FinishStreamResponseOpenAI2Responses(info, usage)
+			if info.ResponsesStoreInfo != nil {
+				for _, event := range events {
+					if event.Response != nil {
+						info.ResponsesStoreInfo.Response, _ = common.Marshal(event.Response)
+					}
+				}
+			}
+			return formatEvents(events)
+		},
+		Response: func(body []byte, usage *dto.Usage) ([]byte, error) {
+			var openAIResponse dto.OpenAITextResponse
+			if err := common.Unmarshal(body, &openAIResponse); err != nil {
+				return nil, err
+			}
+			data, err := common.Marshal(service.ResponseOpenAI2Responses(&openAIResponse, info, usage))
+			if err != nil {
+				return nil, err
+			}
+			if info.ResponsesStoreInfo != nil {
+				info.ResponsesStoreInfo.Response = data
+			}
+			return data, nil
+		},
+	}
+}
@@ -0,0 +1,561 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const batchOutputFilePurpose = "batch_output"
+
+// 每处理多少条请求同步一次进度，并检查是否被其它节点取消
+const batchProgressInterval = 20
+
+const (
+	// 执行节点更新心跳的间隔
+	batchHeartbeatInterval = 30 * time.Second
+	// 心跳超过该时长未更新的批处理视为执行节点已停止，由主节点接管
+	batchStaleTimeout = 2 * time.Minute
+)
+
+// SupportedBatchEndpoints 批处理支持的接口
+var SupportedBatchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+	"/v1/moderations":      true,
+}
+
+var (
+	batchHandler   http.Handler
+	runningBatches sync.Map // batch id -> context.CancelFunc
+)
+
+// SetBatchHandler 批处理中的每条请求都交给该 handler（即网关自身的路由）执行，
+// 从而复用鉴权、渠道选择、重试与计费流程
+func SetBatchHandler(handler http.Handler) {
+	batchHandler = handler
+}
+
+// CancelRunningBatch 取消本节点上正在执行的批处理，返回 false 表示该批处理不在本节点运行
+func CancelRunningBatch(batchId string) bool {
+	cancel, ok := runningBatches.Load(batchId)
+	if !ok {
+		return false
+	}
+	cancel.(context.CancelFunc)()
+	return true
+}
+
+func StartBatch(batch *model.Batch, inputFile *model.File) {
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				common.SysError(fmt.Sprintf("batch %s panic: %v", batch.Id, r))
+				failBatch(batch, "internal_error", fmt.Sprintf("%v", r), 0)
+			}
+		}()
+		runBatch(batch, inputFile)
+	})
+}
+
+// ResumeStaleBatches 定期接管心跳已停止（执行节点重启或崩溃）的批处理，跳过已完成的请求继续执行，
+// 已超过完成窗口的批处理直接以已完成的结果结束
+func ResumeStaleBatches() {
+	for {
+		staleBefore := common.GetTimestamp() - int64(batchStaleTimeout.Seconds())
+		batches, err := model.GetStaleBatches(staleBefore, 100)
+		if err != nil {
+			common.SysError("failed to list stale batches: " + err.Error())
+		}
+		for _, batch := range batches {
+			ok, err := batch.Claim()
+			if err != nil || !ok {
+				continue
+			}
+			inputFile, err := model.GetUserFileById(batch.InputFileId, batch.UserId)
+			if err != nil {
+				failBatch(batch, "invalid_input_file", fmt.Sprintf("input file %s is not available", batch.InputFileId), 0)
+				continue
+			}
+			common.SysLog(fmt.Sprintf("resuming batch %s (%s)", batch.Id, batch.Status))
+			StartBatch(batch, inputFile)
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// startBatchHeartbeat 在批处理执行期间定期更新心跳，返回的函数用于停止
+func startBatchHeartbeat(batch *model.Batch) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(batchHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := batch.Touch(); err != nil {
+					common.SysError(fmt.Sprintf("failed to update heartbeat of batch %s: %s", batch.Id, err.Error()))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+	}
+}
+
+func runBatch(batch *model.Batch, inputFile *model.File) {
+	if batchHandler == nil {
+		failBatch(batch, "internal_error", "batch handler is not initialized", 0)
+		return
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(batch.ExpiresAt, 0))
+	runningBatches.Store(batch.Id, cancel)
+	stopHeartbeat := startBatchHeartbeat(batch)
+	defer func() {
+		stopHeartbeat()
+		runningBatches.Delete(batch.Id)
+		cancel()
+	}()
+
+	if batch.Status == model.BatchStatusValidating || batch.Status == model.BatchStatusInProgress {
+		if !executeBatch(ctx, cancel, batch, inputFile) {
+			return
+		}
+	}
+	finalizeBatch(ctx, batch)
+}
+
+// executeBatch 执行尚未完成的请求，每条结果立即持久化；返回 false 表示批处理已失败
+func executeBatch(ctx context.Context, cancel context.CancelFunc, batch *model.Batch, inputFile *model.File) bool {
+	lines, lineNumber, err := parseBatchInput(inputFile, batch.Endpoint)
+	if err != nil {
+		failBatch(batch, "invalid_request", err.Error(), lineNumber)
+		return false
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(batch, "invalid_token", "the token used to create the batch is no longer available", 0)
+		return false
+	}
+
+	if batch.Status == model.BatchStatusValidating {
+		now := common.GetTimestamp()
+		ok, err := batch.UpdateStatusFrom(model.BatchStatusValidating, map[string]interface{}{
+			"status":         model.BatchStatusInProgress,
+			"in_progress_at": now,
+			"total_count":    len(lines),
+		})
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+			return false
+		}
+		if !ok {
+			// 校验期间已被取消
+			return true
+		}
+		batch.Status = model.BatchStatusInProgress
+		batch.InProgressAt = now
+	}
+	batch.TotalCount = len(lines)
+
+	done, err := model.GetBatchResultCustomIds(batch.Id)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load results of batch %s: %s", batch.Id, err.Error()))
+		return false
+	}
+	batch.CompletedCount, batch.FailedCount, err = model.CountBatchResults(batch.Id)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to count results of batch %s: %s", batch.Id, err.Error()))
+		return false
+	}
+
+	concurrency := operation_setting.GetBatchSetting().Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		processed int
+	)
+	semaphore := make(chan struct{}, concurrency)
+	for _, line := range lines {
+		if ctx.Err() != nil {
+			break
+		}
+		if done[line.CustomId] {
+			continue
+		}
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(line dto.OpenAIBatchInputLine) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			output, success := executeBatchLine(ctx, batch.Id, token.Key, line)
+			if ctx.Err() != nil && !success {
+				// 被取消或过期而中断的请求不记录结果，恢复执行时会重新发起
+				return
+			}
+			data, _ := common.Marshal(output)
+			writeErr := model.InsertBatchResult(&model.BatchResult{
+				BatchId:  batch.Id,
+				CustomId: line.CustomId,
+				Success:  success,
+				Result:   string(data),
+			})
+			if writeErr != nil {
+				common.SysError(fmt.Sprintf("failed to save result of batch %s: %s", batch.Id, writeErr.Error()))
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if success {
+				batch.CompletedCount++
+			} else {
+				batch.FailedCount++
+			}
+			processed++
+			if processed%batchProgressInterval == 0 {
+				if err := batch.UpdateRequestCounts(); err != nil {
+					common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+				}
+				if status, err := model.GetBatchStatus(batch.Id); err == nil && status == model.BatchStatusCancelling {
+					cancel()
+				}
+			}
+		}(line)
+	}
+	wg.Wait()
+	return true
+}
+
+// finalizeBatch 根据当前状态确定最终状态，将已持久化的结果写入输出文件；
+// 即使被取消或过期，已完成的结果也会写入输出文件
+func finalizeBatch(ctx context.Context, batch *model.Batch) {
+	status, err := model.GetBatchStatus(batch.Id)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to query batch %s: %s", batch.Id, err.Error()))
+		return
+	}
+	finalStatus := model.BatchStatusCompleted
+	if status == model.BatchStatusCancelling {
+		finalStatus = model.BatchStatusCancelled
+	} else if status != model.BatchStatusFinalizing && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		finalStatus = model.BatchStatusExpired
+	}
+	if finalStatus == model.BatchStatusCompleted && status != model.BatchStatusFinalizing {
+		ok, _ := batch.UpdateStatusFrom(status, map[string]interface{}{
+			"status":        model.BatchStatusFinalizing,
+			"finalizing_at": common.GetTimestamp(),
+		})
+		if ok {
+			status = model.BatchStatusFinalizing
+		} else {
+			finalStatus = model.BatchStatusCancelled
+			status = model.BatchStatusCancelling
+		}
+	}
+
+	completed, failed, err := model.CountBatchResults(batch.Id)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to count results of batch %s: %s", batch.Id, err.Error()))
+		return
+	}
+	batch.CompletedCount, batch.FailedCount = completed, failed
+	updates := map[string]interface{}{
+		"completed_count": completed,
+		"failed_count":    failed,
+	}
+	if err = writeBatchOutputFiles(batch, updates); err != nil {
+		// 保留结果与当前状态，由主节点稍后接管重试
+		common.SysError(fmt.Sprintf("failed to write output of batch %s: %s", batch.Id, err.Error()))
+		return
+	}
+
+	now := common.GetTimestamp()
+	updates["status"] = finalStatus
+	switch finalStatus {
+	case model.BatchStatusCompleted:
+		updates["completed_at"] = now
+	case model.BatchStatusExpired:
+		updates["expired_at"] = now
+	case model.BatchStatusCancelled:
+		updates["cancelled_at"] = now
+	}
+	if _, err := batch.UpdateStatusFrom(status, updates); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+		return
+	}
+	if err := model.DeleteBatchResults(batch.Id); err != nil {
+		common.SysError(fmt.Sprintf("failed to delete results of batch %s: %s", batch.Id, err.Error()))
+	}
+	common.SysLog(fmt.Sprintf("batch %s %s, completed: %d, failed: %d", batch.Id, finalStatus, completed, failed))
+}
+
+// writeBatchOutputFiles 将持久化的结果按成功与失败分别写入输出文件与错误文件，并把文件 id 写入 updates
+func writeBatchOutputFiles(batch *model.Batch, updates map[string]interface{}) error {
+	output, err := newBatchResultWriter()
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	errorOutput, err := newBatchResultWriter()
+	if err != nil {
+		return err
+	}
+	defer errorOutput.Close()
+
+	err = model.IterateBatchResults(batch.Id, func(result *model.BatchResult) error {
+		if result.Success {
+			return output.WriteRaw(result.Result)
+		}
+		return errorOutput.WriteRaw(result.Result)
+	})
+	if err != nil {
+		return err
+	}
+	if output.Count() > 0 {
+		file, err := output.SaveAsFile(batch, "batch_"+batch.Id+"_output.jsonl")
+		if err != nil {
+			return err
+		}
+		updates["output_file_id"] = file.Id
+	}
+	if errorOutput.Count() > 0 {
+		file, err := errorOutput.SaveAsFile(batch, "batch_"+batch.Id+"_error.jsonl")
+		if err != nil {
+			return err
+		}
+		updates["error_file_id"] = file.Id
+	}
+	return nil
+}
+
+// parseBatchInput 读取并校验输入文件，出错时返回出错的行号（从 1 开始）
+func parseBatchInput(inputFile *model.File, endpoint string) ([]dto.OpenAIBatchInputLine, int, error) {
+	reader, err := GetFileStorage().Open(inputFile.StoragePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("input file %s is not available", inputFile.Id)
+	}
+	defer reader.Close()
+
+	maxRequests := operation_setting.GetBatchSetting().MaxRequestsPerBatch
+	lines := make([]dto.OpenAIBatchInputLine, 0)
+	customIds := make(map[string]bool)
+	bufReader := bufio.NewReader(reader)
+	lineNumber := 0
+	for {
+		data, readErr := bufReader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, lineNumber, readErr
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) > 0 {
+			lineNumber++
+			var line dto.OpenAIBatchInputLine
+			if err := common.Unmarshal(data, &line); err != nil {
+				return nil, lineNumber, fmt.Errorf("line %d is not valid JSON", lineNumber)
+			}
+			if line.CustomId == "" {
+				return nil, lineNumber, fmt.Errorf("line %d is missing custom_id", lineNumber)
+			}
+			if customIds[line.CustomId] {
+				return nil, lineNumber, fmt.Errorf("duplicate custom_id %s on line %d", line.CustomId, lineNumber)
+			}
+			customIds[line.CustomId] = true
+			if !strings.EqualFold(line.Method, http.MethodPost) {
+				return nil, lineNumber, fmt.Errorf("line %d: only POST is supported", lineNumber)
+			}
+			if line.Url != endpoint {
+				return nil, lineNumber, fmt.Errorf("line %d: url %s does not match batch endpoint %s", lineNumber, line.Url, endpoint)
+			}
+			if len(line.Body) == 0 {
+				return nil, lineNumber, fmt.Errorf("line %d is missing body", lineNumber)
+			}
+			var body struct {
+				Stream bool `json:"stream"`
+			}
+			if err := common.Unmarshal(line.Body, &body); err != nil {
+				return nil, lineNumber, fmt.Errorf("line %d: body must be a JSON object", lineNumber)
+			}
+			if body.Stream {
+				return nil, lineNumber, fmt.Errorf("line %d: streaming is not supported in batches", lineNumber)
+			}
+			lines = append(lines, line)
+			if maxRequests > 0 && len(lines) > maxRequests {
+				return nil, lineNumber, fmt.Errorf("batch exceeds the maximum of %d requests", maxRequests)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return nil, 0, errors.New("input file is empty")
+	}
+	return lines, 0, nil
+}
+
+func executeBatchLine(ctx context.Context, batchId string, tokenKey string, line dto.OpenAIBatchInputLine) (dto.OpenAIBatchOutputLine, bool) {
+	result := dto.OpenAIBatchOutputLine{
+		Id:       "batch_req_" + common.GetRandomString(24),
+		CustomId: line.CustomId,
+	}
+	requestCtx := context.WithValue(ctx, constant.ContextKeyBatchId, batchId)
+	req, err := http.NewRequestWithContext(requestCtx, http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	if err != nil {
+		result.Error = &dto.OpenAIBatchError{Code: "invalid_request", Message: err.Error()}
+		return result, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+	req.RemoteAddr = "127.0.0.1:0"
+
+	recorder := httptest.NewRecorder()
+	batchHandler.ServeHTTP(recorder, req)
+
+	body := bytes.TrimSpace(recorder.Body.Bytes())
+	if !json.Valid(body) {
+		body, _ = common.Marshal(string(body))
+	}
+	result.Response = &dto.OpenAIBatchOutputResponse{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       body,
+	}
+	return result, recorder.Code == http.StatusOK
+}
+
+func failBatch(batch *model.Batch, code string, message string, line int) {
+	batchErrors := dto.OpenAIBatchErrors{
+		Object: "list",
+		Data: []dto.OpenAIBatchError{{
+			Code:    code,
+			Message: message,
+			Line:    line,
+		}},
+	}
+	errorsJson, _ := common.Marshal(batchErrors)
+	err := model.DB.Model(&model.Batch{}).Where("id = ?", batch.Id).Updates(map[string]interface{}{
+		"status":    model.BatchStatusFailed,
+		"failed_at": common.GetTimestamp(),
+		"errors":    string(errorsJson),
+	}).Error
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+		return
+	}
+	if err = model.DeleteBatchResults(batch.Id); err != nil {
+		common.SysError(fmt.Sprintf("failed to delete results of batch %s: %s", batch.Id, err.Error()))
+	}
+}
+
+// batchResultWriter 将结果逐行写入临时文件，结束后再保存到文件存储，避免大批量结果占用内存
+type batchResultWriter struct {
+	tmp   *os.File
+	count int
+}
+
+func newBatchResultWriter() (*batchResultWriter, error) {
+	tmp, err := os.CreateTemp("", "batch-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	return &batchResultWriter{tmp: tmp}, nil
+}
+
+// WriteRaw 写入一行已序列化的结果
+func (w *batchResultWriter) WriteRaw(line string) error {
+	if _, err := w.tmp.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *batchResultWriter) Count() int {
+	return w.count
+}
+
+func (w *batchResultWriter) SaveAsFile(batch *model.Batch, filename string) (*model.File, error) {
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return SaveGeneratedFile(batch.UserId, batch.TokenId, filename, batchOutputFilePurpose, w.tmp)
+}
+
+func (w *batchResultWriter) Close() {
+	_ = w.tmp.Close()
+	_ = os.Remove(w.tmp.Name())
+}
+
+// LoadBatchInput 读取批处理的输入文件
+func LoadBatchInput(batch *model.Batch) ([]dto.OpenAIBatchInputLine, error) {
+	inputFile, err := model.GetUserFileById(batch.InputFileId, batch.UserId)
+	if err != nil {
+		return nil, err
+	}
+	lines, _, err := parseBatchInput(inputFile, batch.Endpoint)
+	return lines, err
+}
+
+// ReadBatchResults 逐行读取批处理输出 / 错误文件，fileId 为空时直接返回
+func ReadBatchResults(userId int, fileId string, handle func(line dto.OpenAIBatchOutputLine) error) error {
+	if fileId == "" {
+		return nil
+	}
+	file, err := model.GetUserFileById(fileId, userId)
+	if err != nil {
+		return err
+	}
+	reader, err := GetFileStorage().Open(file.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	bufReader := bufio.NewReader(reader)
+	for {
+		data, readErr := bufReader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) > 0 {
+			var line dto.OpenAIBatchOutputLine
+			if err := common.Unmarshal(data, &line); err != nil {
+				return err
+			}
+			if err := handle(line); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"one-api/types"
 	"strings"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 func formatNotifyType(channelId int, status int) string {
@@ -89,6 +91,55 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	return search
 }
 
+// ShouldTripChannelBreaker 上游故障、限流与鉴权失败计入熔断统计，客户端请求错误不计入
+func ShouldTripChannelBreaker(err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	if types.IsChannelError(err) || err.GetErrorCode() == types.ErrorCodeDoRequestFailed {
+		return true
+	}
+	if types.IsLocalError(err) {
+		return false
+	}
+	switch err.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return err.StatusCode/100 == 5
+}
+
+// RecordChannelBreakerResult 记录本次请求所用渠道及密钥的结果，不计入熔断的错误不做记录
+func RecordChannelBreakerResult(c *gin.Context, channelId int, err *types.NewAPIError) {
+	if err != nil && !ShouldTripChannelBreaker(err) {
+		return
+	}
+	keyIndex := -1
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	model.RecordChannelBreakerResult(channelId, keyIndex, err == nil)
+}
+
+// RecordChannelCooldown 上游限流时按响应头给出的重置时间暂停选择该渠道，多密钥渠道只暂停所用密钥
+func RecordChannelCooldown(c *gin.Context, channelId int, err *types.NewAPIError) {
+	if err == nil {
+		return
+	}
+	retryAfter := err.RetryAfter
+	if retryAfter <= 0 {
+		if err.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+		retryAfter = time.Duration(operation_setting.GetChannelCooldownSetting().DefaultSeconds) * time.Second
+	}
+	keyIndex := -1
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	model.SetChannelCooldown(channelId, keyIndex, retryAfter)
+}
+
 func ShouldEnableChannel(newAPIError *types.NewAPIError, status int) bool {
 	if !common.AutomaticEnableChannelEnabled {
 		return false
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"one-api/model"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/types"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// firstWriteRecorder 记录首次向客户端写出响应体的时间，作为首字延迟
+type firstWriteRecorder struct {
+	gin.ResponseWriter
+	firstWrite time.Time
+}
+
+func (w *firstWriteRecorder) Write(data []byte) (int, error) {
+	if w.firstWrite.IsZero() {
+		w.firstWrite = time.Now()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *firstWriteRecorder) WriteString(s string) (int, error) {
+	if w.firstWrite.IsZero() {
+		w.firstWrite = time.Now()
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// TrackChannelRequest 使用指定渠道转发请求，并用实际流量更新渠道选择策略与熔断所需的统计
+func TrackChannelRequest(c *gin.Context, channelId int, relay func() *types.NewAPIError) *types.NewAPIError {
+	writer := c.Writer
+	recorder := &firstWriteRecorder{ResponseWriter: writer}
+	c.Writer = recorder
+	startTime := time.Now()
+	model.AcquireChannelRequest(channelId)
+
+	newAPIError := relay()
+
+	model.ReleaseChannelRequest(channelId)
+	c.Writer = writer
+	if helper.IsStreamHedgeLoser(c) {
+		// 对冲落败被取消的尝试不计入渠道统计
+		return newAPIError
+	}
+	if relayconstant.IsCountTokensMode(relayconstant.Path2RelayMode(c.Request.URL.Path)) {
+		// count_tokens 不计入渠道统计、熔断与冷却
+		return newAPIError
+	}
+	if newAPIError == nil {
+		var firstToken time.Duration
+		if !recorder.firstWrite.IsZero() {
+			firstToken = recorder.firstWrite.Sub(startTime)
+		}
+		latency := time.Since(startTime)
+		if c.IsWebsocket() {
+			// 实时会话的时长不代表渠道延迟，只统计成功率
+			latency = 0
+		}
+		model.RecordChannelSuccess(channelId, latency, firstToken)
+		model.RecordChannelAffinity(c, channelId)
+	} else if ShouldTripChannelBreaker(newAPIError) {
+		model.RecordChannelFailure(channelId)
+	}
+	RecordChannelBreakerResult(c, channelId, newAPIError)
+	RecordChannelCooldown(c, channelId, newAPIError)
+	return newAPIError
+}
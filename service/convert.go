@@ -438,3 +438,970 @@ func toJSONString(v interface{}) string {
 	}
 	return string(b)
 }
+
+// ResponsesRequestToOpenAIRequest 将 /v1/responses 请求转换为 Chat Completions 请求
+func ResponsesRequestToOpenAIRequest(responsesRequest *dto.OpenAIResponsesRequest, info *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
+	openAIRequest := dto.GeneralOpenAIRequest{
+		Model:     responsesRequest.Model,
+		MaxTokens: responsesRequest.MaxOutputTokens,
+		TopP:      responsesRequest.TopP,
+		Stream:    responsesRequest.Stream,
+		User:      responsesRequest.User,
+	}
+	if responsesRequest.Temperature != 0 {
+		openAIRequest.Temperature = common.GetPointer[float64](responsesRequest.Temperature)
+	}
+	if responsesRequest.Reasoning != nil {
+		openAIRequest.ReasoningEffort = responsesRequest.Reasoning.Effort
+	}
+	if responsesRequest.Stream && info.SupportStreamOptions {
+		openAIRequest.StreamOptions = &dto.StreamOptions{
+			IncludeUsage: true,
+		}
+	}
+
+	messages := make([]dto.Message, 0)
+	if instructions := responsesInstructions(responsesRequest.Instructions); instructions != "" {
+		systemMessage := dto.Message{
+			Role: "system",
+		}
+		systemMessage.SetStringContent(instructions)
+		messages = append(messages, systemMessage)
+	}
+	inputMessages, err := responsesInputToMessages(responsesRequest.Input)
+	if err != nil {
+		return nil, err
+	}
+	openAIRequest.Messages = append(messages, inputMessages...)
+
+	// 仅支持 function 工具，web_search 等内置工具无法在其它渠道上执行
+	for _, tool := range responsesRequest.Tools {
+		if common.Interface2String(tool["type"]) != "function" {
+			continue
+		}
+		openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        common.Interface2String(tool["name"]),
+				Description: common.Interface2String(tool["description"]),
+				Parameters:  tool["parameters"],
+			},
+		})
+	}
+	if len(openAIRequest.Tools) > 0 {
+		openAIRequest.ToolChoice = responsesToolChoice(responsesRequest.ToolChoice)
+		if responsesRequest.ParallelToolCalls {
+			openAIRequest.ParallelTooCalls = common.GetPointer[bool](true)
+		}
+	}
+
+	if len(responsesRequest.Text) > 0 {
+		var text struct {
+			Format *struct {
+				Type        string `json:"type"`
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Schema      any    `json:"schema"`
+				Strict      any    `json:"strict"`
+			} `json:"format"`
+		}
+		if err := common.Unmarshal(responsesRequest.Text, &text); err == nil && text.Format != nil {
+			switch text.Format.Type {
+			case "json_object":
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+			case "json_schema":
+				openAIRequest.ResponseFormat = &dto.ResponseFormat{
+					Type: "json_schema",
+					JsonSchema: &dto.FormatJsonSchema{
+						Description: text.Format.Description,
+						Name:        text.Format.Name,
+						Schema:      text.Format.Schema,
+						Strict:      text.Format.Strict,
+					},
+				}
+			}
+		}
+	}
+	return &openAIRequest, nil
+}
+
+func responsesInstructions(instructions json.RawMessage) string {
+	if len(instructions) == 0 {
+		return ""
+	}
+	var str string
+	if err := common.Unmarshal(instructions, &str); err == nil {
+		return str
+	}
+	return ""
+}
+
+func responsesToolChoice(toolChoice json.RawMessage) any {
+	if len(toolChoice) == 0 {
+		return nil
+	}
+	var str string
+	if err := common.Unmarshal(toolChoice, &str); err == nil {
+		return str
+	}
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := common.Unmarshal(toolChoice, &choice); err == nil && choice.Type == "function" {
+		return map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": choice.Name,
+			},
+		}
+	}
+	return nil
+}
+
+func responsesInputToMessages(input json.RawMessage) ([]dto.Message, error) {
+	messages := make([]dto.Message, 0)
+	var str string
+	if err := common.Unmarshal(input, &str); err == nil {
+		message := dto.Message{
+			Role: "user",
+		}
+		message.SetStringContent(str)
+		return append(messages, message), nil
+	}
+	var items []dto.ResponsesInputItem
+	if err := common.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+
+	// reasoning 项附加到紧随其后的 assistant 消息
+	var reasoning strings.Builder
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			message := dto.Message{
+				Role: role,
+			}
+			if err := setResponsesMessageContent(&message, item.Content); err != nil {
+				return nil, err
+			}
+			if role == "assistant" && reasoning.Len() > 0 {
+				message.ReasoningContent = reasoning.String()
+				reasoning.Reset()
+			}
+			messages = append(messages, message)
+		case "function_call":
+			toolCall := dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// 连续的函数调用合并到同一条 assistant 消息
+			if len(messages) > 0 && messages[len(messages)-1].Role == "assistant" {
+				last := &messages[len(messages)-1]
+				last.SetToolCalls(append(last.ParseToolCalls(), toolCall))
+				continue
+			}
+			message := dto.Message{
+				Role: "assistant",
+			}
+			message.SetNullContent()
+			message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+			if reasoning.Len() > 0 {
+				message.ReasoningContent = reasoning.String()
+				reasoning.Reset()
+			}
+			messages = append(messages, message)
+		case "function_call_output":
+			message := dto.Message{
+				Role:       "tool",
+				ToolCallId: item.CallId,
+			}
+			if err := setResponsesMessageContent(&message, item.Output); err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		case "reasoning":
+			for _, summary := range item.Summary {
+				reasoning.WriteString(summary.Text)
+			}
+		default:
+			// item_reference 以及内置工具的调用记录无法转换，忽略
+		}
+	}
+	return messages, nil
+}
+
+func setResponsesMessageContent(message *dto.Message, content json.RawMessage) error {
+	if len(content) == 0 {
+		message.SetStringContent("")
+		return nil
+	}
+	var str string
+	if err := common.Unmarshal(content, &str); err == nil {
+		message.SetStringContent(str)
+		return nil
+	}
+	var parts []dto.ResponsesInputContent
+	if err := common.Unmarshal(content, &parts); err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	mediaContents := make([]dto.MediaContent, 0, len(parts))
+	onlyText := true
+	var text strings.Builder
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			text.WriteString(part.Text)
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: part.Text,
+			})
+		case "input_image":
+			onlyText = false
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{
+					Url:    part.ImageUrl,
+					Detail: part.Detail,
+				},
+			})
+		case "input_file":
+			onlyText = false
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{
+					FileName: part.Filename,
+					FileData: part.FileData,
+					FileId:   part.FileId,
+				},
+			})
+		case "input_audio":
+			onlyText = false
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type:       dto.ContentTypeInputAudio,
+				InputAudio: part.InputAudio,
+			})
+		}
+	}
+	if onlyText {
+		message.SetStringContent(text.String())
+	} else {
+		message.SetMediaContent(mediaContents)
+	}
+	return nil
+}
+
+func newResponsesResponse(info *relaycommon.RelayInfo, status string) *dto.OpenAIResponsesResponse {
+	convertInfo := info.ResponsesConvertInfo
+	request := convertInfo.Request
+	response := &dto.OpenAIResponsesResponse{
+		ID:                 convertInfo.ResponseId,
+		Object:             "response",
+		CreatedAt:          convertInfo.CreatedAt,
+		Status:             status,
+		Instructions:       responsesInstructions(request.Instructions),
+		MaxOutputTokens:    int(request.MaxOutputTokens),
+		Model:              convertInfo.Model,
+		Output:             make([]dto.ResponsesOutput, 0),
+		ParallelToolCalls:  request.ParallelToolCalls,
+		PreviousResponseID: request.PreviousResponseID,
+		Reasoning:          request.Reasoning,
+		Store:              request.ShouldStore(),
+		Temperature:        request.Temperature,
+		ToolChoice:         "auto",
+		Tools:              request.Tools,
+		TopP:               request.TopP,
+		Truncation:         request.Truncation,
+		Metadata:           request.Metadata,
+	}
+	if toolChoice, ok := responsesToolChoice(request.ToolChoice).(string); ok {
+		response.ToolChoice = toolChoice
+	}
+	if response.Tools == nil {
+		response.Tools = make([]map[string]any, 0)
+	}
+	if request.User != "" {
+		response.User, _ = common.Marshal(request.User)
+	}
+	return response
+}
+
+func usageOpenAI2Responses(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return nil
+	}
+	return &dto.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		InputTokensDetails: &dto.InputTokenDetails{
+			CachedTokens: usage.PromptTokensDetails.CachedTokens,
+		},
+		OutputTokensDetails: &dto.OutputTokenDetails{
+			ReasoningTokens: usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+func finishResponsesResponse(response *dto.OpenAIResponsesResponse, finishReason string) {
+	switch finishReason {
+	case "length", "max_tokens":
+		response.Status = "incomplete"
+		response.IncompleteDetails = &dto.IncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		response.Status = "incomplete"
+		response.IncompleteDetails = &dto.IncompleteDetails{Reason: "content_filter"}
+	default:
+		response.Status = "completed"
+	}
+}
+
+// ResponseOpenAI2Responses 将 Chat Completions 非流式响应转换为 Responses 响应
+func ResponseOpenAI2Responses(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo, usage *dto.Usage) *dto.OpenAIResponsesResponse {
+	response := newResponsesResponse(info, "completed")
+	var finishReason string
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
+		finishReason = choice.FinishReason
+		reasoningContent := choice.Message.ReasoningContent
+		if reasoningContent == "" {
+			reasoningContent = choice.Message.Reasoning
+		}
+		if reasoningContent != "" {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:    "reasoning",
+				ID:      "rs_" + common.GetUUID(),
+				Status:  "completed",
+				Content: make([]dto.ResponsesOutputContent, 0),
+				Summary: []dto.ResponsesOutputContent{{Type: "summary_text", Text: reasoningContent}},
+			})
+		}
+		if content := choice.Message.StringContent(); content != "" {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:   "message",
+				ID:     "msg_" + common.GetUUID(),
+				Status: "completed",
+				Role:   "assistant",
+				Content: []dto.ResponsesOutputContent{{
+					Type:        "output_text",
+					Text:        content,
+					Annotations: make([]interface{}, 0),
+				}},
+			})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:      "function_call",
+				ID:        "fc_" + common.GetUUID(),
+				Status:    "completed",
+				CallId:    toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			})
+		}
+	}
+	finishResponsesResponse(response, finishReason)
+	if usage == nil {
+		usage = &openAIResponse.Usage
+	}
+	response.Usage = usageOpenAI2Responses(usage)
+	return response
+}
+
+func nextResponsesStreamEvent(info *relaycommon.RelayInfo, event dto.ResponsesStreamResponse) dto.ResponsesStreamResponse {
+	event.SequenceNumber = info.ResponsesConvertInfo.SequenceNumber
+	info.ResponsesConvertInfo.SequenceNumber++
+	return event
+}
+
+// closeResponsesCurrentItem 结束当前的 reasoning 或 message 输出项
+func closeResponsesCurrentItem(info *relaycommon.RelayInfo) []dto.ResponsesStreamResponse {
+	convertInfo := info.ResponsesConvertInfo
+	item := convertInfo.CurrentItem
+	if item == nil {
+		return nil
+	}
+	outputIndex := common.GetPointer[int](len(convertInfo.Output))
+	text := convertInfo.CurrentText.String()
+	var events []dto.ResponsesStreamResponse
+	if item.Type == "reasoning" {
+		part := dto.ResponsesOutputContent{Type: "summary_text", Text: text}
+		events = append(events,
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesStreamTypeReasoningTextDone,
+				ItemId:       item.ID,
+				OutputIndex:  outputIndex,
+				SummaryIndex: common.GetPointer[int](0),
+				Text:         text,
+			}),
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesStreamTypeReasoningPartDone,
+				ItemId:       item.ID,
+				OutputIndex:  outputIndex,
+				SummaryIndex: common.GetPointer[int](0),
+				Part:         &part,
+			}),
+		)
+		item.Summary = []dto.ResponsesOutputContent{part}
+	} else {
+		part := dto.ResponsesOutputContent{Type: "output_text", Text: text, Annotations: make([]interface{}, 0)}
+		events = append(events,
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesStreamTypeOutputTextDone,
+				ItemId:       item.ID,
+				OutputIndex:  outputIndex,
+				ContentIndex: common.GetPointer[int](0),
+				Text:         text,
+			}),
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesStreamTypeContentPartDone,
+				ItemId:       item.ID,
+				OutputIndex:  outputIndex,
+				ContentIndex: common.GetPointer[int](0),
+				Part:         &part,
+			}),
+		)
+		item.Content = []dto.ResponsesOutputContent{part}
+	}
+	item.Status = "completed"
+	events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemDone,
+		OutputIndex: outputIndex,
+		Item:        item,
+	}))
+	convertInfo.Output = append(convertInfo.Output, *item)
+	convertInfo.CurrentItem = nil
+	convertInfo.CurrentText.Reset()
+	return events
+}
+
+// closeResponsesToolCalls 结束所有正在输出的函数调用
+func closeResponsesToolCalls(info *relaycommon.RelayInfo) []dto.ResponsesStreamResponse {
+	convertInfo := info.ResponsesConvertInfo
+	var events []dto.ResponsesStreamResponse
+	for _, index := range convertInfo.ToolCallOrder {
+		item := convertInfo.ToolCallItems[index]
+		outputIndex := common.GetPointer[int](len(convertInfo.Output))
+		item.Status = "completed"
+		events = append(events,
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:        dto.ResponsesStreamTypeFunctionArgumentDone,
+				ItemId:      item.ID,
+				OutputIndex: outputIndex,
+				Arguments:   item.Arguments,
+			}),
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:        dto.ResponsesOutputTypeItemDone,
+				OutputIndex: outputIndex,
+				Item:        item,
+			}),
+		)
+		convertInfo.Output = append(convertInfo.Output, *item)
+	}
+	convertInfo.ToolCallItems = make(map[int]*dto.ResponsesOutput)
+	convertInfo.ToolCallOrder = nil
+	return events
+}
+
+// openResponsesCurrentItem 开始新的 reasoning 或 message 输出项，itemType 相同时沿用当前项
+func openResponsesCurrentItem(info *relaycommon.RelayInfo, itemType string) []dto.ResponsesStreamResponse {
+	convertInfo := info.ResponsesConvertInfo
+	if convertInfo.CurrentItem != nil && convertInfo.CurrentItem.Type == itemType {
+		return nil
+	}
+	events := closeResponsesCurrentItem(info)
+	events = append(events, closeResponsesToolCalls(info)...)
+
+	outputIndex := common.GetPointer[int](len(convertInfo.Output))
+	item := &dto.ResponsesOutput{
+		Type:    itemType,
+		Status:  "in_progress",
+		Content: make([]dto.ResponsesOutputContent, 0),
+	}
+	if itemType == "reasoning" {
+		item.ID = "rs_" + common.GetUUID()
+	} else {
+		item.ID = "msg_" + common.GetUUID()
+		item.Role = "assistant"
+	}
+	added := *item
+	events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+		Type:        dto.ResponsesOutputTypeItemAdded,
+		OutputIndex: outputIndex,
+		Item:        &added,
+	}))
+	if itemType == "reasoning" {
+		events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+			Type:         dto.ResponsesStreamTypeReasoningPartAdded,
+			ItemId:       item.ID,
+			OutputIndex:  outputIndex,
+			SummaryIndex: common.GetPointer[int](0),
+			Part:         &dto.ResponsesOutputContent{Type: "summary_text"},
+		}))
+	} else {
+		events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+			Type:         dto.ResponsesStreamTypeContentPartAdded,
+			ItemId:       item.ID,
+			OutputIndex:  outputIndex,
+			ContentIndex: common.GetPointer[int](0),
+			Part:         &dto.ResponsesOutputContent{Type: "output_text", Annotations: make([]interface{}, 0)},
+		}))
+	}
+	convertInfo.CurrentItem = item
+	return events
+}
+
+// StreamResponseOpenAI2Responses 将 Chat Completions 流式块转换为 Responses 流式事件
+func StreamResponseOpenAI2Responses(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []dto.ResponsesStreamResponse {
+	convertInfo := info.ResponsesConvertInfo
+	var events []dto.ResponsesStreamResponse
+	if !convertInfo.Started {
+		convertInfo.Started = true
+		events = append(events,
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:     dto.ResponsesStreamTypeCreated,
+				Response: newResponsesResponse(info, "in_progress"),
+			}),
+			nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:     dto.ResponsesStreamTypeInProgress,
+				Response: newResponsesResponse(info, "in_progress"),
+			}),
+		)
+	}
+	if len(openAIResponse.Choices) == 0 {
+		return events
+	}
+	choice := openAIResponse.Choices[0]
+	if reasoningContent := choice.Delta.GetReasoningContent(); reasoningContent != "" {
+		events = append(events, openResponsesCurrentItem(info, "reasoning")...)
+		convertInfo.CurrentText.WriteString(reasoningContent)
+		events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+			Type:         dto.ResponsesStreamTypeReasoningTextDelta,
+			ItemId:       convertInfo.CurrentItem.ID,
+			OutputIndex:  common.GetPointer[int](len(convertInfo.Output)),
+			SummaryIndex: common.GetPointer[int](0),
+			Delta:        reasoningContent,
+		}))
+	}
+	if content := choice.Delta.GetContentString(); content != "" {
+		events = append(events, openResponsesCurrentItem(info, "message")...)
+		convertInfo.CurrentText.WriteString(content)
+		events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+			Type:         dto.ResponsesStreamTypeOutputTextDelta,
+			ItemId:       convertInfo.CurrentItem.ID,
+			OutputIndex:  common.GetPointer[int](len(convertInfo.Output)),
+			ContentIndex: common.GetPointer[int](0),
+			Delta:        content,
+		}))
+	}
+	for i, toolCall := range choice.Delta.ToolCalls {
+		index := i
+		if toolCall.Index != nil {
+			index = *toolCall.Index
+		}
+		item, ok := convertInfo.ToolCallItems[index]
+		if !ok {
+			events = append(events, closeResponsesCurrentItem(info)...)
+			item = &dto.ResponsesOutput{
+				Type:   "function_call",
+				ID:     "fc_" + common.GetUUID(),
+				Status: "in_progress",
+				CallId: toolCall.ID,
+				Name:   toolCall.Function.Name,
+			}
+			convertInfo.ToolCallItems[index] = item
+			convertInfo.ToolCallOrder = append(convertInfo.ToolCallOrder, index)
+			added := *item
+			events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:        dto.ResponsesOutputTypeItemAdded,
+				OutputIndex: common.GetPointer[int](len(convertInfo.Output) + len(convertInfo.ToolCallOrder) - 1),
+				Item:        &added,
+			}))
+		}
+		if toolCall.Function.Arguments != "" {
+			item.Arguments += toolCall.Function.Arguments
+			outputIndex := len(convertInfo.Output)
+			for position, order := range convertInfo.ToolCallOrder {
+				if order == index {
+					outputIndex += position
+				}
+			}
+			events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+				Type:        dto.ResponsesStreamTypeFunctionArgumentDelta,
+				ItemId:      item.ID,
+				OutputIndex: common.GetPointer[int](outputIndex),
+				Delta:       toolCall.Function.Arguments,
+			}))
+		}
+	}
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		convertInfo.FinishReason = *choice.FinishReason
+	}
+	return events
+}
+
+// FinishStreamResponseOpenAI2Responses 上游流结束后，结束所有输出项并生成 response.completed
+func FinishStreamResponseOpenAI2Responses(info *relaycommon.RelayInfo, usage *dto.Usage) []dto.ResponsesStreamResponse {
+	convertInfo := info.ResponsesConvertInfo
+	var events []dto.ResponsesStreamResponse
+	if !convertInfo.Started {
+		events = StreamResponseOpenAI2Responses(&dto.ChatCompletionsStreamResponse{}, info)
+	}
+	events = append(events, closeResponsesCurrentItem(info)...)
+	events = append(events, closeResponsesToolCalls(info)...)
+
+	response := newResponsesResponse(info, "completed")
+	response.Output = convertInfo.Output
+	finishResponsesResponse(response, convertInfo.FinishReason)
+	response.Usage = usageOpenAI2Responses(usage)
+	eventType := dto.ResponsesStreamTypeCompleted
+	if response.Status == "incomplete" {
+		eventType = dto.ResponsesStreamTypeIncomplete
+	}
+	events = append(events, nextResponsesStreamEvent(info, dto.ResponsesStreamResponse{
+		Type:     eventType,
+		Response: response,
+	}))
+	return events
+}
+
+// OpenAIRequestToResponsesRequest 将 Chat Completions 请求转换为 /v1/responses 请求，用于仅支持 Responses API 的模型
+func OpenAIRequestToResponsesRequest(openAIRequest *dto.GeneralOpenAIRequest) (*dto.OpenAIResponsesRequest, error) {
+	responsesRequest := &dto.OpenAIResponsesRequest{
+		Model:           openAIRequest.Model,
+		MaxOutputTokens: openAIRequest.MaxCompletionTokens,
+		Stream:          openAIRequest.Stream,
+		TopP:            openAIRequest.TopP,
+		User:            openAIRequest.User,
+	}
+	if responsesRequest.MaxOutputTokens == 0 {
+		responsesRequest.MaxOutputTokens = openAIRequest.MaxTokens
+	}
+	if openAIRequest.Temperature != nil {
+		responsesRequest.Temperature = *openAIRequest.Temperature
+	}
+	if openAIRequest.ParallelTooCalls != nil {
+		responsesRequest.ParallelToolCalls = *openAIRequest.ParallelTooCalls
+	}
+	if openAIRequest.ReasoningEffort != "" {
+		responsesRequest.Reasoning = &dto.Reasoning{
+			Effort:  openAIRequest.ReasoningEffort,
+			Summary: "auto",
+		}
+	}
+
+	items := make([]dto.ResponsesInputItem, 0, len(openAIRequest.Messages))
+	for _, message := range openAIRequest.Messages {
+		switch message.Role {
+		case "tool":
+			output, err := common.Marshal(message.StringContent())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, dto.ResponsesInputItem{
+				Type:   "function_call_output",
+				CallId: message.ToolCallId,
+				Output: output,
+			})
+			continue
+		}
+		content, err := messageToResponsesContent(&message)
+		if err != nil {
+			return nil, err
+		}
+		if content != nil {
+			items = append(items, dto.ResponsesInputItem{
+				Type:    "message",
+				Role:    message.Role,
+				Content: content,
+			})
+		}
+		for _, toolCall := range message.ParseToolCalls() {
+			items = append(items, dto.ResponsesInputItem{
+				Type:      "function_call",
+				CallId:    toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			})
+		}
+	}
+	input, err := common.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	responsesRequest.Input = input
+
+	for _, tool := range openAIRequest.Tools {
+		if tool.Type != "function" {
+			continue
+		}
+		responsesTool := map[string]any{
+			"type": "function",
+			"name": tool.Function.Name,
+		}
+		if tool.Function.Description != "" {
+			responsesTool["description"] = tool.Function.Description
+		}
+		if tool.Function.Parameters != nil {
+			responsesTool["parameters"] = tool.Function.Parameters
+		}
+		responsesRequest.Tools = append(responsesRequest.Tools, responsesTool)
+	}
+	if openAIRequest.ToolChoice != nil {
+		toolChoice := openAIRequest.ToolChoice
+		if choice, ok := toolChoice.(map[string]any); ok && common.Interface2String(choice["type"]) == "function" {
+			if function, ok := choice["function"].(map[string]any); ok {
+				toolChoice = map[string]any{
+					"type": "function",
+					"name": common.Interface2String(function["name"]),
+				}
+			}
+		}
+		if responsesRequest.ToolChoice, err = common.Marshal(toolChoice); err != nil {
+			return nil, err
+		}
+	}
+
+	if openAIRequest.ResponseFormat != nil && openAIRequest.ResponseFormat.Type != "" && openAIRequest.ResponseFormat.Type != "text" {
+		format := map[string]any{
+			"type": openAIRequest.ResponseFormat.Type,
+		}
+		if jsonSchema := openAIRequest.ResponseFormat.JsonSchema; jsonSchema != nil {
+			format["name"] = jsonSchema.Name
+			format["schema"] = jsonSchema.Schema
+			if jsonSchema.Description != "" {
+				format["description"] = jsonSchema.Description
+			}
+			if jsonSchema.Strict != nil {
+				format["strict"] = jsonSchema.Strict
+			}
+		}
+		if responsesRequest.Text, err = common.Marshal(map[string]any{"format": format}); err != nil {
+			return nil, err
+		}
+	}
+	return responsesRequest, nil
+}
+
+// messageToResponsesContent 返回 nil 表示消息没有内容（例如仅包含函数调用的 assistant 消息）
+func messageToResponsesContent(message *dto.Message) (json.RawMessage, error) {
+	if message.Content == nil {
+		return nil, nil
+	}
+	if message.IsStringContent() {
+		if message.StringContent() == "" && message.Role == "assistant" {
+			return nil, nil
+		}
+		return common.Marshal(message.StringContent())
+	}
+	textType := "input_text"
+	if message.Role == "assistant" {
+		textType = "output_text"
+	}
+	parts := make([]dto.ResponsesInputContent, 0)
+	for _, content := range message.ParseContent() {
+		switch content.Type {
+		case dto.ContentTypeText:
+			parts = append(parts, dto.ResponsesInputContent{
+				Type: textType,
+				Text: content.Text,
+			})
+		case dto.ContentTypeImageURL:
+			image := content.GetImageMedia()
+			if image == nil {
+				continue
+			}
+			parts = append(parts, dto.ResponsesInputContent{
+				Type:     "input_image",
+				ImageUrl: image.Url,
+				Detail:   image.Detail,
+			})
+		case dto.ContentTypeFile:
+			file := content.GetFile()
+			if file == nil {
+				continue
+			}
+			parts = append(parts, dto.ResponsesInputContent{
+				Type:     "input_file",
+				FileId:   file.FileId,
+				FileData: file.FileData,
+				Filename: file.FileName,
+			})
+		case dto.ContentTypeInputAudio:
+			parts = append(parts, dto.ResponsesInputContent{
+				Type:       "input_audio",
+				InputAudio: content.GetInputAudio(),
+			})
+		}
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	return common.Marshal(parts)
+}
+
+// UsageResponses2OpenAI 将 Responses 用量转换为 Chat Completions 用量
+func UsageResponses2OpenAI(usage *dto.Usage) *dto.Usage {
+	openAIUsage := &dto.Usage{}
+	if usage == nil {
+		return openAIUsage
+	}
+	openAIUsage.PromptTokens = usage.InputTokens
+	openAIUsage.CompletionTokens = usage.OutputTokens
+	openAIUsage.TotalTokens = usage.TotalTokens
+	if openAIUsage.TotalTokens == 0 {
+		openAIUsage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	if usage.InputTokensDetails != nil {
+		openAIUsage.PromptTokensDetails.CachedTokens = usage.InputTokensDetails.CachedTokens
+	}
+	if usage.OutputTokensDetails != nil {
+		openAIUsage.CompletionTokenDetails.ReasoningTokens = usage.OutputTokensDetails.ReasoningTokens
+	}
+	return openAIUsage
+}
+
+func finishReasonResponses2OpenAI(response *dto.OpenAIResponsesResponse, hasToolCalls bool) string {
+	if response.IncompleteDetails != nil {
+		switch response.IncompleteDetails.Reason {
+		case "max_output_tokens":
+			return "length"
+		case "content_filter":
+			return "content_filter"
+		}
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// ResponseResponses2OpenAI 将 Responses 非流式响应转换为 Chat Completions 响应
+func ResponseResponses2OpenAI(responsesResponse *dto.OpenAIResponsesResponse, info *relaycommon.RelayInfo) *dto.OpenAITextResponse {
+	var content, reasoningContent strings.Builder
+	toolCalls := make([]dto.ToolCallRequest, 0)
+	for _, output := range responsesResponse.Output {
+		switch output.Type {
+		case "message":
+			for _, part := range output.Content {
+				if part.Type == "output_text" {
+					content.WriteString(part.Text)
+				}
+			}
+		case "reasoning":
+			for _, summary := range output.Summary {
+				reasoningContent.WriteString(summary.Text)
+			}
+		case "function_call":
+			toolCalls = append(toolCalls, dto.ToolCallRequest{
+				ID:   output.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      output.Name,
+					Arguments: output.Arguments,
+				},
+			})
+		}
+	}
+	message := dto.Message{
+		Role:             "assistant",
+		ReasoningContent: reasoningContent.String(),
+	}
+	message.SetStringContent(content.String())
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+	model := responsesResponse.Model
+	if model == "" {
+		model = info.UpstreamModelName
+	}
+	return &dto.OpenAITextResponse{
+		Id:      responsesResponse.ID,
+		Model:   model,
+		Object:  "chat.completion",
+		Created: responsesResponse.CreatedAt,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: finishReasonResponses2OpenAI(responsesResponse, len(toolCalls) > 0),
+		}},
+		Usage: *UsageResponses2OpenAI(responsesResponse.Usage),
+	}
+}
+
+// StreamResponseResponses2OpenAI 将 Responses 流式事件转换为 Chat Completions 流式块，返回 nil 表示该事件无需下发
+func StreamResponseResponses2OpenAI(streamResponse *dto.ResponsesStreamResponse, info *relaycommon.RelayInfo) *dto.ChatCompletionsStreamResponse {
+	convertInfo := info.ChatCompletionsConvertInfo
+	if streamResponse.Response != nil {
+		if streamResponse.Response.ID != "" {
+			convertInfo.ResponseId = streamResponse.Response.ID
+		}
+		if streamResponse.Response.Model != "" {
+			convertInfo.Model = streamResponse.Response.Model
+		}
+	}
+	chunk := &dto.ChatCompletionsStreamResponse{
+		Id:      convertInfo.ResponseId,
+		Object:  "chat.completion.chunk",
+		Created: convertInfo.Created,
+		Model:   convertInfo.Model,
+	}
+	choice := dto.ChatCompletionsStreamResponseChoice{
+		Index: 0,
+	}
+	switch streamResponse.Type {
+	case dto.ResponsesStreamTypeCreated:
+		choice.Delta.Role = "assistant"
+		choice.Delta.SetContentString("")
+	case dto.ResponsesStreamTypeOutputTextDelta:
+		choice.Delta.SetContentString(streamResponse.Delta)
+	case dto.ResponsesStreamTypeReasoningTextDelta:
+		choice.Delta.SetReasoningContent(streamResponse.Delta)
+	case dto.ResponsesOutputTypeItemAdded:
+		if streamResponse.Item == nil || streamResponse.Item.Type != "function_call" {
+			return nil
+		}
+		index := len(convertInfo.ToolCallIndexes)
+		convertInfo.ToolCallIndexes[streamResponse.Item.ID] = index
+		toolCall := dto.ToolCallResponse{
+			ID:   streamResponse.Item.CallId,
+			Type: "function",
+			Function: dto.FunctionResponse{
+				Name:      streamResponse.Item.Name,
+				Arguments: streamResponse.Item.Arguments,
+			},
+		}
+		toolCall.SetIndex(index)
+		choice.Delta.ToolCalls = []dto.ToolCallResponse{toolCall}
+	case dto.ResponsesStreamTypeFunctionArgumentDelta:
+		index, ok := convertInfo.ToolCallIndexes[streamResponse.ItemId]
+		if !ok {
+			return nil
+		}
+		toolCall := dto.ToolCallResponse{
+			Function: dto.FunctionResponse{
+				Arguments: streamResponse.Delta,
+			},
+		}
+		toolCall.SetIndex(index)
+		choice.Delta.ToolCalls = []dto.ToolCallResponse{toolCall}
+	case dto.ResponsesStreamTypeCompleted, dto.ResponsesStreamTypeIncomplete:
+		if streamResponse.Response == nil {
+			return nil
+		}
+		convertInfo.FinishReason = finishReasonResponses2OpenAI(streamResponse.Response, len(convertInfo.ToolCallIndexes) > 0)
+		choice.FinishReason = common.GetPointer[string](convertInfo.FinishReason)
+	default:
+		return nil
+	}
+	chunk.Choices = []dto.ChatCompletionsStreamResponseChoice{choice}
+	return chunk
+}
@@ -11,6 +11,7 @@ import (
 	"one-api/types"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func MidjourneyErrorWrapper(code int, desc string) *dto.MidjourneyResponse {
@@ -90,6 +91,11 @@ func RelayErrorHandler(resp *http.Response, showBodyWhenFail bool) (newApiErr *t
 		return
 	}
 	common.CloseResponseBodyGracefully(resp)
+	var retryAfter time.Duration
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		retryAfter = ParseRetryAfter(resp.Header, responseBody)
+	}
+	newApiErr.RetryAfter = retryAfter
 	var errResponse dto.GeneralErrorResponse
 
 	err = common.Unmarshal(responseBody, &errResponse)
@@ -108,9 +114,109 @@ func RelayErrorHandler(resp *http.Response, showBodyWhenFail bool) (newApiErr *t
 		newApiErr = types.NewErrorWithStatusCode(errors.New(errResponse.ToMessage()), types.ErrorCodeBadResponseStatusCode, resp.StatusCode)
 		newApiErr.ErrorType = types.ErrorTypeOpenAIError
 	}
+	newApiErr.RetryAfter = retryAfter
 	return
 }
 
+// 限流剩余量与对应的重置时间响应头
+var rateLimitResetHeaders = [][2]string{
+	// OpenAI，重置时间为 "1s"、"6m0s" 形式的时长
+	{"x-ratelimit-remaining-requests", "x-ratelimit-reset-requests"},
+	{"x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"},
+	// Anthropic，重置时间为 RFC 3339 时间
+	{"anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset"},
+	{"anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"},
+	{"anthropic-ratelimit-input-tokens-remaining", "anthropic-ratelimit-input-tokens-reset"},
+	{"anthropic-ratelimit-output-tokens-remaining", "anthropic-ratelimit-output-tokens-reset"},
+}
+
+// ParseRetryAfter 解析上游限流响应中需要等待的时间，依次尝试 Retry-After、retry-after-ms、
+// OpenAI / Anthropic 的限流重置响应头以及 Gemini 错误详情中的 RetryInfo，无法解析时返回 0
+func ParseRetryAfter(header http.Header, body []byte) time.Duration {
+	if value := header.Get("retry-after-ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			if wait := time.Until(date); wait > 0 {
+				return wait
+			}
+		}
+	}
+
+	// 优先使用已耗尽的限额的重置时间，都未耗尽时取最早的重置时间
+	var exhausted, earliest time.Duration
+	for _, pair := range rateLimitResetHeaders {
+		wait := parseRateLimitReset(header.Get(pair[1]))
+		if wait <= 0 {
+			continue
+		}
+		if header.Get(pair[0]) == "0" && wait > exhausted {
+			exhausted = wait
+		}
+		if earliest == 0 || wait < earliest {
+			earliest = wait
+		}
+	}
+	if exhausted > 0 {
+		return exhausted
+	}
+	if earliest > 0 {
+		return earliest
+	}
+	return parseGeminiRetryDelay(body)
+}
+
+func parseRateLimitReset(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if wait, err := time.ParseDuration(value); err == nil {
+		return wait
+	}
+	if reset, err := time.Parse(time.RFC3339, value); err == nil {
+		return time.Until(reset)
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return 0
+}
+
+// parseGeminiRetryDelay Gemini 在错误详情中返回 google.rpc.RetryInfo，如 "retryDelay": "36s"
+func parseGeminiRetryDelay(body []byte) time.Duration {
+	type geminiErrorResponse struct {
+		Error struct {
+			Details []struct {
+				Type       string `json:"@type"`
+				RetryDelay string `json:"retryDelay"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	var responses []geminiErrorResponse
+	var response geminiErrorResponse
+	if err := common.Unmarshal(body, &response); err == nil {
+		responses = append(responses, response)
+	} else if err := common.Unmarshal(body, &responses); err != nil {
+		return 0
+	}
+	for _, response := range responses {
+		for _, detail := range response.Error.Details {
+			if strings.HasSuffix(detail.Type, "google.rpc.RetryInfo") && detail.RetryDelay != "" {
+				if wait, err := time.ParseDuration(detail.RetryDelay); err == nil && wait > 0 {
+					return wait
+				}
+			}
+		}
+	}
+	return 0
+}
+
 func ResetStatusCode(newApiErr *types.NewAPIError, statusCodeMappingStr string) {
 	if statusCodeMappingStr == "" || statusCodeMappingStr == "{}" {
 		return
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/setting/operation_setting"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultUpstreamFilePurpose = "user_data"
+
+// 每轮清理的过期文件数上限
+const expiredFileCleanupBatch = 100
+
+// CleanupExpiredFiles 定期删除已过期的文件记录及其存储内容
+func CleanupExpiredFiles() {
+	for {
+		count := 0
+		for {
+			files, err := model.GetExpiredFiles(expiredFileCleanupBatch)
+			if err != nil {
+				common.SysError("cleanup expired files failed: " + err.Error())
+				break
+			}
+			deleted := 0
+			for _, file := range files {
+				if err = file.Delete(); err != nil {
+					common.SysError("failed to delete expired file record: " + err.Error())
+					continue
+				}
+				if err = GetFileStorage().Delete(file.StoragePath); err != nil {
+					common.SysError("failed to delete expired file content: " + err.Error())
+				}
+				deleted++
+			}
+			count += deleted
+			if len(files) < expiredFileCleanupBatch || deleted == 0 {
+				break
+			}
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("cleaned up %d expired files", count))
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// SaveGeneratedFile 保存由网关生成的文件（如批处理的输入输出），之后可通过 /v1/files 访问
+func SaveGeneratedFile(userId int, tokenId int, filename string, purpose string, reader io.Reader) (*model.File, error) {
+	fileId := "file-" + common.GetRandomString(24)
+	storage := GetFileStorage()
+	storagePath, written, err := storage.Save(fileId, reader)
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		Id:          fileId,
+		UserId:      userId,
+		TokenId:     tokenId,
+		Filename:    filename,
+		Purpose:     purpose,
+		Bytes:       written,
+		MimeType:    "application/jsonl",
+		StoragePath: storagePath,
+		Status:      model.FileStatusProcessed,
+		CreatedAt:   common.GetTimestamp(),
+	}
+	if retentionDays := operation_setting.GetFileSetting().RetentionDays; retentionDays > 0 {
+		file.ExpiresAt = file.CreatedAt + int64(retentionDays)*24*3600
+	}
+	if err := file.Insert(); err != nil {
+		_ = storage.Delete(storagePath)
+		return nil, err
+	}
+	return file, nil
+}
+
+// ResolveFileReferences 将聊天请求中引用的网关文件 id 替换为所选渠道可用的文件：
+// OpenAI 渠道按需上传到上游并改写为上游文件 id，其余渠道改为内联 base64 数据
+func ResolveFileReferences(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) error {
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		if message.Content == nil || message.IsStringContent() {
+			continue
+		}
+		contents := message.ParseContent()
+		changed := false
+		for j := range contents {
+			if contents[j].Type != dto.ContentTypeFile {
+				continue
+			}
+			messageFile := contents[j].GetFile()
+			if messageFile == nil || messageFile.FileId == "" {
+				continue
+			}
+			resolved, err := resolveFileId(c, info, messageFile.FileId)
+			if err != nil {
+				return err
+			}
+			if resolved == nil {
+				// 不是网关保存的文件，原样透传给上游
+				continue
+			}
+			contents[j].File = resolved
+			changed = true
+		}
+		if changed {
+			message.SetMediaContent(contents)
+		}
+	}
+	return nil
+}
+
+// ResolveResponsesFileReferences 处理 Responses 请求 input 中的 input_file 引用
+func ResolveResponsesFileReferences(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) error {
+	if len(request.Input) == 0 || !strings.Contains(string(request.Input), "input_file") {
+		return nil
+	}
+	var input any
+	if err := common.Unmarshal(request.Input, &input); err != nil {
+		return nil
+	}
+	changed, err := resolveResponsesInputFiles(c, info, input)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	data, err := common.Marshal(input)
+	if err != nil {
+		return err
+	}
+	request.Input = data
+	return nil
+}
+
+func resolveResponsesInputFiles(c *gin.Context, info *relaycommon.RelayInfo, node any) (bool, error) {
+	changed := false
+	switch v := node.(type) {
+	case []any:
+		for _, item := range v {
+			itemChanged, err := resolveResponsesInputFiles(c, info, item)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || itemChanged
+		}
+	case map[string]any:
+		if common.Interface2String(v["type"]) == "input_file" {
+			fileId := common.Interface2String(v["file_id"])
+			if fileId == "" {
+				return false, nil
+			}
+			resolved, err := resolveFileId(c, info, fileId)
+			if err != nil || resolved == nil {
+				return false, err
+			}
+			if resolved.FileId != "" {
+				v["file_id"] = resolved.FileId
+			} else {
+				delete(v, "file_id")
+				v["filename"] = resolved.FileName
+				v["file_data"] = resolved.FileData
+			}
+			return true, nil
+		}
+		if content, ok := v["content"]; ok {
+			return resolveResponsesInputFiles(c, info, content)
+		}
+	}
+	return changed, nil
+}
+
+// resolveFileId 返回 nil 表示该 id 不属于网关文件
+func resolveFileId(c *gin.Context, info *relaycommon.RelayInfo, fileId string) (*dto.MessageFile, error) {
+	file, err := model.GetUserFileById(fileId, info.UserId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if file.IsExpired() {
+		return nil, fmt.Errorf("file %s has expired", fileId)
+	}
+	if supportsUpstreamFiles(info) {
+		upstreamFileId, err := ensureUpstreamFile(c, info, file)
+		if err != nil {
+			return nil, err
+		}
+		return &dto.MessageFile{FileId: upstreamFileId}, nil
+	}
+	dataUrl, err := readFileAsDataUrl(file)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.MessageFile{
+		FileName: file.Filename,
+		FileData: dataUrl,
+	}, nil
+}
+
+func supportsUpstreamFiles(info *relaycommon.RelayInfo) bool {
+	return info.ChannelType == constant.ChannelTypeOpenAI
+}
+
+// fileUpstreamKey 多 Key 渠道的文件只对上传时使用的 key 可见，因此需要区分 key
+func fileUpstreamKey(c *gin.Context, info *relaycommon.RelayInfo) string {
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		return fmt.Sprintf("%d:%d", info.ChannelId, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex))
+	}
+	return fmt.Sprintf("%d", info.ChannelId)
+}
+
+func ensureUpstreamFile(c *gin.Context, info *relaycommon.RelayInfo, file *model.File) (string, error) {
+	upstreamKey := fileUpstreamKey(c, info)
+	if upstreamFileId := file.GetUpstreamFileId(upstreamKey); upstreamFileId != "" {
+		return upstreamFileId, nil
+	}
+	upstreamFileId, err := uploadFileToUpstream(info, file)
+	if err != nil {
+		return "", fmt.Errorf("upload file %s to upstream failed: %w", file.Id, err)
+	}
+	if err := file.SetUpstreamFileId(upstreamKey, upstreamFileId); err != nil {
+		common.LogError(c, fmt.Sprintf("failed to save upstream file id of %s: %s", file.Id, err.Error()))
+	}
+	common.LogInfo(c, fmt.Sprintf("file %s uploaded to channel #%d as %s", file.Id, info.ChannelId, upstreamFileId))
+	return upstreamFileId, nil
+}
+
+func uploadFileToUpstream(info *relaycommon.RelayInfo, file *model.File) (string, error) {
+	reader, err := GetFileStorage().Open(file.StoragePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		purpose := file.Purpose
+		if purpose == "" {
+			purpose = defaultUpstreamFilePurpose
+		}
+		err := writer.WriteField("purpose", purpose)
+		if err == nil {
+			var part io.Writer
+			part, err = writer.CreateFormFile("file", file.Filename)
+			if err == nil {
+				_, err = io.Copy(part, reader)
+			}
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		_ = pipeWriter.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/files", strings.TrimSuffix(info.BaseUrl, "/")), pipeReader)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+info.ApiKey)
+	if info.Organization != "" {
+		req.Header.Set("OpenAI-Organization", info.Organization)
+	}
+
+	client := GetHttpClient()
+	if info.ChannelSetting.Proxy != "" {
+		client, err = NewProxyHttpClient(info.ChannelSetting.Proxy)
+		if err != nil {
+			return "", err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d: %s", resp.StatusCode, string(body))
+	}
+	var uploaded dto.OpenAIFile
+	if err := common.Unmarshal(body, &uploaded); err != nil {
+		return "", err
+	}
+	if uploaded.Id == "" {
+		return "", errors.New("upstream returned empty file id")
+	}
+	return uploaded.Id, nil
+}
+
+func readFileAsDataUrl(file *model.File) (string, error) {
+	reader, err := GetFileStorage().Open(file.StoragePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
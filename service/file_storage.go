@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"one-api/constant"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStorage 是文件接口的存储后端，默认使用本地磁盘，可通过 SetFileStorage 替换
+type FileStorage interface {
+	// Save 写入文件内容，返回存储路径与写入字节数
+	Save(fileId string, reader io.Reader) (string, int64, error)
+	Open(storagePath string) (io.ReadCloser, error)
+	Delete(storagePath string) error
+}
+
+var (
+	fileStorage     FileStorage
+	fileStorageLock sync.Mutex
+)
+
+func SetFileStorage(storage FileStorage) {
+	fileStorageLock.Lock()
+	defer fileStorageLock.Unlock()
+	fileStorage = storage
+}
+
+func GetFileStorage() FileStorage {
+	fileStorageLock.Lock()
+	defer fileStorageLock.Unlock()
+	if fileStorage == nil {
+		fileStorage = NewLocalFileStorage(constant.FileStoragePath)
+	}
+	return fileStorage
+}
+
+type LocalFileStorage struct {
+	BaseDir string
+}
+
+func NewLocalFileStorage(baseDir string) *LocalFileStorage {
+	if baseDir == "" {
+		baseDir = "./files"
+	}
+	return &LocalFileStorage{BaseDir: baseDir}
+}
+
+func (s *LocalFileStorage) path(storagePath string) (string, error) {
+	cleaned := filepath.Clean("/" + storagePath)
+	if strings.Contains(cleaned, "..") {
+		return "", errors.New("invalid storage path")
+	}
+	return filepath.Join(s.BaseDir, cleaned), nil
+}
+
+func (s *LocalFileStorage) Save(fileId string, reader io.Reader) (string, int64, error) {
+	// 按 id 前缀分目录，避免单目录文件过多
+	prefix := strings.TrimPrefix(fileId, "file-")
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	storagePath := filepath.Join(prefix, fileId)
+	fullPath, err := s.path(storagePath)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return "", 0, err
+	}
+	out, err := os.Create(fullPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer out.Close()
+	written, err := io.Copy(out, reader)
+	if err != nil {
+		_ = os.Remove(fullPath)
+		return "", 0, err
+	}
+	return storagePath, written, nil
+}
+
+func (s *LocalFileStorage) Open(storagePath string) (io.ReadCloser, error) {
+	fullPath, err := s.path(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+func (s *LocalFileStorage) Delete(storagePath string) error {
+	fullPath, err := s.path(storagePath)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fullPath)
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
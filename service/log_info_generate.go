@@ -6,6 +6,7 @@ import (
 	"one-api/dto"
 	relaycommon "one-api/relay/common"
 	"one-api/relay/helper"
+	"one-api/setting/ratio_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,6 +29,14 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if requestedModel := common.GetContextKeyString(ctx, constant.ContextKeyRequestedModel); requestedModel != "" {
+		// 改用了后备模型，日志的模型名称为实际提供服务的模型
+		other["requested_model"] = requestedModel
+	}
+	if batchId := common.GetBatchId(ctx); batchId != "" {
+		other["batch_id"] = batchId
+		other["batch_ratio"] = ratio_setting.GetBatchDiscountRatio()
+	}
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	isMultiKey := common.GetContextKeyBool(ctx, constant.ContextKeyChannelIsMultiKey)
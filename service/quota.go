@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"net/http"
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
@@ -12,7 +13,9 @@ import (
 	relaycommon "one-api/relay/common"
 	"one-api/relay/helper"
 	"one-api/setting"
+	"one-api/setting/operation_setting"
 	"one-api/setting/ratio_setting"
+	"one-api/types"
 	"strings"
 	"time"
 
@@ -128,7 +131,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 
 	quota := calculateAudioQuota(quotaInfo)
 
-	if userQuota < quota {
+	if userQuota+relayInfo.UserCreditLimit < quota {
 		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(quota))
 	}
 
@@ -147,6 +150,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string,
 	usage *dto.RealtimeUsage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
 
+	preConsumedQuota = SettleQuotaReservation(relayInfo, preConsumedQuota)
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	textInputTokens := usage.InputTokenDetails.TextTokens
 	textOutTokens := usage.OutputTokenDetails.TextTokens
@@ -182,6 +186,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	quota := calculateAudioQuota(quotaInfo)
 
 	totalTokens := usage.TotalTokens
+	ReconcileTokenTpm(relayInfo, totalTokens)
 	var logContent string
 	if !usePrice {
 		logContent = fmt.Sprintf("模型倍率 %.2f，补全倍率 %.2f，音频倍率 %.2f，音频补全倍率 %.2f，分组倍率 %.2f",
@@ -229,6 +234,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
 
+	preConsumedQuota = SettleQuotaReservation(relayInfo, preConsumedQuota)
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
@@ -274,6 +280,7 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	quota := int(calculateQuota)
 
 	totalTokens := promptTokens + completionTokens
+	ReconcileTokenTpm(relayInfo, totalTokens)
 
 	var logContent string
 	// record all the consume log even if quota is 0
@@ -341,6 +348,7 @@ func CalcOpenRouterCacheCreateTokens(usage dto.Usage, priceData helper.PriceData
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
 
+	preConsumedQuota = SettleQuotaReservation(relayInfo, preConsumedQuota)
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	textInputTokens := usage.PromptTokensDetails.TextTokens
 	textOutTokens := usage.CompletionTokenDetails.TextTokens
@@ -376,6 +384,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	quota := calculateAudioQuota(quotaInfo)
 
 	totalTokens := usage.TotalTokens
+	ReconcileTokenTpm(relayInfo, totalTokens)
 	var logContent string
 	if !usePrice {
 		logContent = fmt.Sprintf("模型倍率 %.2f，补全倍率 %.2f，音频倍率 %.2f，音频补全倍率 %.2f，分组倍率 %.2f",
@@ -438,20 +447,100 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	//if relayInfo.TokenUnlimited {
 	//	return nil
 	//}
+	_, err := checkTokenQuota(relayInfo, quota)
+	if err != nil {
+		return err
+	}
+	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
+	if err != nil {
+		_ = model.AdjustTokenPeriodQuota(relayInfo.TokenId, relayInfo.TokenKey, relayInfo.TokenPeriodStart, -quota)
+		return err
+	}
+	return nil
+}
+
+// CheckTokenPeriodQuota 按次计费的请求在提交前检查令牌本周期的剩余额度，实际计入在 PostConsumeQuota 中进行
+func CheckTokenPeriodQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
+	if relayInfo.TokenPeriodStart == 0 || relayInfo.IsPlayground {
+		return nil
+	}
 	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
 	if err != nil {
 		return err
 	}
+	if !token.PeriodQuotaAvailable(quota) {
+		return fmt.Errorf("token period quota is not enough, period limit: %s, need quota: %s", common.FormatQuota(token.PeriodQuotaLimit), common.FormatQuota(quota))
+	}
+	return nil
+}
+
+// checkTokenQuota 检查令牌余额并预留本周期的额度
+func checkTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) (*model.Token, error) {
+	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+	if err != nil {
+		return nil, err
+	}
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
-		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", common.FormatQuota(token.RemainQuota), common.FormatQuota(quota))
+		return nil, fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", common.FormatQuota(token.RemainQuota), common.FormatQuota(quota))
 	}
-	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
+	if relayInfo.TokenPeriodStart == 0 {
+		relayInfo.TokenPeriodStart = token.CurrentPeriodStart()
+	}
+	ok, err := model.ReserveTokenPeriodQuota(token, relayInfo.TokenPeriodStart, quota)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !ok {
+		token.RefreshBudgetPeriod()
+		return nil, fmt.Errorf("token period quota is not enough, period limit: %s, need quota: %s", common.FormatQuota(token.PeriodQuotaLimit), common.FormatQuota(quota))
 	}
+	return token, nil
+}
+
+// ReserveQuota 通过额度预留账本原子地检查并预扣用户与令牌的额度，代替分别扣减令牌与用户额度，
+// 避免高并发下在缓存与数据库同步前超额消费
+func ReserveQuota(relayInfo *relaycommon.RelayInfo, quota int) *types.NewAPIError {
+	var token *model.Token
+	tokenId := 0
+	if !relayInfo.IsPlayground {
+		var err error
+		token, err = checkTokenQuota(relayInfo, quota)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden)
+		}
+		tokenId = relayInfo.TokenId
+	}
+	id, err := model.ReserveQuota(relayInfo.UserId, tokenId, relayInfo.TokenKey, quota, !relayInfo.TokenUnlimited)
+	if err != nil {
+		if token != nil {
+			_ = model.AdjustTokenPeriodQuota(relayInfo.TokenId, relayInfo.TokenKey, relayInfo.TokenPeriodStart, -quota)
+		}
+		switch {
+		case errors.Is(err, model.ErrUserQuotaNotEnough):
+			return types.NewErrorWithStatusCode(fmt.Errorf("pre-consume quota failed, user quota is not enough, need quota: %s", common.FormatQuota(quota)), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden)
+		case errors.Is(err, model.ErrTokenQuotaNotEnough):
+			return types.NewErrorWithStatusCode(fmt.Errorf("token quota is not enough, need quota: %s", common.FormatQuota(quota)), types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden)
+		}
+		return types.NewError(err, types.ErrorCodeUpdateDataError)
+	}
+	relayInfo.ReservationId = id
 	return nil
 }
 
+// SettleQuotaReservation 结算或退还预扣额度前释放预扣记录；记录已被回收任务退还时返回 0，调用方按未预扣结算
+func SettleQuotaReservation(relayInfo *relaycommon.RelayInfo, preConsumedQuota int) int {
+	if relayInfo.ReservationId == "" {
+		return preConsumedQuota
+	}
+	id := relayInfo.ReservationId
+	relayInfo.ReservationId = ""
+	if !model.ReleaseQuotaReservation(id) {
+		common.SysLog(fmt.Sprintf("quota reservation %s of user %d was already returned, settling without pre-consumed quota", id, relayInfo.UserId))
+		return 0
+	}
+	return preConsumedQuota
+}
+
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
 	if quota > 0 {
@@ -472,6 +561,10 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		err = model.AdjustTokenPeriodQuota(relayInfo.TokenId, relayInfo.TokenKey, relayInfo.TokenPeriodStart, quota)
+		if err != nil {
+			return err
+		}
 	}
 
 	if sendEmail {
@@ -494,6 +587,10 @@ func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preCon
 		//noMoreQuota := userCache.Quota-(quota+preConsumedQuota) <= 0
 		quotaTooLow := false
 		consumeQuota := quota + preConsumedQuota
+		// 授信用户在余额提醒之外，透支达到比例时另行提醒
+		if relayInfo.UserCreditLimit > 0 {
+			checkAndSendCreditNotify(relayInfo, relayInfo.UserQuota-consumeQuota)
+		}
 		if relayInfo.UserQuota-consumeQuota < threshold {
 			quotaTooLow = true
 		}
@@ -508,3 +605,17 @@ func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preCon
 		}
 	})
 }
+
+// checkAndSendCreditNotify 授信用户的余额为负时，已透支的额度达到授信额度的一定比例后提醒用户
+func checkAndSendCreditNotify(relayInfo *relaycommon.RelayInfo, balance int) {
+	percent := operation_setting.GetCreditSetting().WarningPercent
+	if balance >= 0 || percent <= 0 || -balance*100 < relayInfo.UserCreditLimit*percent {
+		return
+	}
+	prompt := "您的授信额度即将用尽"
+	content := "{{value}}，已使用授信额度 {{value}}，授信额度为 {{value}}，用尽后请求将被拒绝，请及时结算。"
+	err := NotifyUser(relayInfo.UserId, relayInfo.UserEmail, relayInfo.UserSetting, dto.NewNotify(dto.NotifyTypeCreditLimit, prompt, content, []interface{}{prompt, common.FormatQuota(-balance), common.FormatQuota(relayInfo.UserCreditLimit)}))
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to send credit notify to user %d: %s", relayInfo.UserId, err.Error()))
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/setting/operation_setting"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExpandPreviousResponse 将 previous_response_id 展开为完整的 input，使会话状态不依赖上游存储，
+// 换渠道重试或请求非 OpenAI 渠道时同样可用。native 表示请求将以 Responses API 原样发往上游
+func ExpandPreviousResponse(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, native bool) error {
+	if !operation_setting.GetResponseStoreSetting().Enabled {
+		return nil
+	}
+	input, err := normalizeResponsesInput(request.Input)
+	if err != nil {
+		return err
+	}
+	var storeInfo *relaycommon.ResponsesStoreInfo
+	if request.ShouldStore() {
+		// 只保存本轮新增的输入，完整会话沿 previous_response_id 重建
+		data, err := common.Marshal(input)
+		if err != nil {
+			return err
+		}
+		storeInfo = &relaycommon.ResponsesStoreInfo{Input: data}
+	}
+	if request.PreviousResponseID != "" {
+		chain, err := model.GetTokenStoredResponseChain(request.PreviousResponseID, info.TokenId)
+		if err != nil {
+			// 网关未保存（如功能开启前创建）时，原生渠道交给上游自行处理
+			if native {
+				common.LogWarn(c, fmt.Sprintf("previous response %s not found in gateway store, pass through to upstream", request.PreviousResponseID))
+				info.ResponsesStoreInfo = storeInfo
+				return nil
+			}
+			return fmt.Errorf("previous response with id '%s' not found", request.PreviousResponseID)
+		}
+		var history []json.RawMessage
+		for _, previous := range chain {
+			for _, items := range []json.RawMessage{previous.Input, previous.Output} {
+				if len(items) == 0 {
+					continue
+				}
+				var turn []json.RawMessage
+				if err := common.Unmarshal(items, &turn); err != nil {
+					return err
+				}
+				history = append(history, turn...)
+			}
+		}
+		if storeInfo != nil {
+			storeInfo.PreviousResponseId = request.PreviousResponseID
+			storeInfo.ConversationId = chain[0].ConversationId
+		}
+		if native {
+			history = filterReplayableItems(history)
+		}
+		data, err := common.Marshal(append(history, input...))
+		if err != nil {
+			return err
+		}
+		request.Input = data
+		if native {
+			// 上游不一定保存了该 response，已展开为完整输入后不再发送
+			request.PreviousResponseID = ""
+		}
+	}
+	info.ResponsesStoreInfo = storeInfo
+	return nil
+}
+
+// normalizeResponsesInput 字符串形式的 input 等价于一条 user 消息
+func normalizeResponsesInput(input json.RawMessage) ([]json.RawMessage, error) {
+	var str string
+	if err := common.Unmarshal(input, &str); err == nil {
+		item, err := common.Marshal(dto.ResponsesInputItem{
+			Type:    "message",
+			Role:    "user",
+			Content: input,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	}
+	var items []json.RawMessage
+	if err := common.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	return items, nil
+}
+
+// filterReplayableItems 没有 encrypted_content 的 reasoning item 只能通过 id 引用上游存储，
+// 换渠道或上游未保存时会报错，原样发往上游前去掉
+func filterReplayableItems(items []json.RawMessage) []json.RawMessage {
+	filtered := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		var head struct {
+			Type             string `json:"type"`
+			EncryptedContent string `json:"encrypted_content"`
+		}
+		if err := common.Unmarshal(item, &head); err == nil && head.Type == "reasoning" && head.EncryptedContent == "" {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+// SaveStoredResponse 请求成功后保存本轮的输入与输出，失败只记录日志
+func SaveStoredResponse(c *gin.Context, info *relaycommon.RelayInfo) {
+	storeInfo := info.ResponsesStoreInfo
+	if storeInfo == nil || len(storeInfo.Response) == 0 {
+		return
+	}
+	var response struct {
+		Id     string          `json:"id"`
+		Model  string          `json:"model"`
+		Output json.RawMessage `json:"output"`
+	}
+	if err := common.Unmarshal(storeInfo.Response, &response); err != nil || response.Id == "" {
+		common.LogError(c, "parse response for store failed")
+		return
+	}
+	if len(response.Output) == 0 || response.Output[0] != '[' {
+		response.Output = json.RawMessage("[]")
+	}
+	now := time.Now().Unix()
+	storedResponse := &model.StoredResponse{
+		Id:                 response.Id,
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		Model:              response.Model,
+		PreviousResponseId: storeInfo.PreviousResponseId,
+		ConversationId:     storeInfo.ConversationId,
+		Input:              storeInfo.Input,
+		Output:             response.Output,
+		Response:           storeInfo.Response,
+		CreatedAt:          now,
+	}
+	if storedResponse.ConversationId == "" {
+		storedResponse.ConversationId = response.Id
+	}
+	if retentionDays := operation_setting.GetResponseStoreSetting().RetentionDays; retentionDays > 0 {
+		storedResponse.ExpiresAt = now + int64(retentionDays)*24*3600
+	}
+	if err := storedResponse.Save(); err != nil {
+		common.LogError(c, fmt.Sprintf("save response %s failed: %s", response.Id, err.Error()))
+	}
+}
+
+// CleanupExpiredStoredResponses 定期清理过期的会话状态
+func CleanupExpiredStoredResponses() {
+	for {
+		count, err := model.DeleteExpiredStoredResponses()
+		if err != nil {
+			common.SysError("cleanup expired responses failed: " + err.Error())
+		} else if count > 0 {
+			common.SysLog(fmt.Sprintf("cleaned up %d expired responses", count))
+		}
+		time.Sleep(time.Hour)
+	}
+}
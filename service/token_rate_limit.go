@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"one-api/common"
+	"one-api/common/limiter"
+	"one-api/constant"
+	relaycommon "one-api/relay/common"
+	"one-api/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 令牌桶每秒补充 limit 个单位，每个请求或 token 记为 60 个单位，桶容量为一分钟的量
+const tokenRateLimitUnit = 60
+
+var tokenMemoryLimiter = limiter.NewMemoryLimiter()
+
+func tokenRateLimitKey(kind string, tokenId int) string {
+	return fmt.Sprintf("tokenRateLimit:%s:%d", kind, tokenId)
+}
+
+// takeTokenRateLimit 从令牌的限流桶中取出 requested 个请求或 token，启用 Redis 时使用 Redis 中的令牌桶
+func takeTokenRateLimit(key string, limit int, requested int, force bool) (*limiter.Result, error) {
+	opts := []limiter.Option{
+		limiter.WithCapacity(int64(limit) * tokenRateLimitUnit),
+		limiter.WithRate(int64(limit)),
+		limiter.WithRequested(int64(requested) * tokenRateLimitUnit),
+	}
+	if force {
+		opts = append(opts, limiter.WithForce())
+	}
+	if common.RedisEnabled {
+		ctx := context.Background()
+		return limiter.New(ctx, common.RDB).Take(ctx, key, opts...)
+	}
+	return tokenMemoryLimiter.Take(key, opts...), nil
+}
+
+// setRateLimitHeaders 设置 x-ratelimit-* 响应头，kind 为 requests 或 tokens，重置时间为桶重新装满的时间
+func setRateLimitHeaders(c *gin.Context, kind string, limit int, result *limiter.Result) {
+	remaining := max(result.Remaining, 0) / tokenRateLimitUnit
+	capacity := int64(limit) * tokenRateLimitUnit
+	resetSeconds := math.Ceil(float64(capacity-result.Remaining) / float64(limit))
+	c.Header("x-ratelimit-limit-"+kind, strconv.Itoa(limit))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(remaining, 10))
+	c.Header("x-ratelimit-reset-"+kind, (time.Duration(max(resetSeconds, 0)) * time.Second).String())
+}
+
+// CheckTokenRateLimit 在请求进入时检查令牌的每分钟请求数，并在 token 数已经用尽时直接拒绝，
+// 返回的错误信息用于 429 响应
+func CheckTokenRateLimit(c *gin.Context) (bool, string, error) {
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	if rpm := common.GetContextKeyInt(c, constant.ContextKeyTokenRpmLimit); rpm > 0 {
+		result, err := takeTokenRateLimit(tokenRateLimitKey("rpm", tokenId), rpm, 1, false)
+		if err != nil {
+			return false, "", err
+		}
+		setRateLimitHeaders(c, "requests", rpm, result)
+		if !result.Allowed {
+			return false, fmt.Sprintf("该令牌已达到每分钟请求数限制：%d", rpm), nil
+		}
+	}
+	if tpm := common.GetContextKeyInt(c, constant.ContextKeyTokenTpmLimit); tpm > 0 {
+		result, err := takeTokenRateLimit(tokenRateLimitKey("tpm", tokenId), tpm, 0, false)
+		if err != nil {
+			return false, "", err
+		}
+		setRateLimitHeaders(c, "tokens", tpm, result)
+		if result.Remaining <= 0 {
+			return false, fmt.Sprintf("该令牌已达到每分钟 token 数限制：%d", tpm), nil
+		}
+	}
+	return true, "", nil
+}
+
+// ChargeTokenTpm 按预估的提示词 token 数计入令牌的 TPM，超出时拒绝本次请求
+func ChargeTokenTpm(c *gin.Context, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	if relayInfo.TokenTpmLimit <= 0 {
+		return nil
+	}
+	result, err := takeTokenRateLimit(tokenRateLimitKey("tpm", relayInfo.TokenId), relayInfo.TokenTpmLimit, relayInfo.PromptTokens, false)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError)
+	}
+	setRateLimitHeaders(c, "tokens", relayInfo.TokenTpmLimit, result)
+	if !result.Allowed {
+		return types.NewErrorWithStatusCode(fmt.Errorf("token tpm limit exceeded, limit: %d, need tokens: %d",
+			relayInfo.TokenTpmLimit, relayInfo.PromptTokens), types.ErrorCodeTokenRateLimited, http.StatusTooManyRequests)
+	}
+	relayInfo.TokenTpmCharged = relayInfo.PromptTokens
+	return nil
+}
+
+// ReconcileTokenTpm 按实际用量校正预计入的 TPM，totalTokens 为 0 时（请求失败）全部退还
+func ReconcileTokenTpm(relayInfo *relaycommon.RelayInfo, totalTokens int) {
+	if relayInfo.TokenTpmLimit <= 0 {
+		return
+	}
+	delta := totalTokens - relayInfo.TokenTpmCharged
+	relayInfo.TokenTpmCharged = totalTokens
+	if delta == 0 {
+		return
+	}
+	_, err := takeTokenRateLimit(tokenRateLimitKey("tpm", relayInfo.TokenId), relayInfo.TokenTpmLimit, delta, true)
+	if err != nil {
+		common.SysError("failed to reconcile token tpm: " + err.Error())
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	relaycommon "one-api/relay/common"
+	"one-api/types"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupTokenTpm 使用内存令牌桶，各测试使用不同的令牌 id 避免共用桶
+func setupTokenTpm(t *testing.T) *gin.Context {
+	oldEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() { common.RedisEnabled = oldEnabled })
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	return c
+}
+
+// remainingTpm 返回桶中剩余的 token 数，测试期间的补充不足一个 token
+func remainingTpm(t *testing.T, tokenId int, limit int) int64 {
+	result, err := takeTokenRateLimit(tokenRateLimitKey("tpm", tokenId), limit, 0, false)
+	assert.NoError(t, err)
+	return result.Remaining / tokenRateLimitUnit
+}
+
+// TestChargeTokenTpmRejects 测试预估 token 数超出剩余 TPM 时拒绝请求且不计入
+func TestChargeTokenTpmRejects(t *testing.T) {
+	c := setupTokenTpm(t)
+	first := &relaycommon.RelayInfo{TokenId: 9001, TokenTpmLimit: 100}
+	first.SetPromptTokens(80)
+	assert.Nil(t, ChargeTokenTpm(c, first))
+	assert.Equal(t, 80, first.TokenTpmCharged)
+
+	second := &relaycommon.RelayInfo{TokenId: 9001, TokenTpmLimit: 100}
+	second.SetPromptTokens(30)
+	apiErr := ChargeTokenTpm(c, second)
+	if assert.NotNil(t, apiErr) {
+		assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+		assert.Equal(t, types.ErrorCodeTokenRateLimited, apiErr.GetErrorCode())
+	}
+	assert.Equal(t, 0, second.TokenTpmCharged)
+	assert.InDelta(t, 20, remainingTpm(t, 9001, 100), 1)
+}
+
+// TestReconcileTokenTpm 测试按实际用量多退少补，请求失败时全部退还
+func TestReconcileTokenTpm(t *testing.T) {
+	c := setupTokenTpm(t)
+	info := &relaycommon.RelayInfo{TokenId: 9002, TokenTpmLimit: 100}
+	info.SetPromptTokens(50)
+	assert.Nil(t, ChargeTokenTpm(c, info))
+
+	// 实际用量超出预估时补扣，可以透支
+	ReconcileTokenTpm(info, 120)
+	assert.Equal(t, 120, info.TokenTpmCharged)
+	assert.InDelta(t, -20, remainingTpm(t, 9002, 100), 1)
+
+	// 请求失败时退还全部已计入的 token
+	ReconcileTokenTpm(info, 0)
+	assert.Equal(t, 0, info.TokenTpmCharged)
+	assert.Equal(t, int64(100), remainingTpm(t, 9002, 100), "退还后不超过容量")
+}
@@ -0,0 +1,35 @@
+package model_setting
+
+import (
+	"one-api/setting/config"
+)
+
+// ModelFallbackSettings 模型后备链：请求模型的所有渠道都以可重试的错误失败后，依次改用后备模型
+type ModelFallbackSettings struct {
+	Enabled bool `json:"enabled"`
+	// 请求模型 -> 按顺序尝试的后备模型，例如 {"claude-sonnet-4-0": ["gpt-4.1", "deepseek-chat"]}
+	Chains map[string][]string `json:"chains"`
+}
+
+// 默认配置
+var modelFallbackSettings = ModelFallbackSettings{
+	Enabled: true,
+	Chains:  map[string][]string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback", &modelFallbackSettings)
+}
+
+func GetModelFallbackSettings() *ModelFallbackSettings {
+	return &modelFallbackSettings
+}
+
+// GetModelFallbackChain 获取模型的后备链，未配置或未启用时返回 nil
+func GetModelFallbackChain(model string) []string {
+	if !modelFallbackSettings.Enabled {
+		return nil
+	}
+	return modelFallbackSettings.Chains[model]
+}
@@ -2,15 +2,24 @@ package model_setting
 
 import (
 	"one-api/setting/config"
+	"strings"
 )
 
 type GlobalSettings struct {
 	PassThroughRequestEnabled bool `json:"pass_through_request_enabled"`
+	// 仅支持 Responses API 的模型，Chat Completions 请求会转换为 Responses 请求上游（前缀匹配）
+	ResponsesOnlyModels []string `json:"responses_only_models"`
 }
 
 // 默认配置
 var defaultOpenaiSettings = GlobalSettings{
 	PassThroughRequestEnabled: false,
+	ResponsesOnlyModels: []string{
+		"o1-pro",
+		"o3-pro",
+		"codex-mini",
+		"computer-use-preview",
+	},
 }
 
 // 全局实例
@@ -24,3 +33,13 @@ func init() {
 func GetGlobalSettings() *GlobalSettings {
 	return &globalSettings
 }
+
+// IsResponsesOnlyModel 判断模型是否只能通过 Responses API 调用
+func IsResponsesOnlyModel(model string) bool {
+	for _, prefix := range globalSettings.ResponsesOnlyModels {
+		if prefix != "" && strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
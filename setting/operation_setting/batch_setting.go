@@ -0,0 +1,28 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// BatchSetting 批处理接口（/v1/batches）相关配置
+type BatchSetting struct {
+	Enabled bool `json:"enabled"`
+	// 单个批处理任务允许的最大请求数
+	MaxRequestsPerBatch int `json:"max_requests_per_batch"`
+	// 单个批处理任务同时执行的请求数
+	Concurrency int `json:"concurrency"`
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	Enabled:             true,
+	MaxRequestsPerBatch: 50000,
+	Concurrency:         4,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
@@ -0,0 +1,40 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// ChannelBreakerSetting 渠道熔断配置，多密钥渠道同时按密钥熔断
+type ChannelBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// 连续失败次数达到阈值时熔断，0 表示不按连续失败熔断
+	FailureThreshold int `json:"failure_threshold"`
+	// 统计窗口内错误率（0-1）达到阈值时熔断，0 表示不按错误率熔断
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// 统计窗口内请求数不足时不按错误率熔断
+	MinRequests int `json:"min_requests"`
+	// 错误率统计窗口（秒）
+	WindowSeconds int `json:"window_seconds"`
+	// 熔断后经过该时间进入半开状态（秒）
+	CooldownSeconds int `json:"cooldown_seconds"`
+	// 半开状态下放行的探测请求数，全部成功后恢复
+	HalfOpenProbes int `json:"half_open_probes"`
+}
+
+// 默认配置
+var channelBreakerSetting = ChannelBreakerSetting{
+	Enabled:            false,
+	FailureThreshold:   5,
+	ErrorRateThreshold: 0.5,
+	MinRequests:        20,
+	WindowSeconds:      60,
+	CooldownSeconds:    30,
+	HalfOpenProbes:     1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_breaker_setting", &channelBreakerSetting)
+}
+
+func GetChannelBreakerSetting() *ChannelBreakerSetting {
+	return &channelBreakerSetting
+}
@@ -0,0 +1,37 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// ChannelConcurrencySetting 渠道限流或达到并发上限时的排队配置，并发上限本身在渠道上设置
+type ChannelConcurrencySetting struct {
+	// 所有可用渠道都在限流冷却中或达到并发上限时是否排队等待，关闭时直接返回错误
+	QueueEnabled bool `json:"queue_enabled"`
+	// 每个实例同时排队的请求数上限
+	MaxQueueSize int `json:"max_queue_size"`
+	// 排队等待的最长秒数
+	QueueTimeoutSeconds int `json:"queue_timeout_seconds"`
+	// 用户分组 -> 排队优先级，数值越大越先放行，未配置的分组为 0
+	GroupPriorities map[string]int `json:"group_priorities"`
+}
+
+// 默认配置
+var channelConcurrencySetting = ChannelConcurrencySetting{
+	QueueEnabled:        true,
+	MaxQueueSize:        1000,
+	QueueTimeoutSeconds: 30,
+	GroupPriorities:     map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_concurrency_setting", &channelConcurrencySetting)
+}
+
+func GetChannelConcurrencySetting() *ChannelConcurrencySetting {
+	return &channelConcurrencySetting
+}
+
+// GetGroupQueuePriority 获取用户分组的排队优先级
+func GetGroupQueuePriority(group string) int {
+	return channelConcurrencySetting.GroupPriorities[group]
+}
@@ -0,0 +1,28 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// ChannelCooldownSetting 上游限流后按 Retry-After 等响应头暂停选择渠道的配置
+type ChannelCooldownSetting struct {
+	Enabled bool `json:"enabled"`
+	// 上游返回 429 但没有可解析的重置时间时的冷却秒数，0 表示不冷却
+	DefaultSeconds int `json:"default_seconds"`
+	// 冷却时间上限（秒），避免异常的响应头导致渠道长时间不可用
+	MaxSeconds int `json:"max_seconds"`
+}
+
+// 默认配置
+var channelCooldownSetting = ChannelCooldownSetting{
+	Enabled:        true,
+	DefaultSeconds: 0,
+	MaxSeconds:     600,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_cooldown_setting", &channelCooldownSetting)
+}
+
+func GetChannelCooldownSetting() *ChannelCooldownSetting {
+	return &channelCooldownSetting
+}
@@ -0,0 +1,40 @@
+package operation_setting
+
+import (
+	"one-api/setting/config"
+	"time"
+)
+
+// ChannelHedgeSetting 对冲请求配置：主渠道在延迟内没有输出首个内容时，向另一个渠道发送相同的请求，先输出内容的一方获胜
+type ChannelHedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// 分组 -> 对冲延迟（毫秒），未配置的分组不对冲，只对流式请求生效
+	GroupDelays map[string]int `json:"group_delays"`
+}
+
+// 默认配置
+var channelHedgeSetting = ChannelHedgeSetting{
+	Enabled:     true,
+	GroupDelays: map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_hedge_setting", &channelHedgeSetting)
+}
+
+func GetChannelHedgeSetting() *ChannelHedgeSetting {
+	return &channelHedgeSetting
+}
+
+// GetGroupHedgeDelay 获取分组的对冲延迟，返回 0 表示不对冲
+func GetGroupHedgeDelay(group string) time.Duration {
+	if !channelHedgeSetting.Enabled {
+		return 0
+	}
+	delay, ok := channelHedgeSetting.GroupDelays[group]
+	if !ok || delay <= 0 {
+		return 0
+	}
+	return time.Duration(delay) * time.Millisecond
+}
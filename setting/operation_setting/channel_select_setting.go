@@ -0,0 +1,54 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+const (
+	// 按权重随机（默认）
+	ChannelSelectStrategyWeighted = "weighted"
+	// 按 EWMA 延迟（优先首字延迟）加权，延迟越低越容易被选中
+	ChannelSelectStrategyLatency = "latency"
+	// 优先选择进行中请求最少的渠道
+	ChannelSelectStrategyLeastRequests = "least_requests"
+	// 按错误率降低权重
+	ChannelSelectStrategyErrorPenalty = "error_penalty"
+)
+
+// ChannelSelectSetting 同一优先级内的渠道选择策略配置
+type ChannelSelectSetting struct {
+	// 未单独配置的分组使用的策略
+	DefaultStrategy string `json:"default_strategy"`
+	// 分组 -> 策略
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// 延迟与错误率 EWMA 的平滑系数 (0-1]，越大越偏向最近的请求
+	EWMAAlpha float64 `json:"ewma_alpha"`
+	// error_penalty 策略的惩罚指数，有效权重 = 权重 * (1 - 错误率)^ErrorPenalty
+	ErrorPenalty float64 `json:"error_penalty"`
+}
+
+// 默认配置
+var channelSelectSetting = ChannelSelectSetting{
+	DefaultStrategy: ChannelSelectStrategyWeighted,
+	GroupStrategies: map[string]string{},
+	EWMAAlpha:       0.2,
+	ErrorPenalty:    4,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_select_setting", &channelSelectSetting)
+}
+
+func GetChannelSelectSetting() *ChannelSelectSetting {
+	return &channelSelectSetting
+}
+
+// GetGroupChannelSelectStrategy 获取分组使用的渠道选择策略
+func GetGroupChannelSelectStrategy(group string) string {
+	if strategy, ok := channelSelectSetting.GroupStrategies[group]; ok && strategy != "" {
+		return strategy
+	}
+	if channelSelectSetting.DefaultStrategy != "" {
+		return channelSelectSetting.DefaultStrategy
+	}
+	return ChannelSelectStrategyWeighted
+}
@@ -0,0 +1,23 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// CreditSetting 授信（月结）用户的额度提醒
+type CreditSetting struct {
+	// 已透支的额度达到授信额度的该百分比时提醒用户
+	WarningPercent int `json:"warning_percent"`
+}
+
+// 默认配置
+var creditSetting = CreditSetting{
+	WarningPercent: 80,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("credit_setting", &creditSetting)
+}
+
+func GetCreditSetting() *CreditSetting {
+	return &creditSetting
+}
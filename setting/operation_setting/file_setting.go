@@ -0,0 +1,31 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// FileSetting 文件接口（/v1/files）相关配置
+type FileSetting struct {
+	Enabled bool `json:"enabled"`
+	// 单个文件大小上限，单位 MB
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// 每个用户可占用的存储空间上限，单位 MB，0 表示不限制
+	UserStorageLimitMB int `json:"user_storage_limit_mb"`
+	// 文件保留天数，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+}
+
+// 默认配置
+var fileSetting = FileSetting{
+	Enabled:            true,
+	MaxFileSizeMB:      512,
+	UserStorageLimitMB: 1024,
+	RetentionDays:      0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+func GetFileSetting() *FileSetting {
+	return &fileSetting
+}
@@ -0,0 +1,41 @@
+package operation_setting
+
+import (
+	"one-api/setting/config"
+	"time"
+)
+
+// QuotaReservationSetting 额度预留账本：启用 Redis 时在 Redis 中原子地检查并预扣用户与令牌额度，
+// 预扣记录在请求结算时释放，实例崩溃遗留的预扣记录超过租期后由回收任务退还；
+// 开启后每个请求都会预扣，额度充足的用户不再跳过预扣，默认关闭
+type QuotaReservationSetting struct {
+	Enabled bool `json:"enabled"`
+	// 预扣记录的租期，应大于最长的请求耗时，超过后视为请求已中断并退还额度
+	LeaseSeconds int `json:"lease_seconds"`
+	// 回收任务的执行间隔
+	ReapIntervalSeconds int `json:"reap_interval_seconds"`
+}
+
+// 默认配置
+var quotaReservationSetting = QuotaReservationSetting{
+	Enabled:             false,
+	LeaseSeconds:        3600,
+	ReapIntervalSeconds: 60,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("quota_reservation_setting", &quotaReservationSetting)
+}
+
+func GetQuotaReservationSetting() *QuotaReservationSetting {
+	return &quotaReservationSetting
+}
+
+// GetQuotaReservationLease 获取预扣记录的租期，返回 0 表示不启用预留账本
+func GetQuotaReservationLease() time.Duration {
+	if !quotaReservationSetting.Enabled || quotaReservationSetting.LeaseSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(quotaReservationSetting.LeaseSeconds) * time.Second
+}
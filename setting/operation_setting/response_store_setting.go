@@ -0,0 +1,26 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// ResponseStoreSetting Responses API 会话状态存储配置
+type ResponseStoreSetting struct {
+	// 关闭后 previous_response_id 原样透传给上游
+	Enabled bool `json:"enabled"`
+	// 会话状态保留天数，从会话最后一轮开始计算，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+}
+
+// 默认配置
+var responseStoreSetting = ResponseStoreSetting{
+	Enabled:       true,
+	RetentionDays: 30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_store_setting", &responseStoreSetting)
+}
+
+func GetResponseStoreSetting() *ResponseStoreSetting {
+	return &responseStoreSetting
+}
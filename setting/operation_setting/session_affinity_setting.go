@@ -0,0 +1,42 @@
+package operation_setting
+
+import (
+	"one-api/setting/config"
+	"time"
+)
+
+// SessionAffinitySetting 会话亲和：同一会话的连续请求优先使用上次成功的渠道与密钥，以命中上游的提示词缓存
+type SessionAffinitySetting struct {
+	Enabled bool `json:"enabled"`
+	// 按顺序读取的会话请求头，取第一个非空值作为会话标识
+	SessionHeaders []string `json:"session_headers"`
+	// 没有会话请求头时，是否使用提示词前缀（系统提示词与第一条用户消息）的哈希作为会话标识
+	PrefixHashEnabled bool `json:"prefix_hash_enabled"`
+	// 会话绑定的有效期，每次成功请求后刷新
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// 默认配置
+var sessionAffinitySetting = SessionAffinitySetting{
+	Enabled:           true,
+	SessionHeaders:    []string{"X-Session-Id"},
+	PrefixHashEnabled: false,
+	TTLSeconds:        3600,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("session_affinity_setting", &sessionAffinitySetting)
+}
+
+func GetSessionAffinitySetting() *SessionAffinitySetting {
+	return &sessionAffinitySetting
+}
+
+// GetSessionAffinityTTL 获取会话绑定的有效期，返回 0 表示不启用会话亲和
+func GetSessionAffinityTTL() time.Duration {
+	if !sessionAffinitySetting.Enabled || sessionAffinitySetting.TTLSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(sessionAffinitySetting.TTLSeconds) * time.Second
+}
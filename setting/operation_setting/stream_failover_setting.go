@@ -0,0 +1,28 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// StreamFailoverSetting 流式响应发送首个内容块前失败时换渠道重试的配置
+type StreamFailoverSetting struct {
+	Enabled bool `json:"enabled"`
+	// 等待首个内容块的超时时间（秒），0 表示使用流式超时时间
+	FirstTokenTimeoutSeconds int `json:"first_token_timeout_seconds"`
+	// 首个内容块之前最多缓存的字节数，超过后直接发送给客户端，不再重试
+	MaxBufferBytes int `json:"max_buffer_bytes"`
+}
+
+// 默认配置，开启后首个内容块之前客户端收不到任何输出，需按需开启
+var streamFailoverSetting = StreamFailoverSetting{
+	Enabled:                  false,
+	FirstTokenTimeoutSeconds: 0,
+	MaxBufferBytes:           256 << 10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("stream_failover_setting", &streamFailoverSetting)
+}
+
+func GetStreamFailoverSetting() *StreamFailoverSetting {
+	return &streamFailoverSetting
+}
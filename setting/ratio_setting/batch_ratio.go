@@ -0,0 +1,41 @@
+package ratio_setting
+
+import (
+	"errors"
+	"one-api/setting/config"
+	"strconv"
+)
+
+// BatchRatioSetting 批处理（/v1/batches）请求的计费折扣
+type BatchRatioSetting struct {
+	// 批处理请求在分组倍率基础上再乘以该倍率，1 表示不打折
+	DiscountRatio float64 `json:"discount_ratio"`
+}
+
+var batchRatioSetting = BatchRatioSetting{
+	DiscountRatio: 0.5,
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_ratio_setting", &batchRatioSetting)
+}
+
+// GetBatchDiscountRatio 未设置或超出 (0, 1] 范围时按不打折处理
+func GetBatchDiscountRatio() float64 {
+	if batchRatioSetting.DiscountRatio <= 0 || batchRatioSetting.DiscountRatio > 1 {
+		return 1
+	}
+	return batchRatioSetting.DiscountRatio
+}
+
+// CheckBatchDiscountRatio 校验批处理折扣倍率，取值范围为 (0, 1]
+func CheckBatchDiscountRatio(value string) error {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return errors.New("批处理折扣倍率必须是数字")
+	}
+	if ratio <= 0 || ratio > 1 {
+		return errors.New("批处理折扣倍率的取值范围为 (0, 1]")
+	}
+	return nil
+}
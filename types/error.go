@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type OpenAIError struct {
@@ -51,6 +52,7 @@ const (
 	ErrorCodeChannelAwsClientError       ErrorCode = "channel:aws_client_error"
 	ErrorCodeChannelInvalidKey           ErrorCode = "channel:invalid_key"
 	ErrorCodeChannelResponseTimeExceeded ErrorCode = "channel:response_time_exceeded"
+	ErrorCodeChannelSaturated            ErrorCode = "channel:saturated"
 
 	// client request error
 	ErrorCodeReadRequestBodyFailed ErrorCode = "read_request_body_failed"
@@ -70,6 +72,7 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeTokenRateLimited           ErrorCode = "token_rate_limited"
 )
 
 type NewAPIError struct {
@@ -78,6 +81,8 @@ type NewAPIError struct {
 	ErrorType  ErrorType
 	errorCode  ErrorCode
 	StatusCode int
+	// 上游限流响应中给出的重置等待时间
+	RetryAfter time.Duration
 }
 
 func (e *NewAPIError) GetErrorCode() ErrorCode {
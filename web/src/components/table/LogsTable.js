@@ -1016,6 +1016,12 @@ const LogsTable = () => {
             value: other.upstream_model_name,
           });
         }
+        if (other?.requested_model) {
+          expandDataLocal.push({
+            key: t('原请求模型（已改用后备模型）'),
+            value: other.requested_model,
+          });
+        }
         let content = '';
         if (other?.ws || other?.audio) {
           content = renderAudioModelPrice(
@@ -16,6 +16,7 @@ export default function SettingGlobalModel(props) {
   const [loading, setLoading] = useState(false);
   const [inputs, setInputs] = useState({
     'global.pass_through_request_enabled': false,
+    'global.responses_only_models': '',
     'general_setting.ping_interval_enabled': false,
     'general_setting.ping_interval_seconds': 60,
   });
@@ -23,6 +24,9 @@ export default function SettingGlobalModel(props) {
   const [inputsRow, setInputsRow] = useState(inputs);
 
   function onSubmit() {
+    if (!verifyJSON(inputs['global.responses_only_models'] || '[]')) {
+      return showError(t('不是合法的 JSON 字符串'));
+    }
     const updateArray = compareObjects(inputs, inputsRow);
     if (!updateArray.length) return showWarning(t('你似乎并没有修改什么'));
     const requestQueue = updateArray.map((item) => {
@@ -91,6 +95,25 @@ export default function SettingGlobalModel(props) {
                 />
               </Col>
             </Row>
+            <Row>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.TextArea
+                  label={t('仅支持 Responses API 的模型')}
+                  field={'global.responses_only_models'}
+                  placeholder={t('例如：') + '\n' + JSON.stringify(['o3-pro', 'codex-mini'], null, 2)}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'global.responses_only_models': value,
+                    })
+                  }
+                  extraText={t(
+                    '按模型名前缀匹配，OpenAI 渠道会将这些模型的 Chat Completions 请求转换为 Responses 请求',
+                  )}
+                  autosize
+                />
+              </Col>
+            </Row>
             
             <Form.Section text={t('连接保活设置')}>
             <Row style={{ marginTop: 10 }}>
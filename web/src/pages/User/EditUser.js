@@ -57,6 +57,7 @@ const EditUser = (props) => {
     telegram_id: '',
     email: '',
     quota: 0,
+    credit_limit: 0,
     group: 'default',
     remark: '',
   });
@@ -98,6 +99,7 @@ const EditUser = (props) => {
     setLoading(true);
     let payload = { ...values };
     if (typeof payload.quota === 'string') payload.quota = parseInt(payload.quota) || 0;
+    if (typeof payload.credit_limit === 'string') payload.credit_limit = parseInt(payload.credit_limit) || 0;
     if (userId) {
       payload.id = parseInt(userId);
     }
@@ -271,6 +273,18 @@ const EditUser = (props) => {
                           />
                         </Form.Slot>
                       </Col>
+
+                      <Col span={10}>
+                        <Form.InputNumber
+                          field='credit_limit'
+                          label={t('授信额度')}
+                          placeholder={t('允许余额透支的额度，0 为不允许透支')}
+                          step={500000}
+                          min={0}
+                          extraText={renderQuotaWithPrompt(values.credit_limit || 0)}
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
                     </Row>
                   </Card>
                 )}